@@ -0,0 +1,150 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package pf
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Block modes
+const (
+	BlockModeDefault BlockMode = iota
+	BlockModeDrop
+	BlockModeReturn
+	BlockModeReturnRST
+	BlockModeReturnICMP
+	BlockModeReturnICMP6
+)
+
+// BlockMode represents the policy keyword of a block Rule. BlockModeDefault omits the keyword,
+// so the global block-policy of pf applies
+type BlockMode int
+
+// BlockPolicy represents the policy of a block Rule, i. e. return-rst (ttl 64). TTL is only used
+// with BlockModeReturnRST. ICMPCode and ICMP6Code hold an ICMP unreachable code as number or name
+// (i. e. port-unr) and are only used with BlockModeReturnICMP and BlockModeReturnICMP6
+type BlockPolicy struct {
+	Mode      BlockMode
+	TTL       uint8
+	ICMPCode  string
+	ICMP6Code string
+}
+
+// ParseBlockPolicy parses a block policy as used after the block keyword of a pf rule
+// (i. e. "return-rst (ttl 64)" or "return-icmp (port-unr)") into a BlockPolicy
+func ParseBlockPolicy(s string) (BlockPolicy, error) {
+	tokens, err := tokenize(s)
+	if err != nil {
+		return BlockPolicy{}, err
+	}
+	p := &ruleParser{input: s, tokens: tokens}
+	bp, err := p.parseBlockPolicy()
+	if err != nil {
+		return BlockPolicy{}, err
+	}
+	if p.peek() != "" {
+		return BlockPolicy{}, p.fail("unexpected token after block policy")
+	}
+	return bp, nil
+}
+
+// String returns the Action in pf syntax
+func (a Action) String() string {
+	switch a {
+	case ActionPass:
+		return "pass"
+	case ActionBlock:
+		return "block"
+	case ActionMatch:
+		return "match"
+	case ActionAntispoof:
+		return "antispoof"
+	case ActionAnchor:
+		return "anchor"
+	default:
+		return ""
+	}
+}
+
+// String returns the BlockMode in pf syntax
+func (m BlockMode) String() string {
+	switch m {
+	case BlockModeDrop:
+		return "drop"
+	case BlockModeReturn:
+		return "return"
+	case BlockModeReturnRST:
+		return "return-rst"
+	case BlockModeReturnICMP:
+		return "return-icmp"
+	case BlockModeReturnICMP6:
+		return "return-icmp6"
+	default:
+		return ""
+	}
+}
+
+// String returns the BlockPolicy in pf syntax
+func (p BlockPolicy) String() string {
+	switch {
+	case p.Mode == BlockModeReturnRST && p.TTL > 0:
+		return fmt.Sprintf("%s (ttl %d)", p.Mode, p.TTL)
+	case p.Mode == BlockModeReturnICMP && p.ICMPCode != "" && p.ICMP6Code != "":
+		return fmt.Sprintf("%s (%s, %s)", p.Mode, p.ICMPCode, p.ICMP6Code)
+	case p.Mode == BlockModeReturnICMP && p.ICMPCode != "":
+		return fmt.Sprintf("%s (%s)", p.Mode, p.ICMPCode)
+	case p.Mode == BlockModeReturnICMP6 && p.ICMP6Code != "":
+		return fmt.Sprintf("%s (%s)", p.Mode, p.ICMP6Code)
+	default:
+		return p.Mode.String()
+	}
+}
+
+// Validate checks the BlockPolicy for options that do not belong to its mode and invalid ICMP codes
+func (p BlockPolicy) Validate() error {
+	if p.Mode < BlockModeDefault || p.Mode > BlockModeReturnICMP6 {
+		return fmt.Errorf("unknown block mode: %d", p.Mode)
+	}
+	if p.TTL > 0 && p.Mode != BlockModeReturnRST {
+		return fmt.Errorf("ttl is only valid for return-rst")
+	}
+	switch p.Mode {
+	case BlockModeReturnICMP:
+		if p.ICMP6Code != "" && p.ICMPCode == "" {
+			return fmt.Errorf("return-icmp with an icmp6 code requires an icmp code")
+		}
+	case BlockModeReturnICMP6:
+		if p.ICMPCode != "" {
+			return fmt.Errorf("return-icmp6 does not take an icmp code")
+		}
+	default:
+		if p.ICMPCode != "" || p.ICMP6Code != "" {
+			return fmt.Errorf("icmp codes are only valid for return-icmp and return-icmp6")
+		}
+	}
+	for _, c := range []string{p.ICMPCode, p.ICMP6Code} {
+		if err := validateICMPCode(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateICMPCode checks that the given string is empty, an ICMP code number or a code name
+func validateICMPCode(c string) error {
+	if c == "" {
+		return nil
+	}
+	if c[0] >= '0' && c[0] <= '9' {
+		if _, err := strconv.ParseUint(c, 10, 8); err != nil {
+			return fmt.Errorf("invalid icmp code: %q", c)
+		}
+		return nil
+	}
+	if !isIdentifier(c) {
+		return fmt.Errorf("invalid icmp code: %q", c)
+	}
+	return nil
+}
@@ -1,11 +1,24 @@
-// +build !windows,!plan9,!linux
+//go:build !windows && !plan9
+// +build !windows,!plan9
 
 package pf
 
-// Anchor is a pf firewall anchor struct
+import (
+	"fmt"
+	"strings"
+)
+
+// maxAnchorNameLen is the maximum length of a pf anchor path (MAXPATHLEN - 1)
+const maxAnchorNameLen = 1023
+
+// Anchor is a pf firewall anchor struct. The Name is the full path of the anchor, i. e. "outer/web"
+// for the child anchor "web" of the anchor "outer"
 type Anchor struct {
-	Name    string
-	ruleSet RuleSet
+	Name       string
+	ruleSet    RuleSet
+	tables     []TableDef
+	transRules []TranslationRule
+	children   []*Anchor
 }
 
 // NewAnchor returns a new Anchor struct. It requires an anchor name as parameter
@@ -31,7 +44,87 @@ func (a *Anchor) AddRule(r Rule) {
 	}
 }
 
-// RulesString returns a line separated string of all committed rules of the current Anchor
+// AddTranslationRule adds a given NatRule, RdrRule or BinatRule to the current Anchor. Translation
+// rules are always placed before the filter rules, as pf requires. For the rules to take effect, the
+// anchor has to be referenced by nat-anchor, rdr-anchor or binat-anchor in the main ruleset
+func (a *Anchor) AddTranslationRule(r TranslationRule) error {
+	if r == nil {
+		return fmt.Errorf("no translation rule given")
+	}
+	if err := r.Validate(); err != nil {
+		return err
+	}
+	a.transRules = append(a.transRules, r)
+	return nil
+}
+
+// TranslationRules returns the translation rules of the current Anchor
+func (a *Anchor) TranslationRules() []TranslationRule {
+	return a.transRules
+}
+
+// Child returns the child anchor with the given name, i. e. the anchor "outer/web" for the name "web"
+// of the anchor "outer". The child anchor is created if it does not exist yet. Its rules are only
+// evaluated if the current Anchor contains an anchor call rule for it
+func (a *Anchor) Child(n string) *Anchor {
+	childName := strings.TrimSuffix(a.Name, "/") + "/" + n
+	for _, c := range a.children {
+		if c.Name == childName {
+			return c
+		}
+	}
+	c := &Anchor{Name: childName}
+	a.children = append(a.children, c)
+	return c
+}
+
+// Children returns the child anchors of the current Anchor
+func (a *Anchor) Children() []*Anchor {
+	return a.children
+}
+
+// RulesString returns a line separated string of all table definitions, translation rules and
+// committed filter rules of the current Anchor
 func (a *Anchor) RulesString() string {
-	return a.ruleSet.RulesString()
+	lineArray := a.ruleLines()
+	ruleArray := make([]string, 0, len(lineArray))
+	for _, l := range lineArray {
+		ruleArray = append(ruleArray, l.text)
+	}
+	return strings.Join(ruleArray, "\n")
+}
+
+// ruleLines returns the lines of the ruleset of the current Anchor, each with the table definition,
+// translation rule or committed filter rule it has been rendered from
+func (a *Anchor) ruleLines() []ruleLine {
+	lineArray := make([]ruleLine, 0, len(a.tables)+len(a.transRules)+len(a.ruleSet.Rules))
+	for i, t := range a.tables {
+		lineArray = append(lineArray, ruleLine{kind: RuleKindTable, index: i, text: t.String(), validate: t.Validate})
+	}
+	for i, r := range a.transRules {
+		lineArray = append(lineArray, ruleLine{kind: RuleKindTranslation, index: i, text: r.String(),
+			validate: r.Validate})
+	}
+	return append(lineArray, a.ruleSet.ruleLines()...)
+}
+
+// validateAnchorName checks that the given string is a valid anchor path. If w is set, the last
+// component of the path can be the wildcard *
+func validateAnchorName(n string, w bool) error {
+	if n == "" || len(n) > maxAnchorNameLen {
+		return fmt.Errorf("invalid anchor name length: %q", n)
+	}
+	if strings.HasPrefix(n, "_") {
+		return fmt.Errorf("anchor names beginning with _ are reserved: %q", n)
+	}
+	compArray := strings.Split(strings.TrimPrefix(n, "/"), "/")
+	for i, c := range compArray {
+		if c == "*" && w && i == len(compArray)-1 {
+			continue
+		}
+		if c == "" || strings.ContainsAny(c, "*\"\\ \t\n") {
+			return fmt.Errorf("invalid anchor name: %q", n)
+		}
+	}
+	return nil
 }
@@ -0,0 +1,102 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package pf
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/wneessen/go-pf/pftest"
+)
+
+// TestFirewall_Anchors tests the listing of anchors below an anchor path
+func TestFirewall_Anchors(t *testing.T) {
+	f, r := newTestFirewall(t)
+	r.On(pftest.Response{Stdout: "  blacklistd\n  go-pf\n"}, "-s", "Anchors")
+	r.On(pftest.Response{Stdout: "  go-pf/web\n  go-pf/mail\n"}, "-a", "go-pf", "-s", "Anchors")
+	testTable := []struct {
+		testName string
+		path     string
+		want     []string
+	}{
+		{"Main ruleset", "", []string{"blacklistd", "go-pf"}},
+		{"Anchor path", "go-pf", []string{"go-pf/web", "go-pf/mail"}},
+	}
+	for _, testCase := range testTable {
+		t.Run(testCase.testName, func(t *testing.T) {
+			anchorArray, err := f.Anchors(testCase.path)
+			if err != nil {
+				t.Fatalf("Anchors failed: %s", err)
+			}
+			if strings.Join(anchorArray, " ") != strings.Join(testCase.want, " ") {
+				t.Errorf("unexpected anchors. Expected: %q, got: %q", testCase.want, anchorArray)
+			}
+		})
+	}
+}
+
+// TestFirewall_AnchorRecursive tests the recursive commit and flush of an anchor hierarchy
+func TestFirewall_AnchorRecursive(t *testing.T) {
+	f, r := newTestFirewall(t)
+	a := f.NewAnchor("go-pf")
+	ar := a.NewRule()
+	if err := ar.SetAnchor("web"); err != nil {
+		t.Fatalf("SetAnchor failed: %s", err)
+	}
+	ar.SetDirection(DirectionIn)
+	ar.SetInterface("em0")
+	ar.Commit()
+	a.AddRule(ar)
+
+	web := a.Child("web")
+	if web.Name != "go-pf/web" || a.Child("web") != web || len(a.Children()) != 1 {
+		t.Fatalf("unexpected child anchor: %+v", web)
+	}
+	wr := web.NewRule()
+	wr.SetAction(ActionPass)
+	wr.SetProtocol(ProtocolTcp)
+	wr.SetDestinationPort(80)
+	wr.Commit()
+	web.AddRule(wr)
+	web.Child("static")
+
+	if err := f.CommitAnchorRecursive(&a); err != nil {
+		t.Fatalf("CommitAnchorRecursive failed: %s", err)
+	}
+	callArray := r.Calls()
+	want := []struct{ args, stdin string }{
+		{"-q -a go-pf -f - -v", "anchor \"web\" in on em0 from any to any\n"},
+		{"-q -a go-pf/web -f - -v", "pass proto tcp from any to any port 80\n"},
+		{"-q -a go-pf/web/static -f - -v", "\n"},
+	}
+	if len(callArray) != len(want) {
+		t.Fatalf("unexpected number of pfctl calls. Expected: %d, got: %d", len(want), len(callArray))
+	}
+	for i, c := range callArray {
+		if strings.Join(c.Args, " ") != want[i].args || string(c.Stdin) != want[i].stdin {
+			t.Errorf("unexpected pfctl call %d: %q with stdin %q", i, c.Args, string(c.Stdin))
+		}
+	}
+
+	r.Reset()
+	r.On(pftest.Response{Stdout: "  go-pf/web\n  go-pf/web/static\n  go-pf/mail\n"}, "-a", "go-pf", "-v", "-s",
+		"Anchors")
+	if _, err := f.FlushAnchor(&a, FlushRules, true); err != nil {
+		t.Fatalf("FlushAnchor failed: %s", err)
+	}
+	flushArray := make([]string, 0)
+	for _, c := range r.Calls()[1:] {
+		flushArray = append(flushArray, strings.Join(c.Args, " "))
+	}
+	wantFlush := []string{"-a go-pf/web/static -F rules", "-a go-pf/web -F rules", "-a go-pf/mail -F rules",
+		"-a go-pf -F rules"}
+	if strings.Join(flushArray, "\n") != strings.Join(wantFlush, "\n") {
+		t.Errorf("unexpected flush order. Expected: %q, got: %q", wantFlush, flushArray)
+	}
+
+	invalid := f.NewAnchor("_reserved")
+	if err := f.CommitAnchorRecursive(&invalid); err == nil {
+		t.Errorf("CommitAnchorRecursive with reserved anchor name was supposed to fail")
+	}
+}
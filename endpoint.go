@@ -0,0 +1,275 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package pf
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// Address kinds
+const (
+	AddrNetwork AddrKind = iota
+	AddrTable
+	AddrInterface
+	AddrSelf
+	AddrNoRoute
+	AddrURPFFailed
+)
+
+// maxTableNameLen is the maximum length of a pf table name (PF_TABLE_NAME_SIZE - 1)
+const maxTableNameLen = 31
+
+// AddrKind represents the kind of an Address in the pf firewall ruleset
+type AddrKind int
+
+// Address represents a single address item of an Endpoint. Depending on the Kind, the address is
+// an IP network (Network), a table or an interface (Name). Interface addresses can be restricted
+// by a Modifier (network, broadcast, peer or 0) and are resolved on every interface address change
+// if Dynamic is set, i. e. (em0)
+type Address struct {
+	Kind     AddrKind
+	Negated  bool
+	Network  *net.IPNet
+	Name     string
+	Modifier string
+	Dynamic  bool
+}
+
+// Endpoint represents the addresses of a source or destination of a Rule. An empty Endpoint
+// matches any address, an Endpoint with more than one Address is rendered as pf list
+type Endpoint []Address
+
+// NetworkAddr returns an Address for the given IP network
+func NetworkAddr(n *net.IPNet) Address {
+	return Address{Kind: AddrNetwork, Network: n}
+}
+
+// PrefixAddr returns an Address for the given prefix
+func PrefixAddr(p netip.Prefix) (Address, error) {
+	ipNet, err := prefixToIPNet(p)
+	if err != nil {
+		return Address{}, err
+	}
+	return NetworkAddr(ipNet), nil
+}
+
+// TableAddr returns an Address that references the given pf table, i. e. <bruteforce>
+func TableAddr(t string) Address {
+	return Address{Kind: AddrTable, Name: t}
+}
+
+// InterfaceAddr returns an Address for the addresses of the given interface or interface group.
+// The optional modifier restricts it to the network, broadcast or peer address or to the first
+// address (0) of the interface
+func InterfaceAddr(i string, m ...string) Address {
+	addr := Address{Kind: AddrInterface, Name: i}
+	if len(m) > 0 {
+		addr.Modifier = m[0]
+	}
+	return addr
+}
+
+// DynamicInterfaceAddr returns an Address like InterfaceAddr, which is updated by pf whenever the
+// addresses of the interface change, i. e. (em0)
+func DynamicInterfaceAddr(i string, m ...string) Address {
+	addr := InterfaceAddr(i, m...)
+	addr.Dynamic = true
+	return addr
+}
+
+// SelfAddr returns an Address that matches all addresses of the local host
+func SelfAddr() Address {
+	return Address{Kind: AddrSelf}
+}
+
+// NoRouteAddr returns an Address that matches all addresses that are not routable
+func NoRouteAddr() Address {
+	return Address{Kind: AddrNoRoute}
+}
+
+// URPFFailedAddr returns an Address that matches all packets failing the unicast reverse path
+// forwarding check. It is only valid as source address
+func URPFFailedAddr() Address {
+	return Address{Kind: AddrURPFFailed}
+}
+
+// Not returns a negated copy of the Address
+func (a Address) Not() Address {
+	a.Negated = !a.Negated
+	return a
+}
+
+// String returns the Address in pf syntax
+func (a Address) String() string {
+	var addr string
+	switch a.Kind {
+	case AddrNetwork:
+		addr = a.Network.String()
+	case AddrTable:
+		addr = fmt.Sprintf("<%s>", a.Name)
+	case AddrInterface:
+		addr = a.Name
+		if a.Modifier != "" {
+			addr = fmt.Sprintf("%s:%s", addr, a.Modifier)
+		}
+		if a.Dynamic {
+			addr = fmt.Sprintf("(%s)", addr)
+		}
+	case AddrSelf:
+		addr = "self"
+	case AddrNoRoute:
+		addr = "no-route"
+	case AddrURPFFailed:
+		addr = "urpf-failed"
+	}
+	if a.Negated {
+		return fmt.Sprintf("! %s", addr)
+	}
+	return addr
+}
+
+// Validate checks the Address for missing networks and invalid table or interface names
+func (a Address) Validate() error {
+	switch a.Kind {
+	case AddrNetwork:
+		if a.Network == nil || ipFamily(a.Network) == "" {
+			return fmt.Errorf("no network given for network address")
+		}
+	case AddrTable:
+		if err := validateTableName(a.Name); err != nil {
+			return err
+		}
+	case AddrInterface:
+		if !isIdentifier(a.Name) || strings.Contains(a.Name, ":") || !isLetter(rune(a.Name[0])) {
+			return fmt.Errorf("invalid interface name: %q", a.Name)
+		}
+		switch a.Name {
+		case "any", "port", "route", "self", "no-route", "urpf-failed":
+			return fmt.Errorf("invalid interface name: %q", a.Name)
+		}
+		switch a.Modifier {
+		case "", "network", "broadcast", "peer", "0":
+		default:
+			return fmt.Errorf("invalid interface modifier: %q", a.Modifier)
+		}
+	case AddrSelf, AddrNoRoute, AddrURPFFailed:
+	default:
+		return fmt.Errorf("unknown address kind: %d", a.Kind)
+	}
+	if a.Kind != AddrNetwork && a.Network != nil {
+		return fmt.Errorf("network given for non-network address %s", a)
+	}
+	return nil
+}
+
+// String returns the Endpoint in pf syntax. An empty Endpoint is returned as "any"
+func (e Endpoint) String() string {
+	switch len(e) {
+	case 0:
+		return "any"
+	case 1:
+		return e[0].String()
+	}
+	addrArray := make([]string, 0, len(e))
+	for _, addr := range e {
+		addrArray = append(addrArray, addr.String())
+	}
+	return fmt.Sprintf("{ %s }", strings.Join(addrArray, " "))
+}
+
+// Validate checks all addresses of the Endpoint
+func (e Endpoint) Validate() error {
+	for _, addr := range e {
+		if err := addr.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// family returns the pf address family keyword of the Endpoint, if it only consists of IP networks
+// of the same address family. Otherwise an empty string is returned
+func (e Endpoint) family() string {
+	var fam string
+	for _, addr := range e {
+		if addr.Kind != AddrNetwork {
+			return ""
+		}
+		addrFam := ipFamily(addr.Network)
+		if fam != "" && addrFam != fam {
+			return ""
+		}
+		fam = addrFam
+	}
+	return fam
+}
+
+// network returns the IP network of an Endpoint that consists of a single, non-negated IP network.
+// For all other Endpoints, nil is returned
+func (e Endpoint) network() *net.IPNet {
+	if len(e) != 1 || e[0].Kind != AddrNetwork || e[0].Negated {
+		return nil
+	}
+	return e[0].Network
+}
+
+// has returns true if the Endpoint contains an Address of the given kind
+func (e Endpoint) has(k AddrKind) bool {
+	for _, addr := range e {
+		if addr.Kind == k {
+			return true
+		}
+	}
+	return false
+}
+
+// isLetter returns true if the given rune is an ASCII letter
+func isLetter(c rune) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// validateTableName checks that the given string is a valid pf table name
+func validateTableName(t string) error {
+	if t == "" || len(t) > maxTableNameLen {
+		return fmt.Errorf("invalid table name length: %q", t)
+	}
+	for _, c := range t {
+		if !isTableNameRune(c) {
+			return fmt.Errorf("invalid table name: %q", t)
+		}
+	}
+	return nil
+}
+
+// splitEndpoint returns an Endpoint for every Address of the given Endpoint. An empty Endpoint is
+// returned as is
+func splitEndpoint(e Endpoint) []Endpoint {
+	if len(e) == 0 {
+		return []Endpoint{e}
+	}
+	epArray := make([]Endpoint, 0, len(e))
+	for _, addr := range e {
+		epArray = append(epArray, Endpoint{addr})
+	}
+	return epArray
+}
+
+// familiesMatch returns false if two of the given pf address family keywords differ. Empty
+// address families match all address families
+func familiesMatch(f ...string) bool {
+	var fam string
+	for _, af := range f {
+		if af == "" {
+			continue
+		}
+		if fam != "" && af != fam {
+			return false
+		}
+		fam = af
+	}
+	return true
+}
@@ -0,0 +1,180 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package pf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Sentinel errors that classify the failure of a pfctl execution. They are meant to be used with
+// errors.Is on errors returned by the Firewall methods
+var (
+	// ErrPermissionDenied is returned if pfctl has no permission to access the pf device
+	ErrPermissionDenied = errors.New("permission denied")
+
+	// ErrTableNotFound is returned if the referenced table does not exist
+	ErrTableNotFound = errors.New("table does not exist")
+
+	// ErrAnchorNotFound is returned if the referenced anchor does not exist
+	ErrAnchorNotFound = errors.New("anchor does not exist")
+
+	// ErrSyntax is returned if pfctl rejected a ruleset due to a syntax error
+	ErrSyntax = errors.New("syntax error")
+
+	// ErrTimeout is returned if the pfctl execution exceeded its deadline
+	ErrTimeout = errors.New("pfctl execution timed out")
+
+	// ErrUnsupported is returned by the rule parser if a rule uses valid pf syntax that
+	// cannot be represented by a Rule
+	ErrUnsupported = errors.New("unsupported rule syntax")
+)
+
+// diagRegex matches pfctl diagnostics in the form of "stdin:3: syntax error"
+var diagRegex = regexp.MustCompile(`^([^:\s]+):(\d+): (.+)$`)
+
+// Diagnostic represents a single file/line specific message reported by pfctl
+type Diagnostic struct {
+	File    string
+	Line    int
+	Message string
+}
+
+// PfctlError is the error that is returned if a pfctl execution failed
+type PfctlError struct {
+	Args        []string
+	ExitCode    int
+	Stderr      string
+	Diagnostics []Diagnostic
+	Err         error
+}
+
+// ErrorList is a list of errors that occurred during an operation consisting of several pfctl
+// executions. It can be inspected with errors.Is and errors.As like any of the errors it holds
+type ErrorList []error
+
+// String returns the Diagnostic in the pfctl "file:line: message" notation
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s:%d: %s", d.File, d.Line, d.Message)
+}
+
+// Error satisfies the error interface for the PfctlError
+func (e *PfctlError) Error() string {
+	errMsg := fmt.Sprintf("pfctl %s failed", strings.Join(e.Args, " "))
+	if e.Err != nil {
+		errMsg = fmt.Sprintf("%s: %s", errMsg, e.Err)
+	} else {
+		errMsg = fmt.Sprintf("%s: exit status %d", errMsg, e.ExitCode)
+	}
+	if stdErr := strings.TrimSpace(e.Stderr); stdErr != "" {
+		errMsg = fmt.Sprintf("%s => %s", errMsg, strings.ReplaceAll(stdErr, "\n", "; "))
+	}
+	return errMsg
+}
+
+// Unwrap returns the underlying execution error of the PfctlError (if any)
+func (e *PfctlError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether the PfctlError matches one of the sentinel errors of this package
+func (e *PfctlError) Is(t error) bool {
+	stdErr := strings.ToLower(e.Stderr)
+	switch t {
+	case ErrTimeout:
+		return errors.Is(e.Err, context.DeadlineExceeded)
+	case ErrPermissionDenied:
+		return strings.Contains(stdErr, "permission denied") ||
+			strings.Contains(stdErr, "operation not permitted")
+	case ErrTableNotFound:
+		return strings.Contains(stdErr, "table does not exist")
+	case ErrAnchorNotFound:
+		if strings.Contains(stdErr, "anchor does not exist") {
+			return true
+		}
+		return hasArg(e.Args, "-a") && strings.Contains(stdErr, "diocgetrules: invalid argument")
+	case ErrSyntax:
+		if strings.Contains(stdErr, "syntax error") {
+			return true
+		}
+		for _, d := range e.Diagnostics {
+			if strings.Contains(strings.ToLower(d.Message), "syntax error") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Error satisfies the error interface for the ErrorList
+func (l ErrorList) Error() string {
+	errArray := make([]string, 0, len(l))
+	for _, e := range l {
+		errArray = append(errArray, e.Error())
+	}
+	return strings.Join(errArray, ", ")
+}
+
+// Is reports whether any of the errors in the ErrorList matches the target
+func (l ErrorList) Is(t error) bool {
+	for _, e := range l {
+		if errors.Is(e, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first error in the ErrorList that matches the target
+func (l ErrorList) As(t interface{}) bool {
+	for _, e := range l {
+		if errors.As(e, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// newPfctlError returns a new PfctlError for the given pfctl execution and parses the
+// diagnostics from the stderr output
+func newPfctlError(a []string, c int, se []byte, err error) *PfctlError {
+	return &PfctlError{
+		Args:        a,
+		ExitCode:    c,
+		Stderr:      string(se),
+		Diagnostics: parseDiagnostics(string(se)),
+		Err:         err,
+	}
+}
+
+// parseDiagnostics extracts all "file:line: message" diagnostics from the given pfctl output
+func parseDiagnostics(o string) []Diagnostic {
+	var diagArray []Diagnostic
+	for _, l := range strings.Split(o, "\n") {
+		m := diagRegex.FindStringSubmatch(strings.TrimSpace(l))
+		if m == nil {
+			continue
+		}
+		lineNum, err := strconv.Atoi(m[2])
+		if err != nil {
+			continue
+		}
+		diagArray = append(diagArray, Diagnostic{File: m[1], Line: lineNum, Message: m[3]})
+	}
+	return diagArray
+}
+
+// hasArg returns true if the given argument list contains the argument
+func hasArg(a []string, s string) bool {
+	for _, v := range a {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package pf
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/wneessen/go-pf/pftest"
+)
+
+// TestPfctlError_Is tests the classification of pfctl failures into sentinel errors
+func TestPfctlError_Is(t *testing.T) {
+	testTable := []struct {
+		testName string
+		response pftest.Response
+		sentinel error
+	}{
+		{"Permission denied", pftest.Response{Stderr: "pfctl: /dev/pf: Permission denied\n", ExitCode: 1},
+			ErrPermissionDenied},
+		{"Table not found", pftest.Response{Stderr: "pfctl: Table does not exist.\n", ExitCode: 1},
+			ErrTableNotFound},
+		{"Anchor not found", pftest.Response{Stderr: "pfctl: Anchor does not exist.\n", ExitCode: 1},
+			ErrAnchorNotFound},
+		{"Syntax error", pftest.Response{Stderr: "stdin:3: syntax error\n", ExitCode: 1}, ErrSyntax},
+		{"Timeout", pftest.Response{Delay: time.Millisecond * 200}, ErrTimeout},
+	}
+	for _, testCase := range testTable {
+		t.Run(testCase.testName, func(t *testing.T) {
+			f, r := newTestFirewall(t)
+			f.SetTimeout(time.Millisecond * 20)
+			r.Fallback = testCase.response
+			_, err := f.GetRules()
+			if !errors.Is(err, testCase.sentinel) {
+				t.Errorf("error %q is not classified as %q", err, testCase.sentinel)
+			}
+			var pfErr *PfctlError
+			if !errors.As(err, &pfErr) {
+				t.Fatalf("error is not a *PfctlError")
+			}
+			if pfErr.ExitCode != testCase.response.ExitCode && testCase.response.Delay == 0 {
+				t.Errorf("unexpected exit code. Expected: %d, got: %d", testCase.response.ExitCode,
+					pfErr.ExitCode)
+			}
+		})
+	}
+}
+
+// TestParseDiagnostics tests the parsing of file/line diagnostics from pfctl output
+func TestParseDiagnostics(t *testing.T) {
+	o := "stdin:3: syntax error\nstdin:12: macro 'ext_if' not defined\npfctl: Syntax error in config file: pf rules not loaded\n"
+	d := parseDiagnostics(o)
+	if len(d) != 2 {
+		t.Fatalf("unexpected number of diagnostics. Expected: 2, got: %d", len(d))
+	}
+	if d[0].File != "stdin" || d[0].Line != 3 || d[0].Message != "syntax error" {
+		t.Errorf("unexpected diagnostic: %+v", d[0])
+	}
+	if d[1].String() != "stdin:12: macro 'ext_if' not defined" {
+		t.Errorf("unexpected diagnostic string: %s", d[1])
+	}
+}
+
+// TestErrorList tests that errors.Is and errors.As work through an ErrorList
+func TestErrorList(t *testing.T) {
+	f, r := newTestFirewall(t)
+	f.SetTableChunkSize(1)
+	r.Fallback = pftest.Response{Stderr: "pfctl: Table does not exist.\n", ExitCode: 1}
+	err := f.AddToTableIP("testtable", "192.0.2.1", "192.0.2.2")
+	if !errors.Is(err, ErrTableNotFound) {
+		t.Errorf("error %q is not classified as %q", err, ErrTableNotFound)
+	}
+	var errList ErrorList
+	if !errors.As(err, &errList) || len(errList) != 2 {
+		t.Errorf("error does not contain an ErrorList with 2 errors")
+	}
+}
@@ -0,0 +1,250 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package pf
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Flush modifiers
+const (
+	FlushRules FlushModifier = iota
+	FlushNat
+	FlushQueue
+	FlushStates
+	FlushSources
+	FlushTables
+	FlushInfo
+	FlushAll
+)
+
+// FlushModifier represents the part of the packet filter that is flushed (i. e. rules or states)
+type FlushModifier int
+
+// FlushResult represents what has been flushed as reported by pfctl. Anchors lists the anchors
+// that have been flushed by FlushAnchor. Unlabeled lists the rules whose states FlushAnchor could
+// not kill, as they have no label
+type FlushResult struct {
+	Anchors     []string
+	Rules       bool
+	Nat         bool
+	Queues      bool
+	States      int
+	SourceNodes bool
+	Tables      int
+	Stats       bool
+	Unlabeled   []AnchorRule
+}
+
+// AnchorRule represents a rule of an anchor in pf syntax
+type AnchorRule struct {
+	Anchor string
+	Rule   string
+}
+
+// ruleLabelRegex matches the label of a rule in the pfctl -s rules output
+var ruleLabelRegex = regexp.MustCompile(`\slabel "([^"]*)"`)
+
+// flushRegex matches the summary lines pfctl prints after a flush
+var flushRegex = regexp.MustCompile(`^(?:(\d+) )?(rules cleared|nat cleared|altq cleared|states cleared|` +
+	`source tracking entries cleared|tables deleted|pf: statistics cleared)`)
+
+// String returns the FlushModifier as pfctl flush modifier
+func (m FlushModifier) String() string {
+	switch m {
+	case FlushRules:
+		return "rules"
+	case FlushNat:
+		return "nat"
+	case FlushQueue:
+		return "queue"
+	case FlushStates:
+		return "states"
+	case FlushSources:
+		return "Sources"
+	case FlushTables:
+		return "Tables"
+	case FlushInfo:
+		return "info"
+	case FlushAll:
+		return "all"
+	default:
+		return ""
+	}
+}
+
+// Flush flushes the given part of the main ruleset or of the global packet filter state
+func (f *Firewall) Flush(m FlushModifier) (FlushResult, error) {
+	return f.FlushContext(context.Background(), m)
+}
+
+// FlushContext flushes the given part of the main ruleset or of the global packet filter state. The
+// given context is used for the pfctl execution
+func (f *Firewall) FlushContext(ctx context.Context, m FlushModifier) (FlushResult, error) {
+	if m.String() == "" {
+		return FlushResult{}, fmt.Errorf("unknown flush modifier: %d", m)
+	}
+	_, stderrArray, err := f.execPfCtlSummary(ctx, nil, "-F", m.String())
+	if err != nil {
+		return FlushResult{}, err
+	}
+	return parseFlushSummary(stderrArray), nil
+}
+
+// FlushAnchor flushes the given part of a given Anchor. If r is set, the anchors below the Anchor
+// are flushed as well
+func (f *Firewall) FlushAnchor(a *Anchor, m FlushModifier, r bool) (FlushResult, error) {
+	return f.FlushAnchorContext(context.Background(), a, m, r)
+}
+
+// FlushAnchorContext flushes the given part of a given Anchor. If r is set, the anchors below the
+// Anchor are flushed as well. The given context is used for the pfctl executions.
+//
+// Only rules, nat, Tables, states and all can be flushed per anchor. The anchors below are taken
+// from the running ruleset and are flushed before their parents.
+//
+// Flushing the states of an anchor is best-effort: as pf keeps a single state table without a
+// reference to the anchor, the states are killed by the labels of the loaded rules of the anchor,
+// with one pfctl call per label, regardless of how the anchor is called (i. e. from a parent anchor
+// or by a wildcard). The states of rules without label are not killed, these rules are returned in
+// FlushResult.Unlabeled. The states of rules of other anchors with the same label are killed as
+// well, so labels should be unique to the anchor. Flushing all kills the states before it removes
+// the rules, nat rules and tables of the anchor.
+//
+// Queues, source nodes and statistics are not bound to anchors (pf does not record the anchor of a
+// source node) and can only be flushed by Flush
+func (f *Firewall) FlushAnchorContext(ctx context.Context, a *Anchor, m FlushModifier, r bool) (FlushResult, error) {
+	fr := FlushResult{}
+	switch m {
+	case FlushRules, FlushNat, FlushTables, FlushStates, FlushAll:
+	case FlushQueue, FlushSources, FlushInfo:
+		return fr, fmt.Errorf("%s are not bound to anchors and can only be flushed with Flush", m)
+	default:
+		return fr, fmt.Errorf("unknown flush modifier: %d", m)
+	}
+
+	anchorArray := make([]string, 0)
+	if r {
+		childArray, err := f.listAnchors(ctx, a.Name, true)
+		if err != nil {
+			return fr, err
+		}
+		sort.SliceStable(childArray, func(i, j int) bool {
+			return strings.Count(childArray[i], "/") > strings.Count(childArray[j], "/")
+		})
+		anchorArray = append(anchorArray, childArray...)
+	}
+	anchorArray = append(anchorArray, a.Name)
+
+	for _, n := range anchorArray {
+		if m == FlushStates || m == FlushAll {
+			killed, unlabeledArray, err := f.killAnchorStates(ctx, n)
+			fr.States += killed
+			fr.Unlabeled = append(fr.Unlabeled, unlabeledArray...)
+			if err != nil {
+				return fr, err
+			}
+		}
+		if m != FlushStates {
+			_, stderrArray, err := f.execPfCtlSummary(ctx, nil, "-a", n, "-F", m.String())
+			if err != nil {
+				return fr, err
+			}
+			fr.add(parseFlushSummary(stderrArray))
+		}
+		fr.Anchors = append(fr.Anchors, n)
+	}
+	return fr, nil
+}
+
+// killAnchorStates kills the states of all rules of the given anchor by their labels and returns
+// the number of killed states and the rules that create state, but have no label. Rules that are
+// not supported by Rule are checked by their pfctl output
+func (f *Firewall) killAnchorStates(ctx context.Context, n string) (int, []AnchorRule, error) {
+	rs, err := f.AnchorRulesContext(ctx, n)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to read the rules of anchor %q: %w", n, err)
+	}
+	labelArray := make([]string, 0)
+	labelSeen := make(map[string]bool)
+	unlabeledArray := make([]AnchorRule, 0)
+	addLabel := func(l, r string) {
+		switch {
+		case l == "":
+			unlabeledArray = append(unlabeledArray, AnchorRule{Anchor: n, Rule: r})
+		case !labelSeen[l]:
+			labelSeen[l] = true
+			labelArray = append(labelArray, l)
+		}
+	}
+	for _, ar := range rs.Rules {
+		if stateMode, _ := ar.state(); ar.Action == "pass" && stateMode != StateNone {
+			addLabel(ar.Label, ar.String())
+		}
+	}
+	for _, u := range rs.Unsupported {
+		if strings.HasPrefix(u.Rule, "pass ") && !strings.Contains(u.Rule, " no state") {
+			var l string
+			if m := ruleLabelRegex.FindStringSubmatch(u.Rule); m != nil {
+				l = m[1]
+			}
+			addLabel(l, u.Rule)
+		}
+	}
+
+	killed := 0
+	for _, l := range labelArray {
+		kr, err := f.KillStatesContext(ctx, KillSelector{Label: l})
+		if err != nil {
+			return killed, unlabeledArray, err
+		}
+		killed += kr.Killed
+	}
+	return killed, unlabeledArray, nil
+}
+
+// add adds the given FlushResult to the FlushResult
+func (fr *FlushResult) add(o FlushResult) {
+	fr.Rules = fr.Rules || o.Rules
+	fr.Nat = fr.Nat || o.Nat
+	fr.Queues = fr.Queues || o.Queues
+	fr.States += o.States
+	fr.SourceNodes = fr.SourceNodes || o.SourceNodes
+	fr.Tables += o.Tables
+	fr.Stats = fr.Stats || o.Stats
+}
+
+// parseFlushSummary parses the summary lines pfctl reports after a flush into a FlushResult
+func parseFlushSummary(o []string) FlushResult {
+	fr := FlushResult{}
+	for _, l := range o {
+		m := flushRegex.FindStringSubmatch(strings.TrimSpace(l))
+		if m == nil {
+			continue
+		}
+		n, _ := strconv.Atoi(m[1])
+		switch m[2] {
+		case "rules cleared":
+			fr.Rules = true
+		case "nat cleared":
+			fr.Nat = true
+		case "altq cleared":
+			fr.Queues = true
+		case "states cleared":
+			fr.States += n
+		case "source tracking entries cleared":
+			fr.SourceNodes = true
+		case "tables deleted":
+			fr.Tables += n
+		case "pf: statistics cleared":
+			fr.Stats = true
+		}
+	}
+	return fr
+}
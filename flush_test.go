@@ -0,0 +1,161 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package pf
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/wneessen/go-pf/pftest"
+)
+
+// TestFirewall_Flush tests the global flush and the parsing of the pfctl flush summary
+func TestFirewall_Flush(t *testing.T) {
+	testTable := []struct {
+		testName string
+		modifier FlushModifier
+		stderr   string
+		want     FlushResult
+	}{
+		{"Rules", FlushRules, "rules cleared\n", FlushResult{Rules: true}},
+		{"Nat", FlushNat, "nat cleared\n", FlushResult{Nat: true}},
+		{"Queue", FlushQueue, "altq cleared\n", FlushResult{Queues: true}},
+		{"States", FlushStates, "42 states cleared\n", FlushResult{States: 42}},
+		{"Sources", FlushSources, "source tracking entries cleared\n", FlushResult{SourceNodes: true}},
+		{"Tables", FlushTables, "3 tables deleted.\n", FlushResult{Tables: 3}},
+		{"Info", FlushInfo, "pf: statistics cleared\n", FlushResult{Stats: true}},
+		{"All", FlushAll, "rules cleared\nnat cleared\n0 tables deleted.\naltq cleared\n7 states cleared\n" +
+			"source tracking entries cleared\npf: statistics cleared\n", FlushResult{Rules: true, Nat: true,
+			Queues: true, States: 7, SourceNodes: true, Stats: true}},
+	}
+	for _, testCase := range testTable {
+		t.Run(testCase.testName, func(t *testing.T) {
+			f, r := newTestFirewall(t)
+			r.Fallback = pftest.Response{Stderr: testCase.stderr}
+			fr, err := f.Flush(testCase.modifier)
+			if err != nil {
+				t.Fatalf("Flush failed: %s", err)
+			}
+			c, _ := r.LastCall()
+			if strings.Join(c.Args, " ") != "-F "+testCase.modifier.String() {
+				t.Errorf("unexpected pfctl arguments: %q", c.Args)
+			}
+			if !reflect.DeepEqual(fr, testCase.want) {
+				t.Errorf("unexpected flush result. Expected: %+v, got: %+v", testCase.want, fr)
+			}
+		})
+	}
+
+	f, _ := newTestFirewall(t)
+	if _, err := f.Flush(FlushModifier(99)); err == nil {
+		t.Errorf("Flush with unknown modifier was supposed to fail")
+	}
+}
+
+// TestFirewall_FlushAnchor tests the anchor specific flush including the anchor states
+func TestFirewall_FlushAnchor(t *testing.T) {
+	testTable := []struct {
+		testName   string
+		modifier   FlushModifier
+		recursive  bool
+		want       FlushResult
+		kills      []string
+		shouldFail bool
+	}{
+		{"Rules", FlushRules, false, FlushResult{Anchors: []string{"dns"}, Rules: true}, nil, false},
+		{"Tables", FlushTables, false, FlushResult{Anchors: []string{"dns"}, Tables: 2}, nil, false},
+		{"States", FlushStates, false, FlushResult{Anchors: []string{"dns"}, States: 3},
+			[]string{"-k label -k dns-in"}, false},
+		{"All recursive", FlushAll, true, FlushResult{Anchors: []string{"dns/resolver", "dns"}, Rules: true,
+			Nat: true, Tables: 4, States: 4}, []string{"-k label -k resolver", "-k label -k dns-in"}, false},
+		{"Queue", FlushQueue, false, FlushResult{}, nil, true},
+		{"Sources", FlushSources, false, FlushResult{}, nil, true},
+		{"Info", FlushInfo, false, FlushResult{}, nil, true},
+	}
+	for _, testCase := range testTable {
+		t.Run(testCase.testName, func(t *testing.T) {
+			f, r := newTestFirewall(t)
+			r.On(pftest.Response{Stderr: "rules cleared\n"}, "-a", "dns", "-F", "rules")
+			r.On(pftest.Response{Stderr: "2 tables deleted.\n"}, "-a", "dns", "-F", "Tables")
+			r.On(pftest.Response{Stderr: "rules cleared\nnat cleared\n2 tables deleted.\n"}, "-a", "dns", "-F", "all")
+			r.On(pftest.Response{Stderr: "rules cleared\nnat cleared\n2 tables deleted.\n"}, "-a", "dns/resolver",
+				"-F", "all")
+			r.On(pftest.Response{Stdout: "  dns/resolver\n"}, "-a", "dns", "-v", "-s", "Anchors")
+			r.On(pftest.Response{Stdout: "block drop in all\n" +
+				"pass in on em0 proto udp from any to any port = domain keep state label \"dns-in\"\n" +
+				"pass in on em0 proto tcp from any to any port = domain flags S/SA keep state label \"dns-in\"\n" +
+				"anchor \"resolver\" all\n"}, "-a", "dns", "-s", "rules")
+			r.On(pftest.Response{Stdout: "pass out on em1 proto udp from any to any port = domain keep state " +
+				"label \"resolver\"\n"}, "-a", "dns/resolver", "-s", "rules")
+			r.On(pftest.Response{Stderr: "killed 3 states\n"}, "-k", "label", "-k", "dns-in")
+			r.On(pftest.Response{Stderr: "killed 1 states\n"}, "-k", "label", "-k", "resolver")
+
+			a := f.NewAnchor("dns")
+			fr, err := f.FlushAnchor(&a, testCase.modifier, testCase.recursive)
+			if err != nil && !testCase.shouldFail {
+				t.Fatalf("FlushAnchor failed: %s", err)
+			}
+			if err == nil && testCase.shouldFail {
+				t.Fatalf("FlushAnchor was supposed to fail, but didn't")
+			}
+			if testCase.shouldFail {
+				if len(r.Calls()) != 0 {
+					t.Errorf("FlushAnchor must not call pfctl for modifier %s", testCase.modifier)
+				}
+				return
+			}
+			if !reflect.DeepEqual(fr, testCase.want) {
+				t.Errorf("unexpected flush result. Expected: %+v, got: %+v", testCase.want, fr)
+			}
+			killArray := make([]string, 0)
+			flushed := make(map[string]bool)
+			for _, c := range r.Calls() {
+				args := strings.Join(c.Args, " ")
+				switch {
+				case args == "-F states":
+					t.Errorf("FlushAnchor must not flush the global state table")
+				case strings.HasPrefix(args, "-k "):
+					killArray = append(killArray, args)
+				case strings.HasSuffix(args, "-F all"):
+					flushed[c.Args[1]] = true
+				case strings.HasSuffix(args, "-s rules") && flushed[c.Args[2]]:
+					t.Errorf("rules of anchor %s must be read before they are flushed", c.Args[2])
+				}
+			}
+			if strings.Join(killArray, ",") != strings.Join(testCase.kills, ",") {
+				t.Errorf("unexpected kill calls. Expected: %q, got: %q", testCase.kills, killArray)
+			}
+		})
+	}
+}
+
+// TestFirewall_FlushAnchor_UnlabeledStates tests that the rules whose states cannot be killed are
+// returned instead of failing the flush, including rules that are not supported by Rule
+func TestFirewall_FlushAnchor_UnlabeledStates(t *testing.T) {
+	f, r := newTestFirewall(t)
+	r.On(pftest.Response{Stdout: "pass in proto tcp from any to any port = http flags S/SA keep state\n" +
+		"pass in inet proto icmp all icmp-type echoreq keep state label \"ping\"\n" +
+		"pass in on ! em0 inet proto udp from any to any port = domain keep state\n" +
+		"pass in proto udp from any to any port = ntp no state\n" +
+		"scrub in all fragment reassemble\n"}, "-a", "tenant/web", "-s", "rules")
+	r.On(pftest.Response{Stderr: "rules cleared\nnat cleared\n0 tables deleted.\n"}, "-a", "tenant/web", "-F", "all")
+	r.On(pftest.Response{Stderr: "killed 2 states\n"}, "-k", "label", "-k", "ping")
+
+	a := f.NewAnchor("tenant/web")
+	fr, err := f.FlushAnchor(&a, FlushAll, false)
+	if err != nil {
+		t.Fatalf("FlushAnchor failed: %s", err)
+	}
+	if fr.States != 2 || !fr.Rules {
+		t.Errorf("unexpected flush result: %+v", fr)
+	}
+	want := []AnchorRule{
+		{Anchor: "tenant/web", Rule: "pass in proto tcp from any to any port http flags S/SA keep state"},
+		{Anchor: "tenant/web", Rule: "pass in on ! em0 inet proto udp from any to any port = domain keep state"},
+	}
+	if !reflect.DeepEqual(fr.Unlabeled, want) {
+		t.Errorf("unexpected unlabeled rules. Expected: %+v, got: %+v", want, fr.Unlabeled)
+	}
+}
@@ -1,5 +1,5 @@
 module github.com/wneessen/go-pf
 
-go 1.16
+go 1.18
 
 require github.com/wneessen/go-fileperm v0.2.0
@@ -0,0 +1,216 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package pf
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"regexp"
+	"strconv"
+)
+
+// killRegex matches the summary line pfctl prints after killing states or source nodes
+var killRegex = regexp.MustCompile(`killed (\d+) (?:states|src nodes)(?: from (\d+) sources and (\d+) destinations)?`)
+
+// killHostsDirect is the number of networks up to which killHostStates kills the states of each
+// network without listing the state table first
+const killHostsDirect = 8
+
+// KillSelector selects the states or source nodes to be killed. Source and Destination select by
+// host or network, Label, ID and Gateway are mutually exclusive with them and with each other.
+// Interface restricts the selection to states on the given interface
+type KillSelector struct {
+	Source      *net.IPNet
+	Destination *net.IPNet
+	Interface   string
+	Label       string
+	ID          string
+	Gateway     net.IP
+}
+
+// KillResult represents the result of a state or source node kill as reported by pfctl
+type KillResult struct {
+	Killed       int
+	Sources      int
+	Destinations int
+}
+
+// KillStates kills all states that match the given KillSelector
+func (f *Firewall) KillStates(ks KillSelector) (KillResult, error) {
+	return f.KillStatesContext(context.Background(), ks)
+}
+
+// KillStatesContext kills all states that match the given KillSelector. The given context is used
+// for the pfctl execution
+func (f *Firewall) KillStatesContext(ctx context.Context, ks KillSelector) (KillResult, error) {
+	argArray, err := ks.args("-k")
+	if err != nil {
+		return KillResult{}, err
+	}
+	return f.execKill(ctx, argArray)
+}
+
+// KillSourceNodes kills all source tracking nodes that match the Source and Destination of the
+// given KillSelector
+func (f *Firewall) KillSourceNodes(ks KillSelector) (KillResult, error) {
+	return f.KillSourceNodesContext(context.Background(), ks)
+}
+
+// KillSourceNodesContext kills all source tracking nodes that match the Source and Destination of
+// the given KillSelector. The given context is used for the pfctl execution
+func (f *Firewall) KillSourceNodesContext(ctx context.Context, ks KillSelector) (KillResult, error) {
+	if ks.Label != "" || ks.ID != "" || ks.Gateway != nil || ks.Interface != "" {
+		return KillResult{}, fmt.Errorf("source nodes can only be killed by source and destination")
+	}
+	argArray, err := ks.args("-K")
+	if err != nil {
+		return KillResult{}, err
+	}
+	return f.execKill(ctx, argArray)
+}
+
+// execKill executes the given pfctl kill arguments and parses the pfctl summary into a KillResult
+func (f *Firewall) execKill(ctx context.Context, a []string) (KillResult, error) {
+	stdoutArray, stderrArray, err := f.execPfCtlSummary(ctx, nil, a...)
+	if err != nil {
+		return KillResult{}, err
+	}
+	kr := KillResult{}
+	for _, l := range append(stderrArray, stdoutArray...) {
+		m := killRegex.FindStringSubmatch(l)
+		if m == nil {
+			continue
+		}
+		r, _ := strconv.Atoi(m[1])
+		kr.Killed += r
+		if m[2] != "" {
+			r, _ = strconv.Atoi(m[2])
+			kr.Sources += r
+			r, _ = strconv.Atoi(m[3])
+			kr.Destinations += r
+		}
+	}
+	return kr, nil
+}
+
+// args returns the pfctl arguments for the KillSelector using the given kill flag (-k or -K)
+func (ks KillSelector) args(k string) ([]string, error) {
+	argArray := make([]string, 0)
+	if ks.Interface != "" {
+		argArray = append(argArray, "-i", ks.Interface)
+	}
+
+	selCount := 0
+	for _, s := range []bool{ks.Source != nil || ks.Destination != nil, ks.Label != "", ks.ID != "",
+		ks.Gateway != nil} {
+		if s {
+			selCount++
+		}
+	}
+	switch {
+	case selCount == 0:
+		return nil, fmt.Errorf("no kill selector given")
+	case selCount > 1:
+		return nil, fmt.Errorf("host, label, id and gateway selectors are mutually exclusive")
+	case ks.Label != "":
+		argArray = append(argArray, k, "label", k, ks.Label)
+	case ks.ID != "":
+		argArray = append(argArray, k, "id", k, ks.ID)
+	case ks.Gateway != nil:
+		argArray = append(argArray, k, "gateway", k, ks.Gateway.String())
+	default:
+		src := ks.Source
+		if src == nil {
+			src = anyNetwork(ks.Destination.IP)
+		}
+		argArray = append(argArray, k, src.String())
+		if ks.Destination != nil {
+			argArray = append(argArray, k, ks.Destination.String())
+		}
+	}
+	return argArray, nil
+}
+
+// killAddedStates kills all states from and to the given networks, if the Firewall is set to kill
+// the states of addresses added to a table. It returns the number of killed states
+func (f *Firewall) killAddedStates(ctx context.Context, n []*net.IPNet) (int, error) {
+	if !f.tableKill {
+		return 0, nil
+	}
+	kr, err := f.killHostStates(ctx, n)
+	return kr.Killed, err
+}
+
+// killHostStates kills all states from and to the given networks and sums up the results. Killing
+// takes two pfctl invocations per network. For more than killHostsDirect networks, the state table
+// is listed once and only the networks with states are killed, so that bulk additions of addresses
+// without any states don't spawn thousands of pfctl processes
+func (f *Firewall) killHostStates(ctx context.Context, n []*net.IPNet) (KillResult, error) {
+	kr := KillResult{}
+	if len(n) > killHostsDirect {
+		var err error
+		n, err = f.networksWithStates(ctx, n)
+		if err != nil {
+			return kr, err
+		}
+	}
+	for _, ipNet := range n {
+		for _, ks := range []KillSelector{{Source: ipNet}, {Destination: ipNet}} {
+			r, err := f.KillStatesContext(ctx, ks)
+			if err != nil {
+				return kr, err
+			}
+			kr.Killed += r.Killed
+			kr.Sources += r.Sources
+			kr.Destinations += r.Destinations
+		}
+	}
+	return kr, nil
+}
+
+// networksWithStates returns the given networks that at least one of the current states is from
+// or to. The state table is listed with a single pfctl invocation
+func (f *Firewall) networksWithStates(ctx context.Context, n []*net.IPNet) ([]*net.IPNet, error) {
+	stateArray, err := f.StatesContext(ctx, StateFilter{})
+	if err != nil {
+		return nil, err
+	}
+	hostMap := make(map[netip.Addr]int)
+	var netArray []int
+	for i, ipNet := range n {
+		ones, bits := ipNet.Mask.Size()
+		if addr, ok := netip.AddrFromSlice(ipNet.IP); ok && bits > 0 && ones == bits {
+			hostMap[addr.Unmap()] = i
+			continue
+		}
+		netArray = append(netArray, i)
+	}
+	foundArray := make([]bool, len(n))
+	for _, s := range stateArray {
+		for _, h := range s.hosts() {
+			if h.Addr == nil {
+				continue
+			}
+			if addr, ok := netip.AddrFromSlice(h.Addr); ok {
+				if i, ok := hostMap[addr.Unmap()]; ok {
+					foundArray[i] = true
+				}
+			}
+			for _, i := range netArray {
+				if n[i].Contains(h.Addr) {
+					foundArray[i] = true
+				}
+			}
+		}
+	}
+	var resArray []*net.IPNet
+	for i, found := range foundArray {
+		if found {
+			resArray = append(resArray, n[i])
+		}
+	}
+	return resArray, nil
+}
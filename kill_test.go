@@ -0,0 +1,156 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package pf
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/wneessen/go-pf/pftest"
+)
+
+// TestFirewall_KillStates tests the pfctl arguments and result parsing of KillStates
+func TestFirewall_KillStates(t *testing.T) {
+	_, srcNet, _ := net.ParseCIDR("192.0.2.0/24")
+	_, dstNet, _ := net.ParseCIDR("2001:db8::1/128")
+	testTable := []struct {
+		testName   string
+		selector   KillSelector
+		args       string
+		stderr     string
+		want       KillResult
+		shouldFail bool
+	}{
+		{"Source network", KillSelector{Source: srcNet}, "-k 192.0.2.0/24",
+			"killed 3 states from 1 sources and 0 destinations\n", KillResult{3, 1, 0}, false},
+		{"Destination only", KillSelector{Destination: dstNet, Interface: "em0"}, "-i em0 -k ::/0 -k 2001:db8::1/128",
+			"killed 1 states from 1 sources and 1 destinations\n", KillResult{1, 1, 1}, false},
+		{"Label", KillSelector{Label: "web"}, "-k label -k web", "killed 5 states\n", KillResult{Killed: 5}, false},
+		{"ID", KillSelector{ID: "5f3e1a0000000001"}, "-k id -k 5f3e1a0000000001", "killed 1 states\n",
+			KillResult{Killed: 1}, false},
+		{"Gateway", KillSelector{Gateway: net.ParseIP("192.0.2.1")}, "-k gateway -k 192.0.2.1",
+			"killed 2 states\n", KillResult{Killed: 2}, false},
+		{"No selector", KillSelector{}, "", "", KillResult{}, true},
+		{"Mutually exclusive", KillSelector{Source: srcNet, Label: "web"}, "", "", KillResult{}, true},
+	}
+	for _, testCase := range testTable {
+		t.Run(testCase.testName, func(t *testing.T) {
+			f, r := newTestFirewall(t)
+			r.Fallback = pftest.Response{Stderr: testCase.stderr}
+			kr, err := f.KillStates(testCase.selector)
+			if err != nil {
+				if !testCase.shouldFail {
+					t.Errorf("KillStates failed: %s", err)
+				}
+				return
+			}
+			if testCase.shouldFail {
+				t.Errorf("KillStates was supposed to fail")
+			}
+			c, _ := r.LastCall()
+			if strings.Join(c.Args, " ") != testCase.args {
+				t.Errorf("unexpected pfctl arguments. Expected: %q, got: %q", testCase.args, c.Args)
+			}
+			if kr != testCase.want {
+				t.Errorf("unexpected kill result. Expected: %+v, got: %+v", testCase.want, kr)
+			}
+		})
+	}
+}
+
+// TestFirewall_KillSourceNodes tests KillSourceNodes
+func TestFirewall_KillSourceNodes(t *testing.T) {
+	_, srcNet, _ := net.ParseCIDR("192.0.2.1/32")
+	f, r := newTestFirewall(t)
+	r.Fallback = pftest.Response{Stderr: "killed 2 src nodes from 1 sources and 0 destinations\n"}
+	kr, err := f.KillSourceNodes(KillSelector{Source: srcNet})
+	if err != nil {
+		t.Fatalf("KillSourceNodes failed: %s", err)
+	}
+	if kr.Killed != 2 || kr.Sources != 1 {
+		t.Errorf("unexpected kill result: %+v", kr)
+	}
+	if _, err := f.KillSourceNodes(KillSelector{Label: "web"}); err == nil {
+		t.Errorf("KillSourceNodes by label was supposed to fail")
+	}
+}
+
+// TestFirewall_SetTableKillStates tests that states are killed after the table insertion, if the
+// Firewall is set to do so
+func TestFirewall_SetTableKillStates(t *testing.T) {
+	f, r := newTestFirewall(t)
+	r.Fallback = pftest.Response{Stderr: "killed 1 states from 1 sources and 0 destinations\n"}
+	if err := f.AddToTableIP("blocklist", "192.0.2.1"); err != nil {
+		t.Fatalf("AddToTableIP failed: %s", err)
+	}
+	if len(r.Calls()) != 1 {
+		t.Errorf("states were not supposed to be killed without SetTableKillStates")
+	}
+
+	r.Reset()
+	f.SetTableKillStates(true)
+	if err := f.AddToTableIP("blocklist", "192.0.2.1"); err != nil {
+		t.Fatalf("AddToTableIP failed: %s", err)
+	}
+	callArray := r.Calls()
+	if len(callArray) != 3 || strings.Join(callArray[2].Args, " ") != "-k 0.0.0.0/0 -k 192.0.2.1/32" {
+		t.Errorf("unexpected pfctl invocations: %+v", callArray)
+	}
+
+	r.Reset()
+	tr, err := f.TableAdd("blocklist", "198.51.100.0/24")
+	if err != nil {
+		t.Fatalf("TableAdd failed: %s", err)
+	}
+	if tr.StatesKilled != 2 {
+		t.Errorf("unexpected number of killed states. Expected: 2, got: %d", tr.StatesKilled)
+	}
+
+	r.Reset()
+	r.Fallback = pftest.Response{Stderr: "pfctl: Table does not exist.\n", ExitCode: 1}
+	if err := f.AddToTableIP("blocklist", "192.0.2.1"); err == nil {
+		t.Errorf("AddToTableIP was supposed to fail")
+	}
+	if len(r.Calls()) != 1 {
+		t.Errorf("states should not be killed if the table insertion failed")
+	}
+}
+
+// TestFirewall_SetTableKillStates_Bulk tests that a bulk addition lists the state table once and only
+// kills the states of the networks that have states
+func TestFirewall_SetTableKillStates_Bulk(t *testing.T) {
+	stateOutput, err := os.ReadFile("testdata/pfctl-vvs-states.txt")
+	if err != nil {
+		t.Fatalf("failed to read test data: %s", err)
+	}
+	f, r := newTestFirewall(t)
+	f.SetTableKillStates(true)
+	r.On(pftest.Response{Stdout: string(stateOutput)}, "-vv", "-s", "states")
+	r.Fallback = pftest.Response{Stderr: "killed 1 states from 1 sources and 0 destinations\n"}
+	addrArray := []string{"203.0.113.0/24"}
+	for i := 1; i <= 100; i++ {
+		addrArray = append(addrArray, fmt.Sprintf("198.51.100.%d", i))
+	}
+	tr, err := f.TableAdd("blocklist", addrArray...)
+	if err != nil {
+		t.Fatalf("TableAdd failed: %s", err)
+	}
+	callArray := r.Calls()
+	if len(callArray) != 6 {
+		t.Fatalf("unexpected number of pfctl invocations. Expected: 6, got: %d", len(callArray))
+	}
+	wantArray := []string{"-k 203.0.113.0/24", "-k 0.0.0.0/0 -k 203.0.113.0/24", "-k 198.51.100.7/32",
+		"-k 0.0.0.0/0 -k 198.51.100.7/32"}
+	for i, want := range wantArray {
+		if args := strings.Join(callArray[i+2].Args, " "); args != want {
+			t.Errorf("unexpected kill invocation. Expected: %s, got: %s", want, args)
+		}
+	}
+	if tr.StatesKilled != 4 {
+		t.Errorf("unexpected number of killed states. Expected: 4, got: %d", tr.StatesKilled)
+	}
+}
@@ -0,0 +1,162 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package pf
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// maxLabelLen is the maximum length of a pf rule label (PF_RULE_LABEL_SIZE - 1)
+const maxLabelLen = 63
+
+// maxTagLen is the maximum length of a pf tag name (PF_TAG_NAME_SIZE - 1)
+const maxTagLen = 63
+
+// labelMacroRegex matches the macros in a label that pfctl expands when loading a rule
+var labelMacroRegex = regexp.MustCompile(`\$[a-z]+`)
+
+// labelProtoNames are the protocol names that pfctl expands in labels for protocol numbers and
+// protocol names that are not the name of their protocol number
+var labelProtoNames = map[string]string{"": "ip", "0": "ip", "1": "icmp", "6": "tcp", "17": "udp",
+	"58": "ipv6-icmp", "icmp6": "ipv6-icmp"}
+
+// labelMacros are the macros that pfctl expands in labels
+var labelMacros = []string{"$if", "$srcaddr", "$dstaddr", "$srcport", "$dstport", "$proto", "$nr"}
+
+// ExpandLabel returns the label of the Rule with its macros expanded as pfctl does when the rule
+// is loaded as the rule number nr: $if, $srcaddr, $dstaddr, $srcport, $dstport, $proto and $nr.
+// Service names are expanded to their port numbers and protocol numbers to their names. pfctl
+// loads a Rule with address or port lists as one rule per list item, each with its own label.
+// ExpandLabel returns the label of the first of them, ExpandLabels the labels of all of them.
+// Interface names and self, which pfctl resolves to the current interface addresses, are not
+// resolved
+func (a *Rule) ExpandLabel(nr int) string {
+	ruleArray := a.expandLists()
+	if len(ruleArray) == 0 {
+		return a.expandLabel(nr)
+	}
+	return ruleArray[0].expandLabel(nr)
+}
+
+// ExpandLabels returns the expanded labels of all rules that pfctl loads for the Rule, starting
+// with the rule number nr. See ExpandLabel for the expansion rules
+func (a *Rule) ExpandLabels(nr int) []string {
+	ruleArray := a.expandLists()
+	labelArray := make([]string, 0, len(ruleArray))
+	for i := range ruleArray {
+		labelArray = append(labelArray, ruleArray[i].expandLabel(nr+i))
+	}
+	return labelArray
+}
+
+// expandLabel returns the label of a Rule without address or port lists with its macros expanded
+func (a *Rule) expandLabel(nr int) string {
+	return labelMacroRegex.ReplaceAllStringFunc(a.Label, func(m string) string {
+		switch m {
+		case "$if":
+			if a.Interface == "" {
+				return "any"
+			}
+			return a.Interface
+		case "$srcaddr":
+			return labelAddr(a.source())
+		case "$dstaddr":
+			return labelAddr(a.destination())
+		case "$srcport":
+			return labelPort(a.sourcePorts(), a.Protocol)
+		case "$dstport":
+			return labelPort(a.destPorts(), a.Protocol)
+		case "$proto":
+			return labelProto(a.Protocol)
+		case "$nr":
+			return strconv.Itoa(nr)
+		default:
+			return m
+		}
+	})
+}
+
+// validateLabel checks that the given label fits into a pf rule and only uses known macros
+func validateLabel(l string) error {
+	if len(l) > maxLabelLen {
+		return fmt.Errorf("label %q is longer than %d characters", l, maxLabelLen)
+	}
+	if strings.ContainsAny(l, "\"\n") {
+		return fmt.Errorf("label %q contains invalid characters", l)
+	}
+	for _, m := range labelMacroRegex.FindAllString(l, -1) {
+		if !isLabelMacro(m) {
+			return fmt.Errorf("unknown label macro %s in label %q", m, l)
+		}
+	}
+	return nil
+}
+
+// validateTag checks that the given string is a valid pf tag name
+func validateTag(t string) error {
+	if t == "" || len(t) > maxTagLen || !isIdentifier(t) {
+		return fmt.Errorf("invalid tag name: %q", t)
+	}
+	return nil
+}
+
+// isLabelMacro returns true if the given string is a macro that pfctl expands in labels
+func isLabelMacro(m string) bool {
+	for _, lm := range labelMacros {
+		if lm == m {
+			return true
+		}
+	}
+	return false
+}
+
+// labelAddr returns the single Address of an Endpoint as pfctl expands it in labels. Host
+// addresses are expanded without prefix length, an empty Endpoint and 0.0.0.0/0 as any
+func labelAddr(e Endpoint) string {
+	if len(e) == 0 {
+		return "any"
+	}
+	addr := e[0]
+	if addr.Kind != AddrNetwork {
+		return addr.String()
+	}
+	addrStr := addr.Network.String()
+	ones, bits := addr.Network.Mask.Size()
+	switch {
+	case ones == 0 && addr.Network.IP.IsUnspecified():
+		addrStr = "any"
+	case ones == bits:
+		addrStr = addr.Network.IP.String()
+	}
+	if addr.Negated {
+		return fmt.Sprintf("! %s", addrStr)
+	}
+	return addrStr
+}
+
+// labelPort returns the single PortRange of a PortSpec as pfctl expands it in labels, with service
+// names resolved for the given protocol. pfctl does not expand the : range operator, so ranges
+// like 8000:8100 are expanded to an empty string, as is an empty PortSpec
+func labelPort(ps PortSpec, p string) string {
+	if len(ps) == 0 || ps[0].Op == PortOpRange {
+		return ""
+	}
+	pr := normalizePortRange(ps[0], p)
+	if pr.Op == PortOpEqual {
+		return pr.From
+	}
+	return strings.ReplaceAll(pr.String(), " ", "")
+}
+
+// labelProto returns the protocol as pfctl expands it in labels, which is the name of the protocol
+// number in the protocols database. Rules without protocol are expanded as ip (protocol 0)
+func labelProto(p string) string {
+	if protoName, ok := labelProtoNames[p]; ok {
+		return protoName
+	}
+	return p
+}
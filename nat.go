@@ -0,0 +1,283 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package pf
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TranslationRule is a nat, rdr or binat rule that can be added to an Anchor. It is implemented
+// by NatRule, RdrRule and BinatRule
+type TranslationRule interface {
+	String() string
+	Validate() error
+	translation() translation
+}
+
+// NatRule represents a pf nat rule that translates the source address of matching packets to the
+// Target address pool, i. e. nat on em0 from 10.0.0.0/8 to any -> (em0). No negates the rule, so
+// matching packets are not translated. TargetPort restricts the source ports used for translation
+type NatRule struct {
+	No           bool
+	Pass         bool
+	Log          bool
+	LogOpts      LogOptions
+	Interface    string
+	AdressFamily string
+	Protocol     string
+	Source       Endpoint
+	SourcePort   PortSpec
+	Destination  Endpoint
+	DestPort     PortSpec
+	Tag          string
+	Target       Endpoint
+	TargetPort   PortRange
+	Pool         PoolOptions
+	StaticPort   bool
+}
+
+// RdrRule represents a pf rdr rule that redirects the destination address and port of matching
+// packets to the Target address pool, i. e. rdr pass on em0 proto tcp to port 80 -> 10.0.0.5 port 8080.
+// The TargetPort can be a range or a range with the wildcard end *, i. e. 8000:*
+type RdrRule struct {
+	No           bool
+	Pass         bool
+	Log          bool
+	LogOpts      LogOptions
+	Interface    string
+	AdressFamily string
+	Protocol     string
+	Source       Endpoint
+	SourcePort   PortSpec
+	Destination  Endpoint
+	DestPort     PortSpec
+	Tag          string
+	Target       Endpoint
+	TargetPort   PortRange
+	Pool         PoolOptions
+}
+
+// BinatRule represents a pf binat rule that establishes a bidirectional mapping between the single
+// Source address or network and the Target address or network of the same size
+type BinatRule struct {
+	No           bool
+	Pass         bool
+	Log          bool
+	LogOpts      LogOptions
+	Interface    string
+	AdressFamily string
+	Protocol     string
+	Source       Endpoint
+	Destination  Endpoint
+	Tag          string
+	Target       Endpoint
+}
+
+// translation holds the parts that are common to all translation rules
+type translation struct {
+	kind       string
+	no         bool
+	pass       bool
+	match      Rule
+	tag        string
+	target     Endpoint
+	targetPort PortRange
+	pool       PoolOptions
+	staticPort bool
+}
+
+// ParseTranslationRule parses a single nat, rdr or binat rule, as written in pf.conf or printed by
+// pfctl -s nat, into a NatRule, RdrRule or BinatRule. If the rule uses features that cannot be
+// represented, the returned error wraps ErrUnsupported
+func ParseTranslationRule(s string) (TranslationRule, error) {
+	tokens, err := tokenize(s)
+	if err != nil {
+		return nil, &ParseError{Rule: s, Message: err.Error()}
+	}
+	p := &ruleParser{input: s, tokens: tokens}
+	tr, err := p.parseTranslation()
+	if err != nil {
+		return nil, err
+	}
+	if err := tr.Validate(); err != nil {
+		return nil, &ParseError{Rule: s, Message: err.Error()}
+	}
+	return tr, nil
+}
+
+// String returns the NatRule in pf syntax
+func (r NatRule) String() string {
+	return r.translation().String()
+}
+
+// Validate checks the NatRule for inconsistencies that pfctl would reject
+func (r NatRule) Validate() error {
+	return r.translation().Validate()
+}
+
+// translation returns the common parts of the NatRule
+func (r NatRule) translation() translation {
+	return translation{kind: "nat", no: r.No, pass: r.Pass, tag: r.Tag, target: r.Target,
+		targetPort: r.TargetPort, pool: r.Pool, staticPort: r.StaticPort,
+		match: Rule{Log: r.Log, LogOpts: r.LogOpts, Interface: r.Interface, AdressFamily: r.AdressFamily,
+			Protocol: r.Protocol, SourceAddrs: r.Source, SourcePorts: r.SourcePort, DestAddrs: r.Destination,
+			DestPorts: r.DestPort}}
+}
+
+// String returns the RdrRule in pf syntax
+func (r RdrRule) String() string {
+	return r.translation().String()
+}
+
+// Validate checks the RdrRule for inconsistencies that pfctl would reject
+func (r RdrRule) Validate() error {
+	return r.translation().Validate()
+}
+
+// translation returns the common parts of the RdrRule
+func (r RdrRule) translation() translation {
+	return translation{kind: "rdr", no: r.No, pass: r.Pass, tag: r.Tag, target: r.Target,
+		targetPort: r.TargetPort, pool: r.Pool,
+		match: Rule{Log: r.Log, LogOpts: r.LogOpts, Interface: r.Interface, AdressFamily: r.AdressFamily,
+			Protocol: r.Protocol, SourceAddrs: r.Source, SourcePorts: r.SourcePort, DestAddrs: r.Destination,
+			DestPorts: r.DestPort}}
+}
+
+// String returns the BinatRule in pf syntax
+func (r BinatRule) String() string {
+	return r.translation().String()
+}
+
+// Validate checks the BinatRule for inconsistencies that pfctl would reject, like a source or
+// target that is not a single address or network
+func (r BinatRule) Validate() error {
+	if err := r.translation().Validate(); err != nil {
+		return err
+	}
+	if len(r.Source) != 1 || r.Source[0].Negated || (r.Source[0].Kind != AddrNetwork &&
+		r.Source[0].Kind != AddrInterface) {
+		return fmt.Errorf("binat requires a single source address or network")
+	}
+	if r.No {
+		return nil
+	}
+	if len(r.Target) != 1 || r.Target[0].Kind != AddrNetwork {
+		return fmt.Errorf("binat requires a single target address or network")
+	}
+	if r.Source[0].Kind == AddrNetwork {
+		srcBits, _ := r.Source[0].Network.Mask.Size()
+		targetBits, _ := r.Target[0].Network.Mask.Size()
+		if srcBits != targetBits {
+			return fmt.Errorf("binat source %s and target %s are of different size", r.Source, r.Target)
+		}
+	}
+	return nil
+}
+
+// translation returns the common parts of the BinatRule
+func (r BinatRule) translation() translation {
+	return translation{kind: "binat", no: r.No, pass: r.Pass, tag: r.Tag, target: r.Target,
+		match: Rule{Log: r.Log, LogOpts: r.LogOpts, Interface: r.Interface, AdressFamily: r.AdressFamily,
+			Protocol: r.Protocol, SourceAddrs: r.Source, DestAddrs: r.Destination}}
+}
+
+// String returns the translation rule in pf syntax
+func (t translation) String() string {
+	ruleArray := make([]string, 0)
+	if t.no {
+		ruleArray = append(ruleArray, "no")
+	}
+	ruleArray = append(ruleArray, t.kind)
+	if t.pass {
+		ruleArray = append(ruleArray, "pass")
+	}
+	if t.match.Log {
+		ruleArray = append(ruleArray, t.match.logString())
+	}
+	ruleArray = append(ruleArray, t.match.hostsString())
+	if t.tag != "" {
+		ruleArray = append(ruleArray, fmt.Sprintf("tag %s", t.tag))
+	}
+	if len(t.target) > 0 {
+		ruleArray = append(ruleArray, fmt.Sprintf("-> %s", t.target))
+	}
+	if t.targetPort != (PortRange{}) {
+		ruleArray = append(ruleArray, fmt.Sprintf("port %s", t.targetPort))
+	}
+	if poolOpts := t.pool.String(); poolOpts != "" {
+		ruleArray = append(ruleArray, poolOpts)
+	}
+	if t.staticPort {
+		ruleArray = append(ruleArray, "static-port")
+	}
+	return strings.Join(ruleArray, " ")
+}
+
+// Validate checks the translation rule for inconsistencies that pfctl would reject
+func (t translation) Validate() error {
+	if err := t.match.validateHosts(); err != nil {
+		return err
+	}
+	if t.tag != "" {
+		if err := validateTag(t.tag); err != nil {
+			return err
+		}
+	}
+	if t.no {
+		if t.pass || len(t.target) > 0 || t.targetPort != (PortRange{}) || t.pool != (PoolOptions{}) || t.staticPort {
+			return fmt.Errorf("no %s rules do not take pass, a target or pool options", t.kind)
+		}
+		return nil
+	}
+	if len(t.target) == 0 {
+		return fmt.Errorf("%s rule requires a target", t.kind)
+	}
+	if err := t.pool.validatePool(t.target); err != nil {
+		return err
+	}
+	if t.kind == "binat" && t.pool != (PoolOptions{}) {
+		return fmt.Errorf("binat rules do not take pool options")
+	}
+	targetFam := t.target.family()
+	for _, fam := range []string{t.match.AdressFamily, t.match.source().family(), t.match.destination().family()} {
+		if fam != "" && targetFam != "" && fam != targetFam {
+			return fmt.Errorf("address family of target %s does not match the %s rule", t.target, fam)
+		}
+	}
+	if t.targetPort != (PortRange{}) {
+		if t.kind == "binat" {
+			return fmt.Errorf("binat rules do not take a target port")
+		}
+		if t.kind == "rdr" && t.match.Protocol != "tcp" && t.match.Protocol != "udp" {
+			return fmt.Errorf("rdr target ports are only valid for tcp and udp")
+		}
+		if err := validateTargetPort(t.targetPort, t.kind == "rdr"); err != nil {
+			return err
+		}
+	}
+	if t.staticPort && t.kind != "nat" {
+		return fmt.Errorf("static-port is only valid for nat rules")
+	}
+	return nil
+}
+
+// validateTargetPort checks that the given PortRange is a single port or a port range. If w is set,
+// the end of the range can be the wildcard *
+func validateTargetPort(r PortRange, w bool) error {
+	switch r.Op {
+	case PortOpEqual:
+		if r.To != "" {
+			return fmt.Errorf("target port %s does not take a second port", r.From)
+		}
+		return validatePort(r.From)
+	case PortOpRange:
+		if w && r.To == "*" {
+			return validatePort(r.From)
+		}
+		return r.Validate()
+	default:
+		return fmt.Errorf("target port operator %s is not supported", r.Op)
+	}
+}
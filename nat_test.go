@@ -0,0 +1,165 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package pf
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestParseTranslationRule tests the parsing and rendering of nat, rdr and binat rules
+func TestParseTranslationRule(t *testing.T) {
+	testTable := []struct {
+		testName   string
+		rule       string
+		want       string
+		shouldFail bool
+	}{
+		{"Nat to interface", "nat on em0 inet from 10.0.0.0/8 to any -> (em0) round-robin",
+			"nat on em0 inet from 10.0.0.0/8 to any -> (em0) round-robin", false},
+		{"Nat with static-port", "nat on em0 from 10.0.0.0/24 to any -> 192.0.2.1 static-port",
+			"nat on em0 from 10.0.0.0/24 to any -> 192.0.2.1/32 static-port", false},
+		{"Nat port range", "nat on em0 proto udp from 10.0.0.0/24 to any -> 192.0.2.1 port 1024:65535",
+			"nat on em0 proto udp from 10.0.0.0/24 to any -> 192.0.2.1/32 port 1024:65535", false},
+		{"Nat pool", "nat on em0 from 10.0.0.0/8 to any -> { 192.0.2.1 192.0.2.2 } round-robin sticky-address",
+			"nat on em0 from 10.0.0.0/8 to any -> { 192.0.2.1/32 192.0.2.2/32 } round-robin sticky-address", false},
+		{"Nat source-hash", "nat on em0 from 10.0.0.0/8 to any -> 192.0.2.0/28 source-hash 0x0123456789abcdef",
+			"nat on em0 from 10.0.0.0/8 to any -> 192.0.2.0/28 source-hash 0x0123456789abcdef", false},
+		{"No nat", "no nat on em0 from 10.0.0.1 to any", "no nat on em0 from 10.0.0.1/32 to any", false},
+		{"Rdr pass", "rdr pass on em0 inet proto tcp from any to any port = http -> 10.0.0.5 port 8080",
+			"rdr pass on em0 inet proto tcp from any to any port http -> 10.0.0.5/32 port 8080", false},
+		{"Rdr wildcard port", "rdr on em0 proto tcp to port 8000:8100 -> 10.0.0.5 port 9000:*",
+			"rdr on em0 proto tcp from any to any port 8000:8100 -> 10.0.0.5/32 port 9000:*", false},
+		{"Rdr log and tag", "rdr log on em0 proto tcp to port 25 tag MAIL -> <mailhosts> round-robin",
+			"rdr log on em0 proto tcp from any to any port 25 tag MAIL -> <mailhosts> round-robin", false},
+		{"Binat", "binat on em0 from 10.0.0.5 to any -> 192.0.2.5", "binat on em0 from 10.0.0.5/32 to any -> 192.0.2.5/32", false},
+		{"Nat without target", "nat on em0 from 10.0.0.0/8 to any", "", true},
+		{"No nat with target", "no nat on em0 from 10.0.0.0/8 to any -> 192.0.2.1", "", true},
+		{"Pool without round-robin", "nat on em0 from any to any -> { 192.0.2.1 192.0.2.2 }", "", true},
+		{"Table without round-robin", "nat on em0 from any to any -> <pool>", "", true},
+		{"Negated target", "nat on em0 from any to any -> ! 192.0.2.1", "", true},
+		{"Mixed address families", "nat on em0 inet6 from any to any -> 192.0.2.1", "", true},
+		{"Static-port for rdr", "rdr on em0 proto tcp to port 80 -> 10.0.0.5 static-port", "", true},
+		{"Wildcard port for nat", "nat on em0 proto tcp from any to any -> 192.0.2.1 port 1024:*", "", true},
+		{"Target port without proto", "rdr on em0 to any -> 10.0.0.5 port 80", "", true},
+		{"Binat size mismatch", "binat on em0 from 10.0.0.0/24 to any -> 192.0.2.0/28", "", true},
+		{"Binat list", "binat on em0 from { 10.0.0.1 10.0.0.2 } to any -> 192.0.2.1", "", true},
+		{"Filter rule", "pass in all", "", true},
+	}
+	for _, testCase := range testTable {
+		t.Run(testCase.testName, func(t *testing.T) {
+			tr, err := ParseTranslationRule(testCase.rule)
+			if err != nil {
+				if !testCase.shouldFail {
+					t.Errorf("ParseTranslationRule failed: %s", err)
+				}
+				return
+			}
+			if testCase.shouldFail {
+				t.Errorf("ParseTranslationRule was supposed to fail")
+			}
+			if tr.String() != testCase.want {
+				t.Errorf("unexpected rule. Expected: %q, got: %q", testCase.want, tr.String())
+			}
+			checkTranslationRoundTrip(t, tr)
+		})
+	}
+}
+
+// TestParseTranslationRule_Corpus tests the parser against a corpus of pfctl -s nat output. Every
+// rule must either parse and survive a round-trip or be reported as unsupported
+func TestParseTranslationRule_Corpus(t *testing.T) {
+	corpusData, err := os.ReadFile("testdata/pfctl-sn.txt")
+	if err != nil {
+		t.Fatalf("failed to read corpus: %s", err)
+	}
+	for _, l := range strings.Split(strings.TrimSpace(string(corpusData)), "\n") {
+		tr, err := ParseTranslationRule(l)
+		if err != nil {
+			if !errors.Is(err, ErrUnsupported) {
+				t.Errorf("ParseTranslationRule failed for %q: %s", l, err)
+			}
+			continue
+		}
+		checkTranslationRoundTrip(t, tr)
+	}
+}
+
+// FuzzParseTranslationRule makes sure that the parser does not panic and that every successfully
+// parsed translation rule survives a round-trip
+func FuzzParseTranslationRule(f *testing.F) {
+	corpusData, err := os.ReadFile("testdata/pfctl-sn.txt")
+	if err != nil {
+		f.Fatalf("failed to read corpus: %s", err)
+	}
+	for _, l := range strings.Split(string(corpusData), "\n") {
+		f.Add(l)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		tr, err := ParseTranslationRule(s)
+		if err != nil {
+			return
+		}
+		checkTranslationRoundTrip(t, tr)
+	})
+}
+
+// checkTranslationRoundTrip makes sure that the given TranslationRule parses back into the same rule
+func checkTranslationRoundTrip(t *testing.T, tr TranslationRule) {
+	t.Helper()
+	rt, err := ParseTranslationRule(tr.String())
+	if err != nil {
+		t.Errorf("ParseTranslationRule failed for round-trip of %q: %s", tr.String(), err)
+		return
+	}
+	if !reflect.DeepEqual(tr, rt) {
+		t.Errorf("round-trip mismatch. Expected: %+v, got: %+v", tr, rt)
+	}
+}
+
+// TestFirewall_CommitAnchor_Translation tests that translation rules are committed before filter rules
+func TestFirewall_CommitAnchor_Translation(t *testing.T) {
+	f, r := newTestFirewall(t)
+	a := f.NewAnchor("portforward")
+	ar := a.NewRule()
+	ar.SetAction(ActionPass)
+	ar.SetDirection(DirectionIn)
+	ar.SetProtocol(ProtocolTcp)
+	ar.SetDestinationPort(8080)
+	ar.Commit()
+	a.AddRule(ar)
+
+	rdr := RdrRule{Interface: "em0", Protocol: "tcp", DestPort: Port(80),
+		Target: Endpoint{NetworkAddr(testNetwork("10.0.0.5"))}, TargetPort: PortRange{From: "8080"}}
+	if err := a.AddTranslationRule(rdr); err != nil {
+		t.Fatalf("AddTranslationRule failed: %s", err)
+	}
+	nat := NatRule{Interface: "em0", Source: Endpoint{NetworkAddr(testNetwork("10.0.0.0/24"))},
+		Target: Endpoint{DynamicInterfaceAddr("em0")}}
+	if err := a.AddTranslationRule(nat); err != nil {
+		t.Fatalf("AddTranslationRule failed: %s", err)
+	}
+	if err := a.AddTranslationRule(NatRule{Interface: "em0"}); err == nil {
+		t.Errorf("AddTranslationRule without target was supposed to fail")
+	}
+	if err := a.AddTranslationRule(nil); err == nil {
+		t.Errorf("AddTranslationRule with nil rule was supposed to fail")
+	}
+
+	if err := f.CommitAnchor(&a); err != nil {
+		t.Fatalf("CommitAnchor failed: %s", err)
+	}
+	c, _ := r.LastCall()
+	want := []string{
+		"rdr on em0 proto tcp from any to any port 80 -> 10.0.0.5/32 port 8080",
+		"nat on em0 from 10.0.0.0/24 to any -> (em0)",
+		"pass in proto tcp from any to any port 8080",
+	}
+	if string(c.Stdin) != strings.Join(want, "\n")+"\n" {
+		t.Errorf("unexpected stdin: %q", string(c.Stdin))
+	}
+}
@@ -0,0 +1,1097 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package pf
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// ParseError is returned if a rule could not be parsed
+type ParseError struct {
+	Line    int
+	Rule    string
+	Token   string
+	Message string
+	Err     error
+}
+
+// token represents a single lexical token of a pf rule
+type token struct {
+	val    string
+	quoted bool
+}
+
+// ruleParser is a recursive descent parser for a single pf rule
+type ruleParser struct {
+	input  string
+	tokens []token
+	pos    int
+	rule   Rule
+}
+
+// Error satisfies the error interface for the ParseError
+func (e *ParseError) Error() string {
+	errMsg := fmt.Sprintf("failed to parse rule %q", e.Rule)
+	if e.Line > 0 {
+		errMsg = fmt.Sprintf("line %d: %s", e.Line, errMsg)
+	}
+	if e.Token != "" {
+		errMsg = fmt.Sprintf("%s at %q", errMsg, e.Token)
+	}
+	return fmt.Sprintf("%s: %s", errMsg, e.Message)
+}
+
+// Unwrap returns the underlying error of the ParseError (i. e. ErrUnsupported)
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// ParseRule parses a single pf rule, as written in pf.conf or printed by pfctl, into a Rule.
+// The returned Rule is committed. If the rule is valid pf syntax, but uses features that
+// cannot be represented by a Rule, the returned error wraps ErrUnsupported
+func ParseRule(s string) (Rule, error) {
+	tokens, err := tokenize(s)
+	if err != nil {
+		return Rule{}, &ParseError{Rule: s, Message: err.Error()}
+	}
+	p := &ruleParser{input: s, tokens: tokens}
+	if err := p.parse(); err != nil {
+		return Rule{}, err
+	}
+	p.rule.Commit()
+	if err := p.rule.Validate(); err != nil {
+		return Rule{}, &ParseError{Rule: s, Message: err.Error()}
+	}
+	return p.rule, nil
+}
+
+// parseStateString parses a state keyword with optional state options in pf syntax, i. e.
+// "keep state (max 100)", as used by the State field of a Rule
+func parseStateString(s string) (StateMode, StateOptions, error) {
+	tokens, err := tokenize(s)
+	if err != nil {
+		return StateDefault, StateOptions{}, &ParseError{Rule: s, Message: err.Error()}
+	}
+	p := &ruleParser{input: s, tokens: tokens}
+	if err := p.parseState(); err != nil {
+		return StateDefault, StateOptions{}, err
+	}
+	if p.peek() != "" {
+		return StateDefault, StateOptions{}, p.failToken(p.next(), "unexpected token after state")
+	}
+	return p.rule.StateMode, p.rule.StateOpts, nil
+}
+
+// ParseRuleSet reads pf rules line by line from the given io.Reader and parses them into a RuleSet.
+// Empty lines and comments are skipped and lines ending in a backslash are joined with the following
+// line. Rules that wrap ErrUnsupported are skipped and reported in RuleSet.Unsupported, so that the
+// output of pfctl -s rules can be parsed. All other errors are returned as *ParseError including the
+// line number
+func ParseRuleSet(r io.Reader) (RuleSet, error) {
+	rs := RuleSet{}
+	lineScanner := bufio.NewScanner(r)
+	lineNum, startLine := 0, 0
+	var ruleLine string
+	for lineScanner.Scan() {
+		lineNum++
+		l := strings.TrimSpace(lineScanner.Text())
+		if ruleLine == "" {
+			startLine = lineNum
+		}
+		if strings.HasSuffix(l, "\\") {
+			ruleLine += strings.TrimSuffix(l, "\\") + " "
+			continue
+		}
+		ruleLine = strings.TrimSpace(ruleLine + l)
+		if ruleLine == "" || strings.HasPrefix(ruleLine, "#") {
+			ruleLine = ""
+			continue
+		}
+		ar, err := ParseRule(ruleLine)
+		if err != nil {
+			parseErr, ok := err.(*ParseError)
+			if ok {
+				parseErr.Line = startLine
+			}
+			if ok && errors.Is(err, ErrUnsupported) {
+				rs.Unsupported = append(rs.Unsupported, parseErr)
+				ruleLine = ""
+				continue
+			}
+			return rs, err
+		}
+		rs.AddRule(ar)
+		ruleLine = ""
+	}
+	if err := lineScanner.Err(); err != nil {
+		return rs, err
+	}
+	if ruleLine != "" {
+		return rs, &ParseError{Line: startLine, Rule: ruleLine, Message: "unexpected end of input"}
+	}
+	return rs, nil
+}
+
+// tokenize splits a pf rule into tokens. Parentheses, braces, commas, negations, port operators,
+// translation arrows, table references and quoted strings are returned as separate tokens. Comments are stripped
+func tokenize(s string) ([]token, error) {
+	tokenArray := make([]token, 0)
+	r := []rune(s)
+	for i := 0; i < len(r); i++ {
+		c := r[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			continue
+		case c == '#':
+			return tokenArray, nil
+		case c == '"':
+			end := i + 1
+			for end < len(r) && r[end] != '"' {
+				end++
+			}
+			if end >= len(r) {
+				return tokenArray, fmt.Errorf("unterminated quoted string")
+			}
+			tokenArray = append(tokenArray, token{val: string(r[i+1 : end]), quoted: true})
+			i = end
+		case c == '-' && i+1 < len(r) && r[i+1] == '>':
+			tokenArray = append(tokenArray, token{val: "->"})
+			i++
+		case strings.ContainsRune("(){},", c):
+			tokenArray = append(tokenArray, token{val: string(c)})
+		case c == '<' && i+1 < len(r) && isTableNameRune(r[i+1]):
+			end := i + 1
+			for end < len(r) && (isTableNameRune(r[end]) || r[end] == ':') {
+				end++
+			}
+			if end >= len(r) || r[end] != '>' {
+				return tokenArray, fmt.Errorf("unterminated table reference")
+			}
+			tokenArray = append(tokenArray, token{val: string(r[i : end+1])})
+			i = end
+		case strings.ContainsRune("!<>=", c):
+			op := string(c)
+			if i+1 < len(r) && strings.ContainsRune("<>=", r[i+1]) {
+				op += string(r[i+1])
+				i++
+			}
+			tokenArray = append(tokenArray, token{val: op})
+		default:
+			end := i
+			for end < len(r) && !isTokenBoundary(r[end]) {
+				end++
+			}
+			tokenArray = append(tokenArray, token{val: string(r[i:end])})
+			i = end - 1
+		}
+	}
+	return tokenArray, nil
+}
+
+// isTokenBoundary returns true if the given rune terminates a word token
+func isTokenBoundary(c rune) bool {
+	return strings.ContainsRune(" \t\n\r#\"(){},!<>=", c)
+}
+
+// isTableNameRune returns true if the given rune is valid within a table name
+func isTableNameRune(c rune) bool {
+	return c == '_' || c == '-' || c == '.' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') ||
+		(c >= '0' && c <= '9')
+}
+
+// parse parses the tokens of the ruleParser into its Rule
+func (p *ruleParser) parse() error {
+	if p.accept("antispoof") {
+		return p.parseAntispoof()
+	}
+	if err := p.parseAction(); err != nil {
+		return err
+	}
+	if p.accept("in") {
+		p.rule.Direction = "in"
+	} else if p.accept("out") {
+		p.rule.Direction = "out"
+	}
+	if err := p.parseLog(); err != nil {
+		return err
+	}
+	if p.accept("quick") {
+		p.rule.Quick = true
+	}
+	if err := p.parseInterface(); err != nil {
+		return err
+	}
+	if err := p.parseRoute(); err != nil {
+		return err
+	}
+	if p.accept("inet") {
+		p.rule.AdressFamily = "inet"
+	} else if p.accept("inet6") {
+		p.rule.AdressFamily = "inet6"
+	}
+	if err := p.parseProto(); err != nil {
+		return err
+	}
+	if err := p.parseFromTo(); err != nil {
+		return err
+	}
+	return p.parseOptions()
+}
+
+// parseAction parses the action of the rule and the policy of block rules
+func (p *ruleParser) parseAction() error {
+	t := p.peek()
+	switch t {
+	case "pass", "block", "match":
+		p.next()
+		p.rule.Action = t
+	case "anchor":
+		p.next()
+		p.rule.Action = t
+		return p.parseAnchorName()
+	case "":
+		return p.fail("empty rule")
+	case "nat", "rdr", "binat", "no":
+		return p.unsupported(fmt.Sprintf("%s rules are translation rules, use ParseTranslationRule", t))
+	case "scrub", "nat-anchor", "rdr-anchor", "binat-anchor", "load":
+		return p.unsupported(fmt.Sprintf("%s rules are not supported", t))
+	default:
+		return p.fail("unknown action")
+	}
+	if t != "block" {
+		return nil
+	}
+	bp, err := p.parseBlockPolicy()
+	if err != nil {
+		return err
+	}
+	p.rule.Block = bp
+	return nil
+}
+
+// parseAnchorName parses the name of the anchor following the anchor keyword of an anchor call
+func (p *ruleParser) parseAnchorName() error {
+	if p.peek() == "{" {
+		return p.unsupported("inline anchor blocks are not supported")
+	}
+	tok := p.nextToken()
+	if tok.val == "" || (!tok.quoted && !isIdentifier(tok.val)) {
+		return p.failToken(tok.val, "expected anchor name")
+	}
+	if !tok.quoted {
+		switch tok.val {
+		case "in", "out", "quick", "on", "inet", "inet6", "proto", "from", "to", "all":
+			return p.failToken(tok.val, "expected anchor name")
+		}
+	}
+	if err := validateAnchorName(tok.val, true); err != nil {
+		return p.failToken(tok.val, err.Error())
+	}
+	p.rule.Anchor = tok.val
+	return nil
+}
+
+// parseBlockPolicy parses the optional policy of a block rule
+func (p *ruleParser) parseBlockPolicy() (BlockPolicy, error) {
+	bp := BlockPolicy{}
+	switch p.peek() {
+	case "drop":
+		bp.Mode = BlockModeDrop
+	case "return":
+		bp.Mode = BlockModeReturn
+	case "return-rst":
+		bp.Mode = BlockModeReturnRST
+	case "return-icmp":
+		bp.Mode = BlockModeReturnICMP
+	case "return-icmp6":
+		bp.Mode = BlockModeReturnICMP6
+	default:
+		return bp, nil
+	}
+	p.next()
+	if (bp.Mode != BlockModeReturnRST && bp.Mode != BlockModeReturnICMP && bp.Mode != BlockModeReturnICMP6) ||
+		!p.accept("(") {
+		return bp, nil
+	}
+	switch bp.Mode {
+	case BlockModeReturnRST:
+		if !p.accept("ttl") {
+			return bp, p.fail("expected ttl")
+		}
+		ttl := p.next()
+		n, err := strconv.ParseUint(ttl, 10, 8)
+		if err != nil {
+			return bp, p.failToken(ttl, "invalid ttl")
+		}
+		bp.TTL = uint8(n)
+	case BlockModeReturnICMP:
+		bp.ICMPCode = p.next()
+		if p.accept(",") {
+			bp.ICMP6Code = p.next()
+		}
+	case BlockModeReturnICMP6:
+		bp.ICMP6Code = p.next()
+	}
+	if !p.accept(")") {
+		return bp, p.fail("expected )")
+	}
+	if err := bp.Validate(); err != nil {
+		return bp, p.fail(err.Error())
+	}
+	return bp, nil
+}
+
+// parseAntispoof parses an antispoof directive following the antispoof keyword
+func (p *ruleParser) parseAntispoof() error {
+	p.rule.Action = "antispoof"
+	if err := p.parseLog(); err != nil {
+		return err
+	}
+	if p.accept("quick") {
+		p.rule.Quick = true
+	}
+	if !p.accept("for") {
+		return p.fail("expected for")
+	}
+	if p.peek() == "{" {
+		return p.unsupported("antispoof interface lists are not supported")
+	}
+	iface := p.next()
+	if !isIdentifier(iface) {
+		return p.failToken(iface, "expected interface name")
+	}
+	p.rule.Interface = iface
+	if p.accept("inet") {
+		p.rule.AdressFamily = "inet"
+	} else if p.accept("inet6") {
+		p.rule.AdressFamily = "inet6"
+	}
+	return p.parseOptions()
+}
+
+// parseLog parses the optional log keyword and its options
+func (p *ruleParser) parseLog() error {
+	if !p.accept("log") {
+		return nil
+	}
+	p.rule.Log = true
+	if !p.accept("(") {
+		return nil
+	}
+	for {
+		opt := p.next()
+		switch opt {
+		case "all":
+			p.rule.LogOpts.All = true
+		case "matches":
+			p.rule.LogOpts.Matches = true
+		case "user":
+			p.rule.LogOpts.User = true
+		case "to":
+			iface := p.next()
+			if !isIdentifier(iface) {
+				return p.failToken(iface, "expected log interface")
+			}
+			p.rule.LogOpts.To = iface
+		default:
+			return p.failToken(opt, "unknown log option")
+		}
+		if p.accept(")") {
+			return nil
+		}
+		if !p.accept(",") {
+			return p.fail("expected , or )")
+		}
+	}
+}
+
+// parseInterface parses the optional on keyword and its interface
+func (p *ruleParser) parseInterface() error {
+	if !p.accept("on") {
+		return nil
+	}
+	switch p.peek() {
+	case "!", "{":
+		return p.unsupported("interface negation and lists are not supported")
+	}
+	iface := p.next()
+	if !isIdentifier(iface) {
+		return p.failToken(iface, "expected interface name")
+	}
+	p.rule.Interface = iface
+	return nil
+}
+
+// parseRoute parses the optional policy routing option with its gateways and pool options
+func (p *ruleParser) parseRoute() error {
+	ro := RouteOptions{}
+	switch p.peek() {
+	case "fastroute":
+		p.next()
+		return p.unsupported("fastroute is no longer supported by pf")
+	case "route-to":
+		ro.Type = RouteTo
+	case "reply-to":
+		ro.Type = RouteReplyTo
+	case "dup-to":
+		ro.Type = RouteDupTo
+	default:
+		return nil
+	}
+	p.next()
+	if p.accept("{") {
+		for !p.accept("}") {
+			if p.peek() == "" {
+				return p.fail("expected }")
+			}
+			h, err := p.parseRouteHost()
+			if err != nil {
+				return err
+			}
+			ro.Hosts = append(ro.Hosts, h)
+			p.accept(",")
+		}
+	} else {
+		h, err := p.parseRouteHost()
+		if err != nil {
+			return err
+		}
+		ro.Hosts = append(ro.Hosts, h)
+	}
+	pool, err := p.parsePoolOptions()
+	if err != nil {
+		return err
+	}
+	ro.Pool = pool
+	if err := ro.Validate(); err != nil {
+		return p.fail(err.Error())
+	}
+	p.rule.Route = ro
+	return nil
+}
+
+// parseRouteHost parses a single gateway of a policy routing option, i. e. (em1 192.0.2.1) or em1
+func (p *ruleParser) parseRouteHost() (RouteHost, error) {
+	paren := p.accept("(")
+	rh := RouteHost{Interface: p.next()}
+	if err := InterfaceAddr(rh.Interface).Validate(); err != nil {
+		return rh, p.failToken(rh.Interface, err.Error())
+	}
+	if !paren {
+		return rh, nil
+	}
+	if !p.accept(")") {
+		addr, err := p.parseAddress()
+		if err != nil {
+			return rh, err
+		}
+		if addr.Kind != AddrNetwork || addr.Negated {
+			return rh, p.failToken(addr.String(), "expected gateway address")
+		}
+		rh.Address = addr.Network
+		if !p.accept(")") {
+			return rh, p.fail("expected )")
+		}
+	}
+	return rh, nil
+}
+
+// parseProto parses the optional proto keyword and its protocol
+func (p *ruleParser) parseProto() error {
+	if !p.accept("proto") {
+		return nil
+	}
+	if p.peek() == "{" {
+		return p.unsupported("protocol lists are not supported")
+	}
+	proto := p.next()
+	if !isIdentifier(proto) {
+		return p.failToken(proto, "expected protocol")
+	}
+	p.rule.Protocol = proto
+	return nil
+}
+
+// parseFromTo parses the source and destination part of the rule
+func (p *ruleParser) parseFromTo() error {
+	if p.accept("all") {
+		return nil
+	}
+	if p.accept("from") {
+		ep, port, err := p.parseHost()
+		if err != nil {
+			return err
+		}
+		p.rule.setSource(ep)
+		p.rule.setSourcePorts(port)
+	}
+	if p.accept("to") {
+		ep, port, err := p.parseHost()
+		if err != nil {
+			return err
+		}
+		p.rule.setDestination(ep)
+		p.rule.setDestPorts(port)
+	}
+	return nil
+}
+
+// parseHost parses the addresses and an optional port of a source or destination
+func (p *ruleParser) parseHost() (Endpoint, PortSpec, error) {
+	ep, err := p.parseEndpoint()
+	if err != nil {
+		return nil, nil, err
+	}
+	if !p.accept("port") {
+		return ep, nil, nil
+	}
+	ps, err := p.parsePortSpec()
+	if err != nil {
+		return nil, nil, err
+	}
+	return ep, ps, nil
+}
+
+// parseEndpoint parses any, a single address or a list of addresses
+func (p *ruleParser) parseEndpoint() (Endpoint, error) {
+	var ep Endpoint
+	switch t := p.peek(); {
+	case t == "any":
+		p.next()
+	case t == "" || t == "port":
+	case t == "route":
+		return nil, p.unsupported("route labels are not supported")
+	case p.accept("{"):
+		for !p.accept("}") {
+			if p.peek() == "" {
+				return nil, p.fail("expected }")
+			}
+			addr, err := p.parseAddress()
+			if err != nil {
+				return nil, err
+			}
+			ep = append(ep, addr)
+			p.accept(",")
+		}
+		if len(ep) == 0 {
+			return nil, p.fail("empty address list")
+		}
+	default:
+		addr, err := p.parseAddress()
+		if err != nil {
+			return nil, err
+		}
+		ep = Endpoint{addr}
+	}
+	return ep, nil
+}
+
+// parseAddress parses a single, optionally negated address item. Names that are neither keywords
+// nor IP addresses are parsed as interface names
+func (p *ruleParser) parseAddress() (Address, error) {
+	addr := Address{}
+	if p.accept("!") {
+		addr.Negated = true
+	}
+	tok := p.nextToken()
+	t := tok.val
+	switch {
+	case tok.quoted || t == "" || t == "any":
+		return addr, p.failToken(t, "expected address")
+	case t == "self":
+		addr.Kind = AddrSelf
+	case t == "no-route":
+		addr.Kind = AddrNoRoute
+	case t == "urpf-failed":
+		addr.Kind = AddrURPFFailed
+	case strings.HasPrefix(t, "<"):
+		addr.Kind = AddrTable
+		addr.Name = strings.TrimSuffix(strings.TrimPrefix(t, "<"), ">")
+		if i := strings.Index(addr.Name, ":"); i >= 0 {
+			if _, err := strconv.ParseUint(addr.Name[i+1:], 10, 32); err != nil {
+				return addr, p.failToken(t, "invalid table reference")
+			}
+			addr.Name = addr.Name[:i]
+		}
+	case t == "(":
+		iface := p.next()
+		if !p.accept(")") {
+			return addr, p.fail("expected )")
+		}
+		addr.Kind, addr.Dynamic = AddrInterface, true
+		addr.Name, addr.Modifier = splitInterfaceAddr(iface)
+	case net.ParseIP(strings.SplitN(t, "/", 2)[0]) != nil:
+		cidr := t
+		if !strings.Contains(cidr, "/") {
+			if strings.Contains(cidr, ":") {
+				cidr += "/128"
+			} else {
+				cidr += "/32"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return addr, p.failToken(t, "invalid address")
+		}
+		addr.Network = ipNet
+	case isIdentifier(t):
+		addr.Kind = AddrInterface
+		addr.Name, addr.Modifier = splitInterfaceAddr(t)
+	default:
+		return addr, p.failToken(t, "invalid address")
+	}
+	if err := addr.Validate(); err != nil {
+		return addr, p.failToken(t, err.Error())
+	}
+	return addr, nil
+}
+
+// splitInterfaceAddr splits an interface address (i. e. em0:network) into interface name and
+// modifier. An empty modifier after the colon is returned as invalid modifier
+func splitInterfaceAddr(s string) (string, string) {
+	if i := strings.Index(s, ":"); i >= 0 {
+		if i == len(s)-1 {
+			return s[:i], ":"
+		}
+		return s[:i], s[i+1:]
+	}
+	return s, ""
+}
+
+// parsePortSpec parses a single port item or a list of port items following the port keyword
+func (p *ruleParser) parsePortSpec() (PortSpec, error) {
+	if !p.accept("{") {
+		pr, err := p.parsePortRange()
+		if err != nil {
+			return nil, err
+		}
+		return PortSpec{pr}, nil
+	}
+	ps := PortSpec{}
+	for !p.accept("}") {
+		if p.peek() == "" {
+			return nil, p.fail("expected }")
+		}
+		pr, err := p.parsePortRange()
+		if err != nil {
+			return nil, err
+		}
+		ps = append(ps, pr)
+		p.accept(",")
+	}
+	if len(ps) == 0 {
+		return nil, p.fail("empty port list")
+	}
+	return ps, nil
+}
+
+// parsePortRange parses a single port item with its optional unary or binary operator
+func (p *ruleParser) parsePortRange() (PortRange, error) {
+	pr := PortRange{Op: PortOpEqual}
+	unaryOps := map[string]PortOp{"=": PortOpEqual, "!=": PortOpNotEqual, "<": PortOpLess,
+		"<=": PortOpLessEqual, ">": PortOpGreater, ">=": PortOpGreaterEqual}
+	if op, ok := unaryOps[p.peek()]; ok {
+		p.next()
+		pr.Op = op
+	}
+	portVal := p.next()
+	if pr.Op == PortOpEqual && strings.Count(portVal, ":") == 1 {
+		rangeArray := strings.SplitN(portVal, ":", 2)
+		pr.Op, pr.From, pr.To = PortOpRange, rangeArray[0], rangeArray[1]
+	} else {
+		pr.From = portVal
+	}
+	if pr.Op == PortOpEqual {
+		switch p.peek() {
+		case "><":
+			pr.Op = PortOpExclusiveRange
+		case "<>":
+			pr.Op = PortOpExceptRange
+		}
+		if pr.Op != PortOpEqual {
+			p.next()
+			pr.To = p.next()
+		}
+	}
+	if err := pr.Validate(); err != nil {
+		return pr, p.failToken(portVal, err.Error())
+	}
+	return pr, nil
+}
+
+// parseOptions parses the filter options following the source and destination part of the rule
+func (p *ruleParser) parseOptions() error {
+	for p.peek() != "" {
+		t := p.peek()
+		switch t {
+		case "flags":
+			p.next()
+			if err := p.parseFlags(); err != nil {
+				return err
+			}
+		case "no", "keep", "modulate", "synproxy":
+			if err := p.parseState(); err != nil {
+				return err
+			}
+		case "label":
+			p.next()
+			if p.peek() == "" {
+				return p.fail("expected label")
+			}
+			p.rule.Label = p.next()
+		case "tag":
+			p.next()
+			tag := p.next()
+			if err := validateTag(tag); err != nil {
+				return p.failToken(tag, err.Error())
+			}
+			p.rule.Tag = tag
+		case "!", "tagged":
+			p.rule.NotTagged = p.accept("!")
+			if !p.accept("tagged") {
+				return p.fail("expected tagged")
+			}
+			tag := p.next()
+			if err := validateTag(tag); err != nil {
+				return p.failToken(tag, err.Error())
+			}
+			p.rule.Tagged = tag
+		case "{":
+			return p.unsupported("inline anchor blocks are not supported")
+		default:
+			return p.unsupported("unsupported rule option")
+		}
+	}
+	return nil
+}
+
+// parseTranslation parses a nat, rdr or binat rule
+func (p *ruleParser) parseTranslation() (TranslationRule, error) {
+	t := translation{no: p.accept("no")}
+	t.kind = p.next()
+	switch t.kind {
+	case "nat", "rdr", "binat":
+	case "":
+		return nil, p.fail("empty rule")
+	case "nat-anchor", "rdr-anchor", "binat-anchor":
+		return nil, p.failTokenUnsupported(t.kind, fmt.Sprintf("%s rules are not supported", t.kind))
+	default:
+		return nil, p.failToken(t.kind, "expected nat, rdr or binat")
+	}
+	t.pass = p.accept("pass")
+	if err := p.parseLog(); err != nil {
+		return nil, err
+	}
+	if err := p.parseInterface(); err != nil {
+		return nil, err
+	}
+	if p.accept("inet") {
+		p.rule.AdressFamily = "inet"
+	} else if p.accept("inet6") {
+		p.rule.AdressFamily = "inet6"
+	}
+	if err := p.parseProto(); err != nil {
+		return nil, err
+	}
+	if err := p.parseFromTo(); err != nil {
+		return nil, err
+	}
+	if p.accept("tag") {
+		t.tag = p.next()
+		if err := validateTag(t.tag); err != nil {
+			return nil, p.failToken(t.tag, err.Error())
+		}
+	}
+	if p.accept("->") {
+		if err := p.parseTranslationTarget(&t); err != nil {
+			return nil, err
+		}
+	}
+	if p.peek() != "" {
+		return nil, p.unsupported("unsupported translation option")
+	}
+
+	m := p.rule
+	switch t.kind {
+	case "nat":
+		return NatRule{No: t.no, Pass: t.pass, Log: m.Log, LogOpts: m.LogOpts, Interface: m.Interface,
+			AdressFamily: m.AdressFamily, Protocol: m.Protocol, Source: m.SourceAddrs, SourcePort: m.SourcePorts,
+			Destination: m.DestAddrs, DestPort: m.DestPorts, Tag: t.tag, Target: t.target,
+			TargetPort: t.targetPort, Pool: t.pool, StaticPort: t.staticPort}, nil
+	case "rdr":
+		return RdrRule{No: t.no, Pass: t.pass, Log: m.Log, LogOpts: m.LogOpts, Interface: m.Interface,
+			AdressFamily: m.AdressFamily, Protocol: m.Protocol, Source: m.SourceAddrs, SourcePort: m.SourcePorts,
+			Destination: m.DestAddrs, DestPort: m.DestPorts, Tag: t.tag, Target: t.target,
+			TargetPort: t.targetPort, Pool: t.pool}, nil
+	default:
+		if len(m.SourcePorts) > 0 || len(m.DestPorts) > 0 {
+			return nil, p.failToken(t.kind, "binat rules do not take ports")
+		}
+		return BinatRule{No: t.no, Pass: t.pass, Log: m.Log, LogOpts: m.LogOpts, Interface: m.Interface,
+			AdressFamily: m.AdressFamily, Protocol: m.Protocol, Source: m.SourceAddrs,
+			Destination: m.DestAddrs, Tag: t.tag, Target: t.target}, nil
+	}
+}
+
+// parseTranslationTarget parses the target address pool, port and pool options following the ->
+func (p *ruleParser) parseTranslationTarget(t *translation) error {
+	target, err := p.parseEndpoint()
+	if err != nil {
+		return err
+	}
+	if len(target) == 0 {
+		return p.fail("expected target address")
+	}
+	t.target = target
+	if p.accept("port") {
+		portVal := p.next()
+		pr := PortRange{Op: PortOpEqual, From: portVal}
+		if rangeArray := strings.SplitN(portVal, ":", 2); len(rangeArray) == 2 {
+			pr = PortRange{Op: PortOpRange, From: rangeArray[0], To: rangeArray[1]}
+		}
+		if err := validateTargetPort(pr, t.kind == "rdr"); err != nil {
+			return p.failToken(portVal, err.Error())
+		}
+		t.targetPort = pr
+	}
+	pool, err := p.parsePoolOptions()
+	if err != nil {
+		return err
+	}
+	t.pool = pool
+	if t.kind == "nat" {
+		t.staticPort = p.accept("static-port")
+	}
+	return nil
+}
+
+// parsePoolOptions parses the optional pool type and sticky-address of an address pool
+func (p *ruleParser) parsePoolOptions() (PoolOptions, error) {
+	po := PoolOptions{}
+	switch p.peek() {
+	case "bitmask":
+		po.Type = PoolBitmask
+	case "random":
+		po.Type = PoolRandom
+	case "source-hash":
+		po.Type = PoolSourceHash
+	case "round-robin":
+		po.Type = PoolRoundRobin
+	}
+	if po.Type != PoolDefault {
+		p.next()
+	}
+	if po.Type == PoolSourceHash {
+		switch key := p.peek(); {
+		case strings.HasPrefix(key, "0x"):
+			po.HashKey = p.next()
+		case strings.HasPrefix(key, "\""):
+			return po, p.unsupported("string keys for source-hash are not supported")
+		}
+	}
+	po.StickyAddress = p.accept("sticky-address")
+	if err := po.Validate(); err != nil {
+		return po, p.fail(err.Error())
+	}
+	return po, nil
+}
+
+// parseFlags parses the TCP flags following the flags keyword
+func (p *ruleParser) parseFlags() error {
+	flags := p.next()
+	tf := parseTCPFlags(flags)
+	if tf.isZero() {
+		return p.failToken(flags, "expected flags")
+	}
+	if err := tf.Validate(); err != nil {
+		return p.failToken(flags, err.Error())
+	}
+	p.rule.setFlags(tf)
+	return nil
+}
+
+// parseState parses a state keyword (i. e. keep state) and its optional state options
+func (p *ruleParser) parseState() error {
+	t := p.next()
+	if !p.accept("state") {
+		return p.fail("expected state")
+	}
+	mode, ok := map[string]StateMode{"no": StateNone, "keep": StateKeep, "modulate": StateModulate,
+		"synproxy": StateSynproxy}[t]
+	if !ok {
+		return p.failToken(t, "expected state")
+	}
+	p.rule.StateMode = mode
+	if mode != StateNone && p.accept("(") {
+		if err := p.parseStateOptions(); err != nil {
+			return err
+		}
+	}
+	p.rule.setState(p.rule.StateMode, p.rule.StateOpts)
+	return nil
+}
+
+// parseStateOptions parses the comma separated state options following the opening parenthesis
+func (p *ruleParser) parseStateOptions() error {
+	so := &p.rule.StateOpts
+	for {
+		opt := p.next()
+		var err error
+		switch opt {
+		case "max":
+			so.Max, err = p.parseUint32()
+		case "no-sync":
+			so.NoSync = true
+		case "source-track":
+			so.SourceTrack = "rule"
+			if p.peek() == "rule" || p.peek() == "global" {
+				so.SourceTrack = p.next()
+			}
+		case "max-src-states":
+			so.MaxSrcStates, err = p.parseUint32()
+		case "max-src-conn":
+			so.MaxSrcConn, err = p.parseUint32()
+		case "max-src-conn-rate":
+			rate := p.next()
+			if _, scanErr := fmt.Sscanf(rate, "%d/%d", &so.MaxSrcConnRate.Conns,
+				&so.MaxSrcConnRate.Seconds); scanErr != nil || strings.Count(rate, "/") != 1 {
+				return p.failToken(rate, "expected connection rate")
+			}
+		case "max-src-nodes":
+			so.MaxSrcNodes, err = p.parseUint32()
+		case "overload":
+			tableRef := p.next()
+			if !strings.HasPrefix(tableRef, "<") {
+				return p.failToken(tableRef, "expected overload table")
+			}
+			so.Overload = strings.TrimSuffix(strings.TrimPrefix(tableRef, "<"), ">")
+			if p.accept("flush") {
+				so.OverloadFlush = true
+				so.OverloadFlushGlobal = p.accept("global")
+			}
+		case "if-bound", "floating":
+			so.Binding = opt
+		case "sloppy":
+			so.Sloppy = true
+		case "pflow", "allow-related":
+			return p.failTokenUnsupported(opt, "unsupported state option")
+		default:
+			if !isStateTimeout(opt) {
+				return p.failToken(opt, "unknown state option")
+			}
+			st := StateTimeout{Name: opt}
+			st.Seconds, err = p.parseUint32()
+			so.Timeouts = append(so.Timeouts, st)
+		}
+		if err != nil {
+			return err
+		}
+		if p.accept(")") {
+			break
+		}
+		if !p.accept(",") {
+			return p.fail("expected , or )")
+		}
+	}
+	if err := so.Validate(); err != nil {
+		return p.fail(err.Error())
+	}
+	return nil
+}
+
+// parseUint32 parses the current token as unsigned 32 bit integer
+func (p *ruleParser) parseUint32() (uint32, error) {
+	t := p.next()
+	n, err := strconv.ParseUint(t, 10, 32)
+	if err != nil {
+		return 0, p.failToken(t, "expected number")
+	}
+	return uint32(n), nil
+}
+
+// peek returns the value of the current token without consuming it
+func (p *ruleParser) peek() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	if p.tokens[p.pos].quoted {
+		return "\"" + p.tokens[p.pos].val
+	}
+	return p.tokens[p.pos].val
+}
+
+// nextToken consumes and returns the current token
+func (p *ruleParser) nextToken() token {
+	if p.pos >= len(p.tokens) {
+		return token{}
+	}
+	p.pos++
+	return p.tokens[p.pos-1]
+}
+
+// next consumes and returns the value of the current token
+func (p *ruleParser) next() string {
+	return p.nextToken().val
+}
+
+// accept consumes the current token if it matches the given unquoted value
+func (p *ruleParser) accept(s string) bool {
+	if p.pos < len(p.tokens) && !p.tokens[p.pos].quoted && p.tokens[p.pos].val == s {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// current returns the value of the current token for error messages
+func (p *ruleParser) current() string {
+	if p.pos >= len(p.tokens) {
+		if len(p.tokens) > 0 {
+			return p.tokens[len(p.tokens)-1].val
+		}
+		return ""
+	}
+	return p.tokens[p.pos].val
+}
+
+// fail returns a ParseError for the current token
+func (p *ruleParser) fail(m string) error {
+	return p.failToken(p.current(), m)
+}
+
+// failToken returns a ParseError for the given, already consumed token
+func (p *ruleParser) failToken(t, m string) error {
+	return &ParseError{Rule: p.input, Token: t, Message: m}
+}
+
+// unsupported returns a ParseError that wraps ErrUnsupported for the current token
+func (p *ruleParser) unsupported(m string) error {
+	return p.failTokenUnsupported(p.current(), m)
+}
+
+// failTokenUnsupported returns a ParseError that wraps ErrUnsupported for the given, already
+// consumed token
+func (p *ruleParser) failTokenUnsupported(t, m string) error {
+	return &ParseError{Rule: p.input, Token: t, Message: m, Err: ErrUnsupported}
+}
+
+// isIdentifier returns true if the given string is a valid pf identifier (i. e. an interface name)
+func isIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if !(c == '_' || c == '-' || c == '.' || c == ':' || (c >= 'a' && c <= 'z') ||
+			(c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')) {
+			return false
+		}
+	}
+	return true
+}
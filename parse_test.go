@@ -0,0 +1,246 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package pf
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/wneessen/go-pf/pftest"
+)
+
+// TestParseRule tests the parsing of single rules into Rule values
+func TestParseRule(t *testing.T) {
+	testTable := []struct {
+		testName   string
+		rule       string
+		want       string
+		shouldFail bool
+	}{
+		{"Pass all", "pass all", "pass from any to any", false},
+		{"Block in log", "block in log on em0 all", "block in log on em0 from any to any", false},
+		{"Log options", "block in log (all, to pflog1) quick on em0 all",
+			"block in log (all, to pflog1) quick on em0 from any to any", false},
+		{"Quick with proto and port", "pass in quick on em0 inet proto tcp from any to 192.0.2.1 port = ssh flags S/SA keep state",
+			"pass in quick on em0 inet proto tcp from any to 192.0.2.1/32 port ssh flags S/SA keep state", false},
+		{"Source port", "pass out proto udp from 10.0.0.0/8 port 53 to any",
+			"pass out inet proto udp from 10.0.0.0/8 port 53 to any", false},
+		{"IPv6", "pass in on em0 proto tcp from any to 2001:db8::1 port = https",
+			"pass in on em0 inet6 proto tcp from any to 2001:db8::1/128 port https", false},
+		{"Port range", "pass in proto tcp to port 8000:8100", "pass in proto tcp from any to any port 8000:8100", false},
+		{"Port list", "pass in proto tcp to port { 80, 443 ssh }",
+			"pass in proto tcp from any to any port { 80 443 ssh }", false},
+		{"Port operators", "pass in proto udp from port > 1024 to port != 53",
+			"pass in proto udp from any port > 1024 to any port != 53", false},
+		{"Binary port operators", "pass in proto tcp to port 6000 >< 6010",
+			"pass in proto tcp from any to any port 6000 >< 6010", false},
+		{"Port without tcp/udp", "pass in proto icmp to port 80", "", true},
+		{"Invalid port range", "pass in proto tcp to port 8100:8000", "", true},
+		{"Mixed address families", "pass from 192.0.2.1 to 2001:db8::1", "", true},
+		{"Address family mismatch", "pass inet6 from 192.0.2.1 to any", "", true},
+		{"State options", "pass in proto tcp to port 80 keep state (max 100, source-track rule) label \"web\" tag WEB",
+			"pass in proto tcp from any to any port 80 keep state (max 100, source-track rule) label \"web\" tag WEB", false},
+		{"Stateful options", "pass in proto tcp to port 22 flags S/SA keep state (source-track, max-src-conn 10, " +
+			"max-src-conn-rate 5/30, overload <bruteforce> flush global, if-bound, tcp.established 600)",
+			"pass in proto tcp from any to any port 22 flags S/SA keep state (source-track rule, max-src-conn 10, " +
+				"max-src-conn-rate 5/30, overload <bruteforce> flush global, if-bound, tcp.established 600)", false},
+		{"Synproxy", "pass in proto tcp to port 25 flags any synproxy state",
+			"pass in proto tcp from any to any port 25 flags any synproxy state", false},
+		{"Flags for udp", "pass in proto udp flags S/SA", "", true},
+		{"Invalid flags", "pass in proto tcp flags X/SA", "", true},
+		{"Flag outside mask", "pass in proto tcp flags S/A", "", true},
+		{"Unknown state option", "pass in keep state (foo 1)", "", true},
+		{"Invalid conn rate", "pass in keep state (max-src-conn-rate 5)", "", true},
+		{"Flush without overload", "pass in keep state (max 10 flush)", "", true},
+		{"Block drop", "block drop in log all", "block drop in log from any to any", false},
+		{"Block return-rst", "block return-rst(ttl 64) in proto tcp to port 113",
+			"block return-rst (ttl 64) in proto tcp from any to any port 113", false},
+		{"Block return-icmp", "block return-icmp (port-unr, 4) in proto udp",
+			"block return-icmp (port-unr, 4) in proto udp from any to any", false},
+		{"Block return-icmp6", "block return-icmp6 in inet6", "block return-icmp6 in inet6 from any to any", false},
+		{"Match", "match out on em0 from 10.0.0.0/8 to any", "match out on em0 inet from 10.0.0.0/8 to any", false},
+		{"Antispoof", "antispoof log quick for em0 inet label \"spoof\"",
+			"antispoof log quick for em0 inet label \"spoof\"", false},
+		{"Return-rst for udp", "block return-rst in proto udp", "", true},
+		{"Invalid ttl", "block return-rst (ttl 300) in all", "", true},
+		{"Match with state", "match in all keep state", "", true},
+		{"Antispoof without interface", "antispoof for", "", true},
+		{"Antispoof with proto", "antispoof for em0 flags S/SA", "", true},
+		{"Anchor call", "anchor \"web\" in on em0 proto tcp to port 80",
+			"anchor \"web\" in on em0 proto tcp from any to any port 80", false},
+		{"Wildcard anchor call", "anchor \"blacklistd/*\" all", "anchor \"blacklistd/*\" from any to any", false},
+		{"Unquoted anchor call", "anchor web quick tagged WEB", "anchor \"web\" quick from any to any tagged WEB", false},
+		{"Anchor call with state", "anchor \"web\" in keep state", "", true},
+		{"Anchor call with reserved name", "anchor \"_pf\" all", "", true},
+		{"Anchor call with inner wildcard", "anchor \"a/*/b\" all", "", true},
+		{"Anchor call without name", "anchor in all", "", true},
+		{"Route-to", "pass out on em0 route-to (em1 192.0.2.1) inet from 192.0.2.0/24 to any flags S/SA keep state",
+			"pass out on em0 route-to (em1 192.0.2.1) inet from 192.0.2.0/24 to any flags S/SA keep state", false},
+		{"Route-to pool", "pass in on em2 route-to { (em0 192.0.2.1), (em1 198.51.100.1) } round-robin sticky-address from any to any",
+			"pass in on em2 route-to { (em0 192.0.2.1), (em1 198.51.100.1) } round-robin sticky-address from any to any", false},
+		{"Reply-to interface", "pass in on em1 reply-to em1 proto tcp to port 22",
+			"pass in on em1 reply-to (em1) proto tcp from any to any port 22", false},
+		{"Dup-to", "pass out dup-to (em3) all", "pass out dup-to (em3) from any to any", false},
+		{"Fastroute", "pass in fastroute all", "", true},
+		{"Route-to without direction", "pass route-to (em1 192.0.2.1) all", "", true},
+		{"Route-to on block rule", "block in route-to (em1 192.0.2.1) all", "", true},
+		{"Route-to pool without round-robin", "pass in route-to { (em0 192.0.2.1) (em1 192.0.2.2) } all", "", true},
+		{"Route-to address family mismatch", "pass in route-to (em1 2001:db8::1) inet all", "", true},
+		{"Route-to network gateway", "pass in route-to (em1 192.0.2.0/24) all", "", true},
+		{"Route-to IPv6 network gateway", "pass in route-to (em1 2001:db8::/64) all", "", true},
+		{"Reply-to without state", "pass in reply-to (em1 192.0.2.1) all no state", "", true},
+		{"Tagged", "pass in on em0 all tagged WEB label \"web-$if\"", "pass in on em0 from any to any label \"web-$if\" tagged WEB", false},
+		{"Not tagged", "block out all ! tagged MAIL tag SPAM", "block out from any to any tag SPAM ! tagged MAIL", false},
+		{"Unknown label macro", "pass all label \"$foo\"", "", true},
+		{"Negation without tagged", "pass all ! tag FOO", "", true},
+		{"No state", "pass out proto udp all no state", "pass out proto udp from any to any no state", false},
+		{"Comment", "pass in all # allow everything", "pass in from any to any", false},
+		{"Table", "block in quick from <bruteforce> to any", "block in quick from <bruteforce> to any", false},
+		{"Table with count", "block in from <bruteforce:3> to any", "block in from <bruteforce> to any", false},
+		{"Negation", "block in proto tcp from ! 192.0.2.0/24 to port 22",
+			"block in inet proto tcp from ! 192.0.2.0/24 to any port 22", false},
+		{"Address list", "pass from { 192.0.2.1, ! 198.51.100.0/24 <trusted> } to any",
+			"pass from { 192.0.2.1/32 ! 198.51.100.0/24 <trusted> } to any", false},
+		{"Interface addresses", "pass in on em0 from em0:network to (em0)", "pass in on em0 from em0:network to (em0)", false},
+		{"Dynamic interface modifier", "pass to (em0:0)", "pass from any to (em0:0)", false},
+		{"Special addresses", "block in from urpf-failed to no-route", "block in from urpf-failed to no-route", false},
+		{"Self", "pass in proto tcp to self port 8443", "pass in proto tcp from any to self port 8443", false},
+		{"urpf-failed destination", "block in from any to urpf-failed", "", true},
+		{"Invalid interface modifier", "pass to em0:foo", "", true},
+		{"Empty address list", "pass from { } to any", "", true},
+		{"Empty rule", "", "", true},
+		{"Unknown action", "allow in all", "", true},
+		{"Invalid address", "pass from 300.1.2.3/8 to any", "", true},
+		{"Unknown log option", "pass log (foo) all", "", true},
+		{"Unterminated label", "pass all label \"foo", "", true},
+	}
+	for _, testCase := range testTable {
+		t.Run(testCase.testName, func(t *testing.T) {
+			ar, err := ParseRule(testCase.rule)
+			if err != nil {
+				if !testCase.shouldFail {
+					t.Errorf("ParseRule failed: %s", err)
+				}
+				return
+			}
+			if testCase.shouldFail {
+				t.Errorf("ParseRule was supposed to fail")
+			}
+			if ar.String() != testCase.want {
+				t.Errorf("unexpected rule. Expected: %q, got: %q", testCase.want, ar.String())
+			}
+		})
+	}
+}
+
+// TestParseRule_Corpus tests the parser against a corpus of pfctl -sr output. Every rule must either
+// parse and survive a round-trip through Rule.String() or be reported as unsupported
+func TestParseRule_Corpus(t *testing.T) {
+	corpusFile, err := os.Open("testdata/pfctl-sr.txt")
+	if err != nil {
+		t.Fatalf("failed to open corpus: %s", err)
+	}
+	defer func() { _ = corpusFile.Close() }()
+
+	lineScanner := bufio.NewScanner(corpusFile)
+	for lineScanner.Scan() {
+		l := lineScanner.Text()
+		ar, err := ParseRule(l)
+		if err != nil {
+			if !errors.Is(err, ErrUnsupported) {
+				t.Errorf("ParseRule failed for %q: %s", l, err)
+			}
+			continue
+		}
+		checkRoundTrip(t, ar)
+	}
+}
+
+// TestFirewall_GetRuleSet_Corpus tests that GetRuleSet parses the full pfctl -s rules corpus and
+// reports the unsupported rules instead of failing
+func TestFirewall_GetRuleSet_Corpus(t *testing.T) {
+	corpusData, err := os.ReadFile("testdata/pfctl-sr.txt")
+	if err != nil {
+		t.Fatalf("failed to read corpus: %s", err)
+	}
+	f, r := newTestFirewall(t)
+	r.On(pftest.Response{Stdout: string(corpusData)}, "-s", "rules")
+	rs, err := f.GetRuleSet()
+	if err != nil {
+		t.Fatalf("GetRuleSet failed: %s", err)
+	}
+	lineCount := strings.Count(strings.TrimSpace(string(corpusData)), "\n") + 1
+	if len(rs.Rules)+len(rs.Unsupported) != lineCount {
+		t.Errorf("unexpected number of rules. Expected: %d, got: %d rules and %d unsupported", lineCount,
+			len(rs.Rules), len(rs.Unsupported))
+	}
+	if len(rs.Unsupported) == 0 || rs.Unsupported[0].Line != 1 || rs.Unsupported[0].Rule != "scrub in all fragment reassemble" {
+		t.Errorf("unexpected unsupported rules: %v", rs.Unsupported)
+	}
+	for _, u := range rs.Unsupported {
+		if !errors.Is(u, ErrUnsupported) {
+			t.Errorf("unsupported rule does not wrap ErrUnsupported: %s", u)
+		}
+	}
+}
+
+// TestParseRuleSet tests the parsing of a multi-line ruleset
+func TestParseRuleSet(t *testing.T) {
+	rs, err := ParseRuleSet(strings.NewReader("# comment\n\npass in proto tcp \\\n  to port 22\n" +
+		"scrub in all\nblock all\n"))
+	if err != nil {
+		t.Fatalf("ParseRuleSet failed: %s", err)
+	}
+	if len(rs.Rules) != 2 {
+		t.Errorf("unexpected number of rules. Expected: 2, got: %d", len(rs.Rules))
+	}
+	if len(rs.Unsupported) != 1 || rs.Unsupported[0].Line != 5 {
+		t.Errorf("unexpected unsupported rules: %v", rs.Unsupported)
+	}
+
+	_, err = ParseRuleSet(strings.NewReader("pass all\n\nfoo bar\n"))
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("ParseRuleSet was supposed to return a *ParseError, got: %v", err)
+	}
+	if parseErr.Line != 3 {
+		t.Errorf("unexpected error line. Expected: 3, got: %d", parseErr.Line)
+	}
+}
+
+// FuzzParseRule makes sure that the parser does not panic and that every successfully parsed
+// rule survives a round-trip through Rule.String()
+func FuzzParseRule(f *testing.F) {
+	corpusData, err := os.ReadFile("testdata/pfctl-sr.txt")
+	if err != nil {
+		f.Fatalf("failed to read corpus: %s", err)
+	}
+	for _, l := range strings.Split(string(corpusData), "\n") {
+		f.Add(l)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		ar, err := ParseRule(s)
+		if err != nil {
+			return
+		}
+		checkRoundTrip(t, ar)
+	})
+}
+
+// checkRoundTrip makes sure that the given Rule parses back into the same Rule
+func checkRoundTrip(t *testing.T, ar Rule) {
+	t.Helper()
+	pr, err := ParseRule(ar.String())
+	if err != nil {
+		t.Errorf("ParseRule failed for round-trip of %q: %s", ar.String(), err)
+		return
+	}
+	if !reflect.DeepEqual(ar, pr) {
+		t.Errorf("round-trip mismatch. Expected: %+v, got: %+v", ar, pr)
+	}
+}
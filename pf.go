@@ -1,5 +1,5 @@
-//go:build !windows && !plan9 && !linux
-// +build !windows,!plan9,!linux
+//go:build !windows && !plan9
+// +build !windows,!plan9
 
 package pf
 
@@ -9,8 +9,9 @@ import (
 	"context"
 	"fmt"
 	"github.com/wneessen/go-fileperm"
+	"io"
 	"net"
-	"os/exec"
+	"net/netip"
 	"strconv"
 	"strings"
 	"time"
@@ -37,16 +38,30 @@ const (
 const (
 	ActionPass Action = iota
 	ActionBlock
+	ActionMatch
+	ActionAntispoof
+	ActionAnchor
 	ActionUnknown
 )
 
+// DefaultTimeout is the maximum execution time of a pfctl command if neither the Firewall has a
+// timeout set nor the context of the call carries a deadline
+const DefaultTimeout = time.Second * 2
+
+// DefaultTableChunkSize is the maximum number of addresses that the bulk table operations pass
+// to a single pfctl invocation if the Firewall has no table chunk size set
+const DefaultTableChunkSize = 10000
+
+// maxLineLen is the maximum length of a single line of pfctl output
+const maxLineLen = 1024 * 1024
+
 // Address families
 const (
 	AdressFamilyInet AddrFam = iota
 	AdressFamilyInetv6
 )
 
-// Action represents a action in the pf firewall ruleset (i. e. block or pass)
+// Action represents a action in the pf firewall ruleset (i. e. block, pass, match, antispoof or anchor)
 type Action int
 
 // AddrFam represents an address family in the pf firewall ruleset (i. e. inet or inet6)
@@ -62,6 +77,11 @@ type Protocol int
 type Firewall struct {
 	ControlCmdPath string
 	IoDev          string
+	runner         Runner
+	tableAnchor    string
+	tableChunkSize int
+	tableKill      bool
+	timeout        time.Duration
 }
 
 // NewFirewall returns a new Firewall struct. It returns an error if the current process is not able
@@ -77,16 +97,62 @@ func NewFirewallCustom(c string, i string) (Firewall, error) {
 	return newFwObj(c, i)
 }
 
-// ParseAction converts a given string to a PfAction (if known)
+// NewFirewallWithRunner returns a new Firewall struct that executes all pfctl commands through the
+// given Runner instead of the pfctl binary. No checks on the pfctl binary or the /dev/pf interface
+// are performed, which allows to use the Firewall with a fake Runner (i. e. pftest.Runner) on systems
+// without pf
+func NewFirewallWithRunner(r Runner) (Firewall, error) {
+	if r == nil {
+		return Firewall{}, fmt.Errorf("no runner given")
+	}
+	return Firewall{runner: r}, nil
+}
+
+// ParseAction converts a given string to a PfAction (if known). A block action can be followed by a
+// block policy (i. e. "block return"). ActionUnknown is returned for invalid block policies. Use
+// ParseActionPolicy to get the BlockPolicy as well
 func ParseAction(a string) Action {
-	switch strings.ToLower(a) {
+	ac, _, err := ParseActionPolicy(a)
+	if err != nil {
+		return ActionUnknown
+	}
+	return ac
+}
+
+// ParseActionPolicy converts a given string to a PfAction and the BlockPolicy following a block
+// action (i. e. "block return-rst (ttl 64)"). It returns an error if the action is unknown or the
+// block policy is invalid
+func ParseActionPolicy(a string) (Action, BlockPolicy, error) {
+	actionArray := strings.Fields(a)
+	if len(actionArray) == 0 {
+		return ActionUnknown, BlockPolicy{}, fmt.Errorf("no action given")
+	}
+	var ac Action
+	switch strings.ToLower(actionArray[0]) {
 	case "block":
-		return ActionBlock
+		ac = ActionBlock
 	case "pass":
-		return ActionPass
+		ac = ActionPass
+	case "match":
+		ac = ActionMatch
+	case "antispoof":
+		ac = ActionAntispoof
+	case "anchor":
+		ac = ActionAnchor
 	default:
-		return ActionUnknown
+		return ActionUnknown, BlockPolicy{}, fmt.Errorf("unknown action: %q", actionArray[0])
+	}
+	if len(actionArray) == 1 {
+		return ac, BlockPolicy{}, nil
+	}
+	if ac != ActionBlock {
+		return ActionUnknown, BlockPolicy{}, fmt.Errorf("block policies are only valid for block actions")
 	}
+	bp, err := ParseBlockPolicy(strings.Join(actionArray[1:], " "))
+	if err != nil {
+		return ActionUnknown, BlockPolicy{}, err
+	}
+	return ac, bp, nil
 }
 
 // ParseDirection converts a given string to a PfDirection (if known)
@@ -119,11 +185,17 @@ func ParseProtocol(p string) Protocol {
 
 // Enabled returns true if the packet filter is enabled
 func (f *Firewall) Enabled() bool {
-	statOutput, err := f.execPfCtl("-s", "Running")
+	return f.EnabledContext(context.Background())
+}
+
+// EnabledContext returns true if the packet filter is enabled. The given context is used for the
+// pfctl execution
+func (f *Firewall) EnabledContext(ctx context.Context) bool {
+	statOutput, err := f.execPfCtl(ctx, "-s", "Running")
 	if err != nil {
 		return false
 	}
-	if statOutput[0] == "Enabled" {
+	if len(statOutput) > 0 && statOutput[0] == "Enabled" {
 		return true
 	}
 	return false
@@ -131,10 +203,15 @@ func (f *Firewall) Enabled() bool {
 
 // Enable enables the firewall
 func (f *Firewall) Enable() error {
-	if f.Enabled() {
+	return f.EnableContext(context.Background())
+}
+
+// EnableContext enables the firewall. The given context is used for the pfctl execution
+func (f *Firewall) EnableContext(ctx context.Context) error {
+	if f.EnabledContext(ctx) {
 		return nil
 	}
-	_, err := f.execPfCtl("-e")
+	_, err := f.execPfCtl(ctx, "-e")
 	if err != nil {
 		return err
 	}
@@ -143,28 +220,85 @@ func (f *Firewall) Enable() error {
 
 // Disable disables the firewall
 func (f *Firewall) Disable() error {
-	if !f.Enabled() {
+	return f.DisableContext(context.Background())
+}
+
+// DisableContext disables the firewall. The given context is used for the pfctl execution
+func (f *Firewall) DisableContext(ctx context.Context) error {
+	if !f.EnabledContext(ctx) {
 		return nil
 	}
-	_, err := f.execPfCtl("-d")
+	_, err := f.execPfCtl(ctx, "-d")
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-// CommitAnchor takes all committed RuleSet a given Anchor and commits them as ruleset to the pfctl anchor
+// SetRunner sets the Runner that is used to execute all pfctl commands of the Firewall
+func (f *Firewall) SetRunner(r Runner) {
+	f.runner = r
+}
+
+// SetTimeout sets the default maximum execution time of pfctl commands. It is only applied if the
+// context of a call does not carry a deadline already. A value of 0 resets it to DefaultTimeout
+func (f *Firewall) SetTimeout(t time.Duration) {
+	f.timeout = t
+}
+
+// SetTableChunkSize sets the maximum number of addresses that the bulk table operations pass to a
+// single pfctl invocation. A value of 0 resets it to DefaultTableChunkSize
+func (f *Firewall) SetTableChunkSize(n int) {
+	f.tableChunkSize = n
+}
+
+// SetTableKillStates sets whether all states from and to the addresses added by AddToTableIP,
+// AddToTableCIDR, TableAdd and TableAddPrefixes are killed once the addresses have been added
+// successfully. This way, banned hosts lose their established connections as well. Killing takes two
+// pfctl invocations per network. For bulk additions, the state table is listed first and only the
+// networks with states are killed
+func (f *Firewall) SetTableKillStates(k bool) {
+	f.tableKill = k
+}
+
+// CommitAnchor takes all table definitions, translation rules and committed RuleSet of a given Anchor
+// and commits them as ruleset to the pfctl anchor
 func (f *Firewall) CommitAnchor(a *Anchor) error {
+	return f.CommitAnchorContext(context.Background(), a)
+}
+
+// CommitAnchorContext takes all table definitions, translation rules and committed RuleSet of a given
+// Anchor and commits them as ruleset to the pfctl anchor. The given context is used for the pfctl
+// execution
+func (f *Firewall) CommitAnchorContext(ctx context.Context, a *Anchor) error {
 	var byteBuffer bytes.Buffer
 	var err error
-	ruleSet := a.ruleSet.RulesString() + "\n"
+	if err := validateAnchorName(a.Name, false); err != nil {
+		return err
+	}
+	for i, t := range a.tables {
+		if err := t.Validate(); err != nil {
+			return fmt.Errorf("table %d of anchor %s is invalid: %w", i, a.Name, err)
+		}
+	}
+	for i, r := range a.transRules {
+		if err := r.Validate(); err != nil {
+			return fmt.Errorf("translation rule %d of anchor %s is invalid: %w", i, a.Name, err)
+		}
+	}
+	for i, r := range a.ruleSet.Rules {
+		if err := r.Validate(); err != nil {
+			return fmt.Errorf("rule %d of anchor %s is invalid: %w", i, a.Name, err)
+		}
+	}
+	ruleSet := a.RulesString() + "\n"
 
 	_, err = byteBuffer.Write([]byte(ruleSet))
 	if err != nil {
 		return err
 	}
 
-	_, err = f.execPfCtlStdin(byteBuffer, "-a", a.Name, "-f", "-", "-v")
+	_, err = f.execPfCtlStdin(ctx, byteBuffer, "-a", a.Name, "-f", "-", "-v")
 	if err != nil {
 		return err
 	}
@@ -172,16 +306,61 @@ func (f *Firewall) CommitAnchor(a *Anchor) error {
 	return nil
 }
 
-// FlushAnchor flushes all rules of a given Anchor
-func (f *Firewall) FlushAnchor(a *Anchor) error {
-	_, err := f.execPfCtl("-a", a.Name, "-F", "rules")
-	if err != nil {
+// CommitAnchorRecursive commits the given Anchor and all of its child anchors
+func (f *Firewall) CommitAnchorRecursive(a *Anchor) error {
+	return f.CommitAnchorRecursiveContext(context.Background(), a)
+}
+
+// CommitAnchorRecursiveContext commits the given Anchor and all of its child anchors. The given
+// context is used for the pfctl executions. Each anchor is loaded by its own pfctl invocation,
+// parents before their children. The first failing anchor stops the commit
+func (f *Firewall) CommitAnchorRecursiveContext(ctx context.Context, a *Anchor) error {
+	if err := f.CommitAnchorContext(ctx, a); err != nil {
 		return err
 	}
-
+	for _, c := range a.children {
+		if err := f.CommitAnchorRecursiveContext(ctx, c); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// Anchors returns the full names of the anchors directly below the given anchor path. An empty path
+// returns the anchors of the main ruleset
+func (f *Firewall) Anchors(p string) ([]string, error) {
+	return f.AnchorsContext(context.Background(), p)
+}
+
+// AnchorsContext returns the full names of the anchors directly below the given anchor path. The
+// given context is used for the pfctl execution
+func (f *Firewall) AnchorsContext(ctx context.Context, p string) ([]string, error) {
+	return f.listAnchors(ctx, p, false)
+}
+
+// listAnchors returns the full names of the anchors below the given anchor path. If r is set, the
+// anchors are listed recursively, including the reserved anchors beginning with _
+func (f *Firewall) listAnchors(ctx context.Context, p string, r bool) ([]string, error) {
+	argArray := []string{"-s", "Anchors"}
+	if r {
+		argArray = append([]string{"-v"}, argArray...)
+	}
+	if p != "" {
+		argArray = append([]string{"-a", p}, argArray...)
+	}
+	anchorOutput, err := f.execPfCtl(ctx, argArray...)
+	if err != nil {
+		return nil, err
+	}
+	anchorArray := make([]string, 0, len(anchorOutput))
+	for _, l := range anchorOutput {
+		if n := strings.TrimSpace(l); n != "" {
+			anchorArray = append(anchorArray, n)
+		}
+	}
+	return anchorArray, nil
+}
+
 // newFwObj returns a new Firewall struct. It pre-fills the object with required data and takes
 // a optional argument strings for the path to a non-default pfctl binary and/or /dev/pf path. It returns
 // an error if the current process is not able to execute the pfctl binary or is not able to read/write the
@@ -196,6 +375,7 @@ func newFwObj(c string, i string) (Firewall, error) {
 	fwObj := Firewall{
 		ControlCmdPath: c,
 		IoDev:          i,
+		runner:         NewExecRunner(c),
 	}
 
 	// Validate that ControlCmdPath and IoDev is working and permissions are given
@@ -219,142 +399,202 @@ func newFwObj(c string, i string) (Firewall, error) {
 
 // execPfCtl executes the pfctl command with a given list of arguments and returns
 // a string array with the output or an error if the execution failed
-func (f *Firewall) execPfCtl(a ...string) ([]string, error) {
-	stdoutArray := make([]string, 0)
+func (f *Firewall) execPfCtl(ctx context.Context, a ...string) ([]string, error) {
+	stdoutArray, _, err := f.runPfCtl(ctx, nil, true, a...)
+	return stdoutArray, err
+}
 
-	// Let's limit the execution time
-	execCtx, cancelFunc := context.WithTimeout(context.Background(), time.Second*2)
-	defer cancelFunc()
+// execPfCtlStdin executes the pfctl command with a given list of arguments and pipes a given
+// byte buffer to it as Stdin. It returns a string array with the output or an error if the
+// execution failed
+func (f *Firewall) execPfCtlStdin(ctx context.Context, si bytes.Buffer, a ...string) ([]string, error) {
+	stdoutArray, _, err := f.runPfCtl(ctx, &si, true, a...)
+	return stdoutArray, err
+}
 
-	// Initialize the execution
-	execCmd := exec.CommandContext(execCtx, f.ControlCmdPath)
-	execCmd.Args = append(execCmd.Args, "-q")
-	execCmd.Args = append(execCmd.Args, a...)
+// execPfCtlSummary executes the pfctl command with a given list of arguments and an optional Stdin
+// without the quiet flag, so that pfctl reports its summary messages (i. e. "killed 2 states") on
+// stderr. It returns the stdout and stderr output as string arrays or an error if the execution failed
+func (f *Firewall) execPfCtlSummary(ctx context.Context, si io.Reader, a ...string) ([]string, []string, error) {
+	return f.runPfCtl(ctx, si, false, a...)
+}
 
-	// Let's also read stderr
-	var errBuf bytes.Buffer
-	execCmd.Stderr = &errBuf
+// runPfCtl hands the pfctl invocation to the Runner of the Firewall and splits the stdout and stderr
+// of the command into lines. A failed execution or a non-zero exit code is returned as *PfctlError.
+// If the given context carries no deadline, the execution time is limited by the Firewall timeout
+func (f *Firewall) runPfCtl(ctx context.Context, si io.Reader, q bool, a ...string) ([]string, []string, error) {
+	// Let's limit the execution time
+	execCtx, cancelFunc := f.execContext(ctx)
+	defer cancelFunc()
 
-	// Stdout shall be piped to bufio
-	stdOutPipe, err := execCmd.StdoutPipe()
-	if err != nil {
-		return stdoutArray, err
+	args := a
+	if q {
+		args = append([]string{"-q"}, a...)
 	}
-	stdOutScanner := bufio.NewScanner(stdOutPipe)
-
-	// Start the execution
-	if err := execCmd.Start(); err != nil {
-		return stdoutArray, err
+	stdOut, stdErr, exitCode, err := f.getRunner().Run(execCtx, args, si)
+	stdoutArray, splitErr := splitLines(stdOut)
+	stderrArray, stderrSplitErr := splitLines(stdErr)
+	if splitErr == nil {
+		splitErr = stderrSplitErr
 	}
-
-	// Read the stdout buffer
-	for stdOutScanner.Scan() {
-		stdoutArray = append(stdoutArray, stdOutScanner.Text())
+	if err == nil && splitErr != nil {
+		err = fmt.Errorf("failed to read pfctl output: %w", splitErr)
 	}
-	if err := stdOutScanner.Err(); err != nil {
-		return stdoutArray, err
+	if err != nil {
+		return stdoutArray, stderrArray, newPfctlError(args, exitCode, stdErr, err)
 	}
-
-	// Wait for completion or cancellation
-	if err := execCmd.Wait(); err != nil {
-		return stdoutArray, fmt.Errorf("command execution failed: %s => %s", err.Error(), errBuf.String())
+	if exitCode != 0 {
+		return stdoutArray, stderrArray, newPfctlError(args, exitCode, stdErr, nil)
 	}
 
-	return stdoutArray, nil
+	return stdoutArray, stderrArray, nil
 }
 
-// execPfCtlStdin executes the pfctl command with a given list of arguments and pipes a given
-// byte buffer to it as Stdin. It returns a string array with the output or an error if the
-// execution failed
-func (f *Firewall) execPfCtlStdin(si bytes.Buffer, a ...string) ([]string, error) {
-	stdoutArray := make([]string, 0)
-
-	// Let's limit the execution time
-	execCtx, cancelFunc := context.WithTimeout(context.Background(), time.Second*2)
-	defer cancelFunc()
-
-	// Initialize the execution
-	execCmd := exec.CommandContext(execCtx, f.ControlCmdPath)
-	execCmd.Args = append(execCmd.Args, "-q")
-	execCmd.Args = append(execCmd.Args, a...)
-
-	// Let's also read stderr
-	var errBuf bytes.Buffer
-	execCmd.Stderr = &errBuf
+// execContext returns the context for a pfctl execution. If the given context has no deadline,
+// the Firewall timeout (or DefaultTimeout) is applied
+func (f *Firewall) execContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if _, ok := ctx.Deadline(); ok {
+		return context.WithCancel(ctx)
+	}
+	t := f.timeout
+	if t <= 0 {
+		t = DefaultTimeout
+	}
+	return context.WithTimeout(ctx, t)
+}
 
-	// Stdout shall be piped to bufio
-	stdOutPipe, err := execCmd.StdoutPipe()
-	if err != nil {
-		return stdoutArray, err
+// getRunner returns the Runner of the Firewall. If no Runner has been set, an ExecRunner for the
+// configured ControlCmdPath is returned
+func (f *Firewall) getRunner() Runner {
+	if f.runner == nil {
+		return NewExecRunner(f.ControlCmdPath)
 	}
-	stdOutScanner := bufio.NewScanner(stdOutPipe)
+	return f.runner
+}
 
-	// Stdin shall be piped with si
-	stdinPipe, err := execCmd.StdinPipe()
-	if err != nil {
-		return stdoutArray, err
+// splitLines splits the given command output into a string array of lines. It returns an error if
+// the output cannot be split completely (i. e. a line exceeds maxLineLen)
+func splitLines(o []byte) ([]string, error) {
+	lineArray := make([]string, 0)
+	lineScanner := bufio.NewScanner(bytes.NewReader(o))
+	lineScanner.Buffer(make([]byte, 0, 64*1024), maxLineLen)
+	for lineScanner.Scan() {
+		lineArray = append(lineArray, lineScanner.Text())
 	}
+	if err := lineScanner.Err(); err != nil {
+		return lineArray, err
+	}
+	return lineArray, nil
+}
 
-	// Start the execution
-	if err := execCmd.Start(); err != nil {
-		return stdoutArray, err
+// fullNetmaskToBytes converts a full netmask, either as IPv4 4-tuple (255.255.255.0) or as
+// IPv6 address notation (ffff:ffff:ffff:ffff::), into an IPMask of the corresponding length
+func fullNetmaskToBytes(m string) (net.IPMask, error) {
+	maskAddr := net.ParseIP(m)
+	if maskAddr == nil {
+		return net.IPMask{}, fmt.Errorf("netmask conversion failed")
 	}
+	ipMask := net.IPMask(maskAddr.To16())
+	if mask4 := maskAddr.To4(); mask4 != nil && strings.Contains(m, ".") {
+		ipMask = net.IPMask(mask4)
+	}
+	if _, bits := ipMask.Size(); bits == 0 {
+		return net.IPMask{}, fmt.Errorf("netmask conversion failed: non-contiguous netmask")
+	}
+	return ipMask, nil
+}
 
-	// Write to stdin and close it
-	_, err = stdinPipe.Write(si.Bytes())
+// parseIP parses a given IP address with an optional netmask. The netmask can be given as full
+// netmask or as prefix length. Without a netmask, the IP is parsed as host address with a /32
+// (IPv4) or /128 (IPv6) netmask. It returns an error if the IP or the netmask is invalid or if the
+// netmask does not match the address family of the IP
+func parseIP(i string, m []string) (*net.IPNet, error) {
+	ipAddr := net.ParseIP(i)
+	if ipAddr == nil {
+		return nil, fmt.Errorf("invalid IP address: %q", i)
+	}
+	bits := net.IPv6len * 8
+	if ip4 := ipAddr.To4(); ip4 != nil {
+		ipAddr = ip4
+		bits = net.IPv4len * 8
+	}
+	switch {
+	case len(m) == 0:
+		return &net.IPNet{IP: ipAddr, Mask: net.CIDRMask(bits, bits)}, nil
+	case len(m) > 1:
+		return nil, fmt.Errorf("more than one netmask given for IP address %s", i)
+	}
+	if !strings.ContainsAny(m[0], ".:") {
+		prefixLen, err := strconv.Atoi(m[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid prefix length %q for IP address %s", m[0], i)
+		}
+		if prefixLen < 0 || prefixLen > bits {
+			return nil, fmt.Errorf("prefix length %d is out of range for IP address %s", prefixLen, i)
+		}
+		return &net.IPNet{IP: ipAddr, Mask: net.CIDRMask(prefixLen, bits)}, nil
+	}
+	ipMask, err := fullNetmaskToBytes(m[0])
 	if err != nil {
-		return stdoutArray, err
+		return nil, fmt.Errorf("invalid netmask %q for IP address %s: %w", m[0], i, err)
 	}
-	if err := stdinPipe.Close(); err != nil {
-		return stdoutArray, err
+	if len(ipMask)*8 != bits {
+		return nil, fmt.Errorf("netmask %s does not match the address family of IP address %s", m[0], i)
 	}
+	return &net.IPNet{IP: ipAddr, Mask: ipMask}, nil
+}
 
-	// Read the stdout buffer
-	for stdOutScanner.Scan() {
-		stdoutArray = append(stdoutArray, stdOutScanner.Text())
+// ipFamily returns the pf address family keyword (inet or inet6) of the given IPNet
+func ipFamily(n *net.IPNet) string {
+	if n == nil || n.IP == nil {
+		return ""
 	}
-	if err := stdOutScanner.Err(); err != nil {
-		return stdoutArray, err
+	if n.IP.To4() != nil {
+		return "inet"
 	}
+	return "inet6"
+}
 
-	// Wait for completion or cancellation
-	if err := execCmd.Wait(); err != nil {
-		return stdoutArray, fmt.Errorf("command execution failed: %s => %s", err.Error(), errBuf.String())
+// prefixToIPNet converts the given prefix into an IPNet. IPv4-mapped IPv6 addresses are unmapped
+func prefixToIPNet(p netip.Prefix) (*net.IPNet, error) {
+	if !p.IsValid() {
+		return nil, fmt.Errorf("invalid prefix")
 	}
-
-	return stdoutArray, nil
+	p, err := unmapPrefix(p)
+	if err != nil {
+		return nil, err
+	}
+	addr := p.Addr()
+	return &net.IPNet{IP: net.IP(addr.AsSlice()), Mask: net.CIDRMask(p.Bits(), addr.BitLen())}, nil
 }
 
-// fullNetmaskToBytes converts a full 4-tuple netmask into CIDR notation
-func fullNetmaskToBytes(m string) (net.IPMask, error) {
-	tBytes := make([]byte, 0)
-	tupArray := strings.SplitN(m, ".", 4)
-	for _, s := range tupArray {
-		tInt, err := strconv.ParseInt(s, 10, 32)
-		if err != nil {
-			return net.IPMask{}, err
-		}
-		if tInt >= 0 && tInt <= 255 {
-			tBytes = append(tBytes, byte(tInt))
-		}
+// unmapPrefix returns the IPv4 prefix of the given IPv4-mapped IPv6 prefix (i. e. 192.0.2.0/24 for
+// ::ffff:192.0.2.0/120). All other prefixes are returned unchanged
+func unmapPrefix(p netip.Prefix) (netip.Prefix, error) {
+	if !p.Addr().Is4In6() {
+		return p, nil
+	}
+	if p.Bits() < 96 {
+		return netip.Prefix{}, fmt.Errorf("invalid prefix length for IPv4-mapped address: %s", p)
 	}
+	return netip.PrefixFrom(p.Addr().Unmap(), p.Bits()-96), nil
+}
 
-	if len(tBytes) == 4 {
-		ipMask := net.IPv4Mask(tBytes[0], tBytes[1], tBytes[2], tBytes[3])
-		return ipMask, nil
+// anyNetwork returns the network that matches all addresses of the address family of the given IP
+func anyNetwork(i net.IP) *net.IPNet {
+	if i.To4() != nil {
+		return &net.IPNet{IP: net.IPv4zero.To4(), Mask: net.CIDRMask(0, 32)}
 	}
-	return net.IPMask{}, fmt.Errorf("netmask conversion failed")
+	return &net.IPNet{IP: net.IPv6zero, Mask: net.CIDRMask(0, 128)}
 }
 
-// parseIP parses a given IP address with an optional netmask
-func parseIP(i string, m []string) *net.IPNet {
-	ipAddr := net.ParseIP(i)
-	netMask := net.IPv4Mask(255, 255, 255, 255)
-	if len(m) == 1 {
-		ipMask, err := fullNetmaskToBytes(m[0])
-		if err == nil {
-			netMask = ipMask
-		}
+// hostNetwork returns the network that only contains the given IP
+func hostNetwork(i net.IP) *net.IPNet {
+	if ip4 := i.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}
 	}
-	return &net.IPNet{IP: ipAddr, Mask: netMask}
+	return &net.IPNet{IP: i, Mask: net.CIDRMask(128, 128)}
 }
@@ -1,3 +1,4 @@
+//go:build !windows && !plan9 && !linux
 // +build !windows,!plan9,!linux
 
 package pf
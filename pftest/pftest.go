@@ -0,0 +1,141 @@
+// Package pftest provides a scriptable in-memory fake of the pfctl command, which can be used
+// as pf.Runner to unit-test code built on top of go-pf on systems without pf
+package pftest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Call represents a single pfctl invocation that has been recorded by the Runner
+type Call struct {
+	Args  []string
+	Stdin []byte
+}
+
+// Response is a scripted answer the Runner returns for a matching pfctl invocation
+type Response struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+	Err      error
+	Delay    time.Duration
+}
+
+// HandlerFunc is a function that dynamically answers a pfctl invocation. It returns false if
+// it is not responsible for the given Call
+type HandlerFunc func(c Call) (Response, bool)
+
+// Runner is a fake pfctl implementation that satisfies the pf.Runner interface. Responses
+// are scripted with On or Handle and all invocations are recorded for later inspection
+type Runner struct {
+	// Fallback is returned for all invocations that match no scripted Response
+	Fallback Response
+
+	mu       sync.Mutex
+	handlers []HandlerFunc
+	calls    []Call
+}
+
+// NewRunner returns a new Runner that answers all unscripted invocations with an empty output
+// and exit code 0
+func NewRunner() *Runner {
+	return &Runner{}
+}
+
+// On scripts the Response for all invocations with the given arguments. The "-q" flag that the
+// Firewall adds to all pfctl invocations is ignored when matching. Later scripts take precedence
+// over earlier ones
+func (r *Runner) On(res Response, args ...string) {
+	want := strings.Join(args, " ")
+	r.Handle(func(c Call) (Response, bool) {
+		if strings.Join(stripQuiet(c.Args), " ") == want {
+			return res, true
+		}
+		return Response{}, false
+	})
+}
+
+// Handle registers a HandlerFunc that dynamically answers invocations. Later handlers take
+// precedence over earlier ones
+func (r *Runner) Handle(h HandlerFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handlers = append(r.handlers, h)
+}
+
+// Run records the invocation and returns the scripted Response. It satisfies the pf.Runner interface
+func (r *Runner) Run(ctx context.Context, args []string, stdin io.Reader) ([]byte, []byte, int, error) {
+	c := Call{Args: append([]string{}, args...)}
+	if stdin != nil {
+		stdinBytes, err := io.ReadAll(stdin)
+		if err != nil {
+			return nil, nil, -1, fmt.Errorf("failed to read stdin: %w", err)
+		}
+		c.Stdin = stdinBytes
+	}
+
+	r.mu.Lock()
+	r.calls = append(r.calls, c)
+	res := r.Fallback
+	for i := len(r.handlers) - 1; i >= 0; i-- {
+		if hr, ok := r.handlers[i](c); ok {
+			res = hr
+			break
+		}
+	}
+	r.mu.Unlock()
+
+	if res.Delay > 0 {
+		delayTimer := time.NewTimer(res.Delay)
+		defer delayTimer.Stop()
+		select {
+		case <-ctx.Done():
+			return nil, nil, -1, ctx.Err()
+		case <-delayTimer.C:
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, nil, -1, err
+	}
+
+	return []byte(res.Stdout), []byte(res.Stderr), res.ExitCode, res.Err
+}
+
+// Calls returns a copy of all invocations recorded by the Runner
+func (r *Runner) Calls() []Call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Call{}, r.calls...)
+}
+
+// LastCall returns the most recent invocation recorded by the Runner. It returns false if no
+// invocation has been recorded yet
+func (r *Runner) LastCall() (Call, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.calls) == 0 {
+		return Call{}, false
+	}
+	return r.calls[len(r.calls)-1], true
+}
+
+// Reset removes all scripted responses and recorded invocations
+func (r *Runner) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handlers = nil
+	r.calls = nil
+}
+
+// stripQuiet removes a leading "-q" flag from the given arguments
+func stripQuiet(a []string) []string {
+	if len(a) > 0 && a[0] == "-q" {
+		return a[1:]
+	}
+	return a
+}
@@ -0,0 +1,97 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package pf
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Pool types
+const (
+	PoolDefault PoolType = iota
+	PoolBitmask
+	PoolRandom
+	PoolSourceHash
+	PoolRoundRobin
+)
+
+// PoolType represents the algorithm that pf uses to pick an address from an address pool
+type PoolType int
+
+// PoolOptions represents the options of an address pool, i. e. the target addresses of a
+// translation rule. HashKey is only used with PoolSourceHash and holds a hex (0x...) or string key
+type PoolOptions struct {
+	Type          PoolType
+	HashKey       string
+	StickyAddress bool
+}
+
+// String returns the PoolType in pf syntax
+func (t PoolType) String() string {
+	switch t {
+	case PoolBitmask:
+		return "bitmask"
+	case PoolRandom:
+		return "random"
+	case PoolSourceHash:
+		return "source-hash"
+	case PoolRoundRobin:
+		return "round-robin"
+	default:
+		return ""
+	}
+}
+
+// String returns the PoolOptions in pf syntax
+func (o PoolOptions) String() string {
+	optArray := make([]string, 0)
+	if o.Type != PoolDefault {
+		optArray = append(optArray, o.Type.String())
+	}
+	if o.Type == PoolSourceHash && o.HashKey != "" {
+		optArray = append(optArray, o.HashKey)
+	}
+	if o.StickyAddress {
+		optArray = append(optArray, "sticky-address")
+	}
+	return strings.Join(optArray, " ")
+}
+
+// Validate checks the PoolOptions for unknown pool types and invalid hash keys
+func (o PoolOptions) Validate() error {
+	if o.Type < PoolDefault || o.Type > PoolRoundRobin {
+		return fmt.Errorf("unknown pool type: %d", o.Type)
+	}
+	if o.HashKey != "" && (o.Type != PoolSourceHash || !isIdentifier(o.HashKey) || strings.Contains(o.HashKey, ":")) {
+		return fmt.Errorf("invalid source-hash key: %q", o.HashKey)
+	}
+	return nil
+}
+
+// validatePool checks that the given Endpoint is a valid address pool for the PoolOptions. Pool
+// addresses cannot be negated and pools of more than one address or of tables require round-robin
+func (o PoolOptions) validatePool(e Endpoint) error {
+	if err := e.Validate(); err != nil {
+		return err
+	}
+	for _, addr := range e {
+		if addr.Negated {
+			return fmt.Errorf("pool address %s cannot be negated", addr)
+		}
+		switch addr.Kind {
+		case AddrNetwork, AddrInterface:
+		case AddrTable:
+			if o.Type != PoolRoundRobin {
+				return fmt.Errorf("table pools are only supported with round-robin")
+			}
+		default:
+			return fmt.Errorf("invalid pool address: %s", addr)
+		}
+	}
+	if len(e) > 1 && o.Type != PoolRoundRobin {
+		return fmt.Errorf("pools of more than one address are only supported with round-robin")
+	}
+	return o.Validate()
+}
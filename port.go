@@ -0,0 +1,257 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package pf
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Port operators
+const (
+	PortOpEqual PortOp = iota
+	PortOpNotEqual
+	PortOpLess
+	PortOpLessEqual
+	PortOpGreater
+	PortOpGreaterEqual
+	PortOpRange
+	PortOpExclusiveRange
+	PortOpExceptRange
+)
+
+// PortOp represents a unary or binary port operator in the pf firewall ruleset (i. e. != or ><)
+type PortOp int
+
+// PortRange represents a single port item of a PortSpec. From and To hold a port number or a
+// service name (i. e. ssh). To is only used by the binary operators PortOpRange (8000:8100),
+// PortOpExclusiveRange (8000 >< 8100) and PortOpExceptRange (8000 <> 8100)
+type PortRange struct {
+	Op   PortOp
+	From string
+	To   string
+}
+
+// PortSpec represents the port specification of a source or destination of a Rule. A PortSpec with
+// more than one PortRange is rendered as pf list
+type PortSpec []PortRange
+
+// Port returns a PortSpec that matches the single given port number
+func Port(p uint16) PortSpec {
+	return PortSpec{{Op: PortOpEqual, From: strconv.FormatUint(uint64(p), 10)}}
+}
+
+// Ports returns a PortSpec that matches a list of port numbers
+func Ports(p ...uint16) PortSpec {
+	ps := make(PortSpec, 0, len(p))
+	for _, port := range p {
+		ps = append(ps, PortRange{Op: PortOpEqual, From: strconv.FormatUint(uint64(port), 10)})
+	}
+	return ps
+}
+
+// PortRangeSpec returns a PortSpec that matches the inclusive port range from f to t
+func PortRangeSpec(f, t uint16) PortSpec {
+	return PortSpec{{Op: PortOpRange, From: strconv.FormatUint(uint64(f), 10),
+		To: strconv.FormatUint(uint64(t), 10)}}
+}
+
+// ParsePortSpec parses a port specification as used after the port keyword of a pf rule
+// (i. e. "8000:8100", "{ 80 443 }", "> 1024" or "ssh") into a PortSpec
+func ParsePortSpec(s string) (PortSpec, error) {
+	tokens, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &ruleParser{input: s, tokens: tokens}
+	ps, err := p.parsePortSpec()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek() != "" {
+		return nil, p.fail("unexpected token after port specification")
+	}
+	return ps, nil
+}
+
+// String returns the PortOp in pf syntax
+func (o PortOp) String() string {
+	switch o {
+	case PortOpEqual:
+		return "="
+	case PortOpNotEqual:
+		return "!="
+	case PortOpLess:
+		return "<"
+	case PortOpLessEqual:
+		return "<="
+	case PortOpGreater:
+		return ">"
+	case PortOpGreaterEqual:
+		return ">="
+	case PortOpRange:
+		return ":"
+	case PortOpExclusiveRange:
+		return "><"
+	case PortOpExceptRange:
+		return "<>"
+	default:
+		return ""
+	}
+}
+
+// binary returns true if the PortOp requires two ports
+func (o PortOp) binary() bool {
+	return o == PortOpRange || o == PortOpExclusiveRange || o == PortOpExceptRange
+}
+
+// String returns the PortRange in pf syntax
+func (r PortRange) String() string {
+	switch {
+	case r.Op == PortOpEqual:
+		return r.From
+	case r.Op == PortOpRange:
+		return fmt.Sprintf("%s:%s", r.From, r.To)
+	case r.Op.binary():
+		return fmt.Sprintf("%s %s %s", r.From, r.Op, r.To)
+	default:
+		return fmt.Sprintf("%s %s", r.Op, r.From)
+	}
+}
+
+// Validate checks the PortRange for invalid operators and ports
+func (r PortRange) Validate() error {
+	if r.Op < PortOpEqual || r.Op > PortOpExceptRange {
+		return fmt.Errorf("unknown port operator: %d", r.Op)
+	}
+	if err := validatePort(r.From); err != nil {
+		return err
+	}
+	if !r.Op.binary() {
+		if r.To != "" {
+			return fmt.Errorf("port operator %s does not take a second port", r.Op)
+		}
+		return nil
+	}
+	if err := validatePort(r.To); err != nil {
+		return err
+	}
+	from, fromErr := strconv.ParseUint(r.From, 10, 16)
+	to, toErr := strconv.ParseUint(r.To, 10, 16)
+	if fromErr == nil && toErr == nil && from > to {
+		return fmt.Errorf("invalid port range %s: start is greater than end", r)
+	}
+	return nil
+}
+
+// String returns the PortSpec in pf syntax without the leading port keyword
+func (ps PortSpec) String() string {
+	if len(ps) == 1 {
+		return ps[0].String()
+	}
+	itemArray := make([]string, 0, len(ps))
+	for _, r := range ps {
+		itemArray = append(itemArray, r.String())
+	}
+	return fmt.Sprintf("{ %s }", strings.Join(itemArray, " "))
+}
+
+// Validate checks all items of the PortSpec
+func (ps PortSpec) Validate() error {
+	for _, r := range ps {
+		if err := r.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// number returns the port number of a PortSpec that matches a single port number. For all other
+// PortSpecs, 0 is returned
+func (ps PortSpec) number() uint32 {
+	if len(ps) != 1 || ps[0].Op != PortOpEqual {
+		return 0
+	}
+	port, err := strconv.ParseUint(ps[0].From, 10, 16)
+	if err != nil {
+		return 0
+	}
+	return uint32(port)
+}
+
+// splitPortSpec returns a PortSpec for every PortRange of the given PortSpec. An empty PortSpec is
+// returned as is
+func splitPortSpec(ps PortSpec) []PortSpec {
+	if len(ps) == 0 {
+		return []PortSpec{ps}
+	}
+	psArray := make([]PortSpec, 0, len(ps))
+	for _, pr := range ps {
+		psArray = append(psArray, PortSpec{pr})
+	}
+	return psArray
+}
+
+// portSpec returns the PortSpec that matches the given single port number. Port 0 returns nil
+func portSpec(p uint32) PortSpec {
+	if p == 0 {
+		return nil
+	}
+	return PortSpec{{Op: PortOpEqual, From: strconv.FormatUint(uint64(p), 10)}}
+}
+
+// validatePort checks that the given string is a valid port number or service name
+func validatePort(p string) error {
+	if p == "" {
+		return fmt.Errorf("empty port given")
+	}
+	if p[0] >= '0' && p[0] <= '9' {
+		if _, err := strconv.ParseUint(p, 10, 16); err != nil {
+			return fmt.Errorf("invalid port number: %q", p)
+		}
+		return nil
+	}
+	if !isIdentifier(p) || strings.Contains(p, ":") {
+		return fmt.Errorf("invalid service name: %q", p)
+	}
+	return nil
+}
+
+// normalizePortSpec returns a copy of the given PortSpec with all service names replaced by port
+// numbers
+func normalizePortSpec(ps PortSpec, p string) PortSpec {
+	if len(ps) == 0 {
+		return ps
+	}
+	normArray := make(PortSpec, 0, len(ps))
+	for _, pr := range ps {
+		normArray = append(normArray, normalizePortRange(pr, p))
+	}
+	return normArray
+}
+
+// normalizePortRange returns the given PortRange with its service names replaced by port numbers.
+// Service names that cannot be resolved for the given protocol are kept
+func normalizePortRange(pr PortRange, p string) PortRange {
+	pr.From = normalizePort(pr.From, p)
+	pr.To = normalizePort(pr.To, p)
+	return pr
+}
+
+// normalizePort resolves the given service name for the given protocol to its port number
+func normalizePort(s, p string) string {
+	if s == "" || s == "*" || (s[0] >= '0' && s[0] <= '9') {
+		return s
+	}
+	if p != "udp" {
+		p = "tcp"
+	}
+	port, err := net.LookupPort(p, s)
+	if err != nil {
+		return s
+	}
+	return strconv.Itoa(port)
+}
@@ -0,0 +1,262 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package pf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// RuleDrift represents a rule that differs between the desired and the loaded ruleset of an anchor.
+// Index is the position of the rule within the translation or filter rules. Desired is empty if the
+// rule is only loaded, Loaded is empty if the rule is missing in the anchor
+type RuleDrift struct {
+	Translation bool
+	Index       int
+	Desired     string
+	Loaded      string
+}
+
+// ReconcileResult represents the result of an anchor reconciliation. Reloaded is true if the anchor
+// differed from the desired rules and has been reloaded. Unsupported holds the loaded rules that
+// could not be parsed (i. e. rules with icmp-type) and have therefore not been compared
+type ReconcileResult struct {
+	Reloaded    bool
+	Drift       []RuleDrift
+	Unsupported []*ParseError
+}
+
+// AnchorRules returns the filter rules that are currently loaded into the given anchor
+func (f *Firewall) AnchorRules(n string) (RuleSet, error) {
+	return f.AnchorRulesContext(context.Background(), n)
+}
+
+// AnchorRulesContext returns the filter rules that are currently loaded into the given anchor. Rules
+// that cannot be represented by a Rule are reported in RuleSet.Unsupported. The given context is used
+// for the pfctl execution
+func (f *Firewall) AnchorRulesContext(ctx context.Context, n string) (RuleSet, error) {
+	ruleArray, err := f.execPfCtl(ctx, "-a", n, "-s", "rules")
+	if err != nil {
+		return RuleSet{}, err
+	}
+	return ParseRuleSet(strings.NewReader(strings.Join(ruleArray, "\n")))
+}
+
+// AnchorTranslationRules returns the nat, rdr and binat rules that are currently loaded into the
+// given anchor
+func (f *Firewall) AnchorTranslationRules(n string) ([]TranslationRule, error) {
+	return f.AnchorTranslationRulesContext(context.Background(), n)
+}
+
+// AnchorTranslationRulesContext returns the nat, rdr and binat rules that are currently loaded into
+// the given anchor. The given context is used for the pfctl execution
+func (f *Firewall) AnchorTranslationRulesContext(ctx context.Context, n string) ([]TranslationRule, error) {
+	ruleArray, err := f.execPfCtl(ctx, "-a", n, "-s", "nat")
+	if err != nil {
+		return nil, err
+	}
+	transArray := make([]TranslationRule, 0, len(ruleArray))
+	for _, l := range ruleArray {
+		if strings.TrimSpace(l) == "" {
+			continue
+		}
+		tr, err := ParseTranslationRule(l)
+		if err != nil {
+			return nil, err
+		}
+		transArray = append(transArray, tr)
+	}
+	return transArray, nil
+}
+
+// Reconcile compares the rules of the given Anchor with the rules that are currently loaded into
+// the pf anchor and commits the Anchor only if they differ. The differences are reported as drift
+func (f *Firewall) Reconcile(a *Anchor) (ReconcileResult, error) {
+	return f.ReconcileContext(context.Background(), a)
+}
+
+// ReconcileContext compares the rules of the given Anchor with the rules that are currently loaded
+// into the pf anchor and commits the Anchor only if they differ. The given context is used for the
+// pfctl executions. Before comparing, both sides are normalized the way pfctl prints rules (i. e.
+// the implicit "flags S/SA keep state" of pass rules, "drop" of block rules without policy, the
+// address family of rules with IP addresses, one rule per list item, service names and expanded
+// label macros), so that an unchanged anchor is never reloaded and its counters are kept. The
+// global block-policy is assumed to be drop. Loaded rules that cannot be parsed are not compared and
+// are reported in ReconcileResult.Unsupported, so they do not cause a reload on their own. They are
+// removed if the anchor is reloaded because of other drift. Table definitions are not compared, as
+// pfctl does not report them with the rules
+func (f *Firewall) ReconcileContext(ctx context.Context, a *Anchor) (ReconcileResult, error) {
+	res := ReconcileResult{}
+	loadedRules, unsupportedRules, err := f.loadedAnchorRules(ctx, a.Name, "rules")
+	if err != nil {
+		return res, err
+	}
+	loadedTrans, unsupportedTrans, err := f.loadedAnchorRules(ctx, a.Name, "nat")
+	if err != nil {
+		return res, err
+	}
+	res.Unsupported = append(unsupportedTrans, unsupportedRules...)
+
+	desiredTrans := make([]string, 0, len(a.transRules))
+	for _, r := range a.transRules {
+		desiredTrans = append(desiredTrans, normalizeTranslationRule(r).String())
+	}
+	desiredRules := make([]string, 0, len(a.ruleSet.Rules))
+	for _, r := range a.ruleSet.Rules {
+		if !r.committed {
+			continue
+		}
+		for _, er := range r.expandLists() {
+			nr := normalizeRule(er, len(desiredRules))
+			desiredRules = append(desiredRules, nr.String())
+		}
+	}
+	res.Drift = append(diffRules(desiredTrans, loadedTrans, true), diffRules(desiredRules, loadedRules, false)...)
+	if len(res.Drift) == 0 {
+		return res, nil
+	}
+
+	if err := f.CommitAnchorContext(ctx, a); err != nil {
+		return res, err
+	}
+	res.Reloaded = true
+	return res, nil
+}
+
+// loadedAnchorRules returns the normalized rules of the given pfctl show modifier (rules or nat) that
+// are loaded into the given anchor and the rules that could not be parsed, with their line in the
+// pfctl output. A missing anchor is treated as empty
+func (f *Firewall) loadedAnchorRules(ctx context.Context, n, m string) ([]string, []*ParseError, error) {
+	ruleArray, err := f.execPfCtl(ctx, "-a", n, "-s", m)
+	if errors.Is(err, ErrAnchorNotFound) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	loadedArray := make([]string, 0, len(ruleArray))
+	unsupportedArray := make([]*ParseError, 0)
+	for i, l := range ruleArray {
+		l = strings.TrimSpace(l)
+		if l == "" {
+			continue
+		}
+		var normRule string
+		var err error
+		if m == "nat" {
+			var tr TranslationRule
+			if tr, err = ParseTranslationRule(l); err == nil {
+				normRule = normalizeTranslationRule(tr).String()
+			}
+		} else {
+			var ar Rule
+			if ar, err = ParseRule(l); err == nil {
+				nr := normalizeRule(ar, len(loadedArray))
+				normRule = nr.String()
+			}
+		}
+		if err != nil {
+			parseErr, ok := err.(*ParseError)
+			if !ok {
+				parseErr = &ParseError{Rule: l, Message: err.Error()}
+			}
+			parseErr.Line = i + 1
+			unsupportedArray = append(unsupportedArray, parseErr)
+			continue
+		}
+		loadedArray = append(loadedArray, normRule)
+	}
+	return loadedArray, unsupportedArray, nil
+}
+
+// diffRules compares the desired and loaded rules position by position and returns the differences
+func diffRules(d, l []string, t bool) []RuleDrift {
+	driftArray := make([]RuleDrift, 0)
+	for i := 0; i < len(d) || i < len(l); i++ {
+		rd := RuleDrift{Translation: t, Index: i}
+		if i < len(d) {
+			rd.Desired = d[i]
+		}
+		if i < len(l) {
+			rd.Loaded = l[i]
+		}
+		if rd.Desired != rd.Loaded {
+			driftArray = append(driftArray, rd)
+		}
+	}
+	return driftArray
+}
+
+// normalizeRule returns a copy of the given Rule without address or port lists as pfctl prints it
+// after loading it as the rule number nr. Pass rules keep state by default and stateful tcp rules
+// match on flags S/SA by default. Block rules without policy drop and rules with IP addresses get
+// their address family
+func normalizeRule(r Rule, nr int) Rule {
+	r.Label = r.ExpandLabel(nr)
+	if r.Action == "block" && r.Block.Mode == BlockModeDefault {
+		r.Block.Mode = BlockModeDrop
+	}
+	if r.AdressFamily == "" {
+		r.AdressFamily = r.source().family()
+		if r.AdressFamily == "" {
+			r.AdressFamily = r.destination().family()
+		}
+	}
+	if r.Protocol != "" {
+		r.Protocol = labelProto(r.Protocol)
+	}
+	stateMode, stateOpts := r.state()
+	if r.Action == "pass" && stateMode == StateDefault {
+		stateMode = StateKeep
+	}
+	r.setState(stateMode, stateOpts)
+	switch flags := r.flags(); {
+	case flags.Any:
+		r.setFlags(TCPFlags{})
+	case flags.isZero() && r.Action == "pass" && stateMode != StateNone && (r.Protocol == "" || r.Protocol == "tcp"):
+		r.setFlags(TCPFlags{Set: "S", Mask: "SA"})
+	default:
+		r.setFlags(flags)
+	}
+	r.setSourcePorts(normalizePortSpec(r.sourcePorts(), r.Protocol))
+	r.setDestPorts(normalizePortSpec(r.destPorts(), r.Protocol))
+	return r
+}
+
+// normalizeTranslationRule returns a copy of the given TranslationRule with all service names
+// replaced by port numbers
+func normalizeTranslationRule(tr TranslationRule) TranslationRule {
+	switch r := tr.(type) {
+	case NatRule:
+		r.SourcePort = normalizePortSpec(r.SourcePort, r.Protocol)
+		r.DestPort = normalizePortSpec(r.DestPort, r.Protocol)
+		r.TargetPort = normalizePortRange(r.TargetPort, r.Protocol)
+		return r
+	case RdrRule:
+		r.SourcePort = normalizePortSpec(r.SourcePort, r.Protocol)
+		r.DestPort = normalizePortSpec(r.DestPort, r.Protocol)
+		r.TargetPort = normalizePortRange(r.TargetPort, r.Protocol)
+		return r
+	default:
+		return tr
+	}
+}
+
+// String returns the RuleDrift in a human readable form
+func (d RuleDrift) String() string {
+	kind := "rule"
+	if d.Translation {
+		kind = "translation rule"
+	}
+	switch {
+	case d.Loaded == "":
+		return fmt.Sprintf("%s %d missing: %s", kind, d.Index, d.Desired)
+	case d.Desired == "":
+		return fmt.Sprintf("%s %d unexpected: %s", kind, d.Index, d.Loaded)
+	default:
+		return fmt.Sprintf("%s %d differs: %s != %s", kind, d.Index, d.Loaded, d.Desired)
+	}
+}
@@ -0,0 +1,160 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package pf
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/wneessen/go-pf/pftest"
+)
+
+// TestFirewall_AnchorRules tests the read-back of the rules loaded into an anchor
+func TestFirewall_AnchorRules(t *testing.T) {
+	f, r := newTestFirewall(t)
+	r.On(pftest.Response{Stdout: "block drop in all\npass in on em0 proto tcp from any to any port = ssh " +
+		"flags S/SA keep state\n"}, "-a", "go-pf", "-s", "rules")
+	rs, err := f.AnchorRules("go-pf")
+	if err != nil {
+		t.Fatalf("AnchorRules failed: %s", err)
+	}
+	if len(rs.Rules) != 2 || rs.Rules[1].Interface != "em0" || rs.Rules[1].DestPorts.String() != "ssh" {
+		t.Errorf("unexpected anchor rules: %+v", rs.Rules)
+	}
+
+	r.On(pftest.Response{Stdout: "scrub in all fragment reassemble\n"}, "-a", "go-pf", "-s", "rules")
+	rs, err = f.AnchorRules("go-pf")
+	if err != nil {
+		t.Fatalf("AnchorRules failed: %s", err)
+	}
+	if len(rs.Rules) != 0 || len(rs.Unsupported) != 1 || !errors.Is(rs.Unsupported[0], ErrUnsupported) {
+		t.Errorf("unexpected anchor rules: %+v", rs)
+	}
+
+	r.On(pftest.Response{Stdout: "nat on em0 inet from 10.0.0.0/8 to any -> (em0)\n"}, "-a", "go-pf", "-s", "nat")
+	trArray, err := f.AnchorTranslationRules("go-pf")
+	if err != nil {
+		t.Fatalf("AnchorTranslationRules failed: %s", err)
+	}
+	if len(trArray) != 1 {
+		t.Fatalf("unexpected number of translation rules: %d", len(trArray))
+	}
+	if _, ok := trArray[0].(NatRule); !ok {
+		t.Errorf("unexpected translation rule type: %T", trArray[0])
+	}
+}
+
+// TestFirewall_Reconcile tests that an anchor is only reloaded if the loaded rules drifted
+func TestFirewall_Reconcile(t *testing.T) {
+	desiredRules := []string{
+		"block in all",
+		"pass in on em0 proto tcp to port { 22 443 } label \"$if-$dstport-$nr\"",
+		"pass in proto tcp from { 192.0.2.0/24 2001:db8::/32 } to port http",
+		"pass out proto udp to port 53",
+		"pass out proto icmp6 from 2001:db8::1",
+	}
+	loadedOutput, err := os.ReadFile("testdata/pfctl-a-sr.txt")
+	if err != nil {
+		t.Fatalf("failed to read test data: %s", err)
+	}
+	loaded := string(loadedOutput)
+	testTable := []struct {
+		testName    string
+		loaded      pftest.Response
+		reloaded    bool
+		drift       []string
+		unsupported int
+	}{
+		{"In sync", pftest.Response{Stdout: loaded}, false, nil, 0},
+		{"Changed rule", pftest.Response{Stdout: strings.Replace(loaded, "port = https", "port = http", 1)}, true,
+			[]string{"rule 2 differs: pass in on em0 proto tcp from any to any port 80 flags S/SA keep state " +
+				"label \"em0-443-2\" != pass in on em0 proto tcp from any to any port 443 flags S/SA keep state " +
+				"label \"em0-443-2\""}, 0},
+		{"Changed block policy", pftest.Response{Stdout: strings.Replace(loaded, "block drop", "block return", 1)},
+			true, []string{"rule 0 differs: block return in from any to any != block drop in from any to any"}, 0},
+		{"Rule added by hand", pftest.Response{Stdout: loaded + "pass in on em1 all flags S/SA keep state\n"}, true,
+			[]string{"rule 7 unexpected: pass in on em1 from any to any flags S/SA keep state"}, 0},
+		{"Unsupported rule loaded", pftest.Response{Stdout: "pass in inet proto icmp all icmp-type echoreq " +
+			"keep state\n" + loaded}, false, nil, 1},
+		{"Missing anchor", pftest.Response{Stderr: "pfctl: Anchor does not exist.\n", ExitCode: 1}, true,
+			[]string{"rule 0 missing: block drop in from any to any",
+				"rule 1 missing: pass in on em0 proto tcp from any to any port 22 flags S/SA keep state " +
+					"label \"em0-22-1\"",
+				"rule 2 missing: pass in on em0 proto tcp from any to any port 443 flags S/SA keep state " +
+					"label \"em0-443-2\"",
+				"rule 3 missing: pass in inet proto tcp from 192.0.2.0/24 to any port 80 flags S/SA keep state",
+				"rule 4 missing: pass in inet6 proto tcp from 2001:db8::/32 to any port 80 flags S/SA keep state",
+				"rule 5 missing: pass out proto udp from any to any port 53 keep state",
+				"rule 6 missing: pass out inet6 proto ipv6-icmp from 2001:db8::1/128 to any keep state"}, 0},
+	}
+	for _, testCase := range testTable {
+		t.Run(testCase.testName, func(t *testing.T) {
+			f, r := newTestFirewall(t)
+			r.On(testCase.loaded, "-a", "go-pf", "-s", "rules")
+			a := f.NewAnchor("go-pf")
+			for _, l := range desiredRules {
+				ar, err := ParseRule(l)
+				if err != nil {
+					t.Fatalf("failed to parse rule %q: %s", l, err)
+				}
+				a.AddRule(ar)
+			}
+			res, err := f.Reconcile(&a)
+			if err != nil {
+				t.Fatalf("Reconcile failed: %s", err)
+			}
+			if res.Reloaded != testCase.reloaded {
+				t.Errorf("unexpected reload. Expected: %t, got: %t", testCase.reloaded, res.Reloaded)
+			}
+			driftArray := make([]string, 0, len(res.Drift))
+			for _, d := range res.Drift {
+				driftArray = append(driftArray, d.String())
+			}
+			if strings.Join(driftArray, "\n") != strings.Join(testCase.drift, "\n") {
+				t.Errorf("unexpected drift. Expected: %q, got: %q", testCase.drift, driftArray)
+			}
+			if len(res.Unsupported) != testCase.unsupported {
+				t.Errorf("unexpected unsupported rules. Expected: %d, got: %v", testCase.unsupported, res.Unsupported)
+			}
+			c, _ := r.LastCall()
+			commitArgs := strings.Join(c.Args, " ") == "-q -a go-pf -f - -v"
+			if commitArgs != testCase.reloaded {
+				t.Errorf("unexpected last pfctl call: %q", c.Args)
+			}
+		})
+	}
+}
+
+// TestFirewall_Reconcile_Translation tests the reconciliation of translation rules
+func TestFirewall_Reconcile_Translation(t *testing.T) {
+	f, r := newTestFirewall(t)
+	r.On(pftest.Response{Stdout: "rdr pass on em0 inet proto tcp from any to any port = http -> 10.0.0.5 port 8080\n"},
+		"-a", "go-pf", "-s", "nat")
+	a := f.NewAnchor("go-pf")
+	tr, err := ParseTranslationRule("rdr pass on em0 inet proto tcp to port 80 -> 10.0.0.5 port 8080")
+	if err != nil {
+		t.Fatalf("failed to parse translation rule: %s", err)
+	}
+	if err := a.AddTranslationRule(tr); err != nil {
+		t.Fatalf("failed to add translation rule: %s", err)
+	}
+	res, err := f.Reconcile(&a)
+	if err != nil {
+		t.Fatalf("Reconcile failed: %s", err)
+	}
+	if res.Reloaded || len(res.Drift) > 0 {
+		t.Errorf("unexpected reconcile result: %+v", res)
+	}
+
+	r.On(pftest.Response{}, "-a", "go-pf", "-s", "nat")
+	res, err = f.Reconcile(&a)
+	if err != nil {
+		t.Fatalf("Reconcile failed: %s", err)
+	}
+	if !res.Reloaded || len(res.Drift) != 1 || !res.Drift[0].Translation {
+		t.Errorf("unexpected reconcile result: %+v", res)
+	}
+}
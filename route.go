@@ -0,0 +1,146 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package pf
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// Route types
+const (
+	RouteNone RouteType = iota
+	RouteTo
+	RouteReplyTo
+	RouteDupTo
+)
+
+// RouteType represents the policy routing option of a Rule (i. e. route-to or reply-to)
+type RouteType int
+
+// RouteHost represents a single gateway of a policy routing option. The Address is optional, without
+// it packets are routed out of the Interface. It must be a host address (i. e. a /32 or /128 network)
+type RouteHost struct {
+	Interface string
+	Address   *net.IPNet
+}
+
+// RouteOptions represents the policy routing option of a Rule, i. e. route-to (em1 192.0.2.1).
+// More than one RouteHost requires a round-robin address pool
+type RouteOptions struct {
+	Type  RouteType
+	Hosts []RouteHost
+	Pool  PoolOptions
+}
+
+// RouteGateway returns a RouteHost that routes packets out of the given interface to the given
+// gateway address
+func RouteGateway(i string, gw netip.Addr) (RouteHost, error) {
+	if !gw.IsValid() {
+		return RouteHost{}, fmt.Errorf("invalid gateway address")
+	}
+	ipNet, err := prefixToIPNet(netip.PrefixFrom(gw, gw.BitLen()))
+	if err != nil {
+		return RouteHost{}, err
+	}
+	return RouteHost{Interface: i, Address: ipNet}, nil
+}
+
+// String returns the RouteType in pf syntax
+func (t RouteType) String() string {
+	switch t {
+	case RouteTo:
+		return "route-to"
+	case RouteReplyTo:
+		return "reply-to"
+	case RouteDupTo:
+		return "dup-to"
+	default:
+		return ""
+	}
+}
+
+// String returns the RouteHost in pf syntax. Like pfctl, the gateway address is printed without
+// its prefix length
+func (h RouteHost) String() string {
+	if h.Address == nil {
+		return fmt.Sprintf("(%s)", h.Interface)
+	}
+	return fmt.Sprintf("(%s %s)", h.Interface, h.Address.IP)
+}
+
+// String returns the RouteOptions in pf syntax
+func (o RouteOptions) String() string {
+	if o.Type == RouteNone {
+		return ""
+	}
+	var hosts string
+	switch len(o.Hosts) {
+	case 0:
+	case 1:
+		hosts = o.Hosts[0].String()
+	default:
+		hostArray := make([]string, 0, len(o.Hosts))
+		for _, h := range o.Hosts {
+			hostArray = append(hostArray, h.String())
+		}
+		hosts = fmt.Sprintf("{ %s }", strings.Join(hostArray, ", "))
+	}
+	routeOpts := fmt.Sprintf("%s %s", o.Type, hosts)
+	if poolOpts := o.Pool.String(); poolOpts != "" {
+		routeOpts = fmt.Sprintf("%s %s", routeOpts, poolOpts)
+	}
+	return routeOpts
+}
+
+// Validate checks the RouteOptions for missing or invalid gateways and pool options
+func (o RouteOptions) Validate() error {
+	switch o.Type {
+	case RouteNone:
+		if len(o.Hosts) > 0 || o.Pool != (PoolOptions{}) {
+			return fmt.Errorf("gateways and pool options require route-to, reply-to or dup-to")
+		}
+		return nil
+	case RouteTo, RouteReplyTo, RouteDupTo:
+	default:
+		return fmt.Errorf("unknown route type: %d", o.Type)
+	}
+	if len(o.Hosts) == 0 {
+		return fmt.Errorf("%s requires at least one gateway", o.Type)
+	}
+	for _, h := range o.Hosts {
+		if err := InterfaceAddr(h.Interface).Validate(); err != nil {
+			return fmt.Errorf("invalid %s gateway: %w", o.Type, err)
+		}
+		if h.Address == nil {
+			continue
+		}
+		if ipFamily(h.Address) == "" {
+			return fmt.Errorf("invalid %s gateway address", o.Type)
+		}
+		if ones, bits := h.Address.Mask.Size(); bits == 0 || ones != bits {
+			return fmt.Errorf("%s gateway %s is not a single host address", o.Type, h.Address)
+		}
+	}
+	if len(o.Hosts) > 1 && o.Pool.Type != PoolRoundRobin {
+		return fmt.Errorf("%s with more than one gateway requires round-robin", o.Type)
+	}
+	return o.Pool.Validate()
+}
+
+// family returns the pf address family keyword of the gateway addresses, if they are all of the
+// same address family. Otherwise an empty string is returned
+func (o RouteOptions) family() string {
+	var fam string
+	for _, h := range o.Hosts {
+		hostFam := ipFamily(h.Address)
+		if hostFam == "" || (fam != "" && hostFam != fam) {
+			return ""
+		}
+		fam = hostFam
+	}
+	return fam
+}
@@ -1,38 +1,103 @@
-//go:build !windows && !plan9 && !linux
-// +build !windows,!plan9,!linux
+//go:build !windows && !plan9
+// +build !windows,!plan9
 
 package pf
 
 import (
+	"context"
 	"fmt"
 	"net"
+	"net/netip"
+	"strings"
 )
 
 // GetRules returns a string array of currently configured firewall rules
 func (f *Firewall) GetRules() ([]string, error) {
-	return f.execPfCtl("-s", "rules")
+	return f.GetRulesContext(context.Background())
 }
 
-// Rule is the struct that holds all relevant data for a pf firewall anchor rule
+// GetRulesContext returns a string array of currently configured firewall rules. The given context
+// is used for the pfctl execution
+func (f *Firewall) GetRulesContext(ctx context.Context) ([]string, error) {
+	return f.execPfCtl(ctx, "-s", "rules")
+}
+
+// GetRuleSet returns the currently configured firewall rules parsed into a RuleSet
+func (f *Firewall) GetRuleSet() (RuleSet, error) {
+	return f.GetRuleSetContext(context.Background())
+}
+
+// GetRuleSetContext returns the currently configured firewall rules parsed into a RuleSet. The
+// given context is used for the pfctl execution
+func (f *Firewall) GetRuleSetContext(ctx context.Context) (RuleSet, error) {
+	ruleArray, err := f.GetRulesContext(ctx)
+	if err != nil {
+		return RuleSet{}, err
+	}
+	return ParseRuleSet(strings.NewReader(strings.Join(ruleArray, "\n")))
+}
+
+// Rule is the struct that holds all relevant data for a pf firewall anchor rule. Source and
+// Destination hold a single network, SourceAddrs and DestAddrs an Endpoint (i. e. a table, an
+// interface or a list of addresses). SourcePort and DestPort hold a single port number, SourcePorts
+// and DestPorts a PortSpec (i. e. a port range or list). Flags and State hold the TCP flags and the
+// state keyword with its options in pf syntax, TCPFlags, StateMode and StateOpts their typed form.
+// The Endpoint, PortSpec and typed fields take precedence if set. The setters and ParseRule fill
+// both, as far as the Endpoint or PortSpec can be represented by a single network or port number
 type Rule struct {
 	Action       string
 	AdressFamily string
+	Anchor       string
+	Block        BlockPolicy
 	committed    bool
 	Direction    string
 	Destination  *net.IPNet
+	DestAddrs    Endpoint
 	DestPort     uint32
+	DestPorts    PortSpec
+	Flags        string
+	TCPFlags     TCPFlags
 	Interface    string
+	Label        string
 	Log          bool
+	LogOpts      LogOptions
 	Protocol     string
+	Quick        bool
+	Route        RouteOptions
 	Source       *net.IPNet
+	SourceAddrs  Endpoint
 	SourcePort   uint32
+	SourcePorts  PortSpec
+	State        string
+	StateMode    StateMode
+	StateOpts    StateOptions
+	Tag          string
+	Tagged       string
+	NotTagged    bool
 }
 
-// SetSourceIP sets a source IP for the current Rule
-func (a *Rule) SetSourceIP(i string, m ...string) {
+// LogOptions represents the optional parameters of the log keyword of a Rule
+type LogOptions struct {
+	All     bool
+	Matches bool
+	User    bool
+	To      string
+}
+
+// SetSourceIP sets a source IP for the current Rule. It returns an error if the IP or the optional
+// netmask is invalid
+func (a *Rule) SetSourceIP(i string, m ...string) error {
 	if !a.committed {
-		a.Source = parseIP(i, m)
+		ipNet, err := parseIP(i, m)
+		if err != nil {
+			return err
+		}
+		if a.destination().family() != "" && a.destination().family() != ipFamily(ipNet) {
+			return fmt.Errorf("address family of source %q does not match the destination address", i)
+		}
+		a.setSource(Endpoint{NetworkAddr(ipNet)})
 	}
+	return nil
 }
 
 // SetSourceCIDR sets a source IP for the current Rule
@@ -42,16 +107,28 @@ func (a *Rule) SetSourceCIDR(c string) error {
 		if err != nil {
 			return err
 		}
-		a.Source = ipNet
+		if a.destination().family() != "" && a.destination().family() != ipFamily(ipNet) {
+			return fmt.Errorf("address family of source %q does not match the destination address", c)
+		}
+		a.setSource(Endpoint{NetworkAddr(ipNet)})
 	}
 	return nil
 }
 
-// SetDestinationIP sets a destination IP for the current Rule
-func (a *Rule) SetDestinationIP(i string, m ...string) {
+// SetDestinationIP sets a destination IP for the current Rule. It returns an error if the IP or the
+// optional netmask is invalid
+func (a *Rule) SetDestinationIP(i string, m ...string) error {
 	if !a.committed {
-		a.Destination = parseIP(i, m)
+		ipNet, err := parseIP(i, m)
+		if err != nil {
+			return err
+		}
+		if a.source().family() != "" && a.source().family() != ipFamily(ipNet) {
+			return fmt.Errorf("address family of destination %q does not match the source address", i)
+		}
+		a.setDestination(Endpoint{NetworkAddr(ipNet)})
 	}
+	return nil
 }
 
 // SetDestinationCIDR sets a source IP for the current Rule
@@ -61,23 +138,130 @@ func (a *Rule) SetDestinationCIDR(c string) error {
 		if err != nil {
 			return err
 		}
-		a.Destination = ipNet
+		if a.source().family() != "" && a.source().family() != ipFamily(ipNet) {
+			return fmt.Errorf("address family of destination %q does not match the source address", c)
+		}
+		a.setDestination(Endpoint{NetworkAddr(ipNet)})
+	}
+	return nil
+}
+
+// SetSourceAddr sets a single source address for the current Rule
+func (a *Rule) SetSourceAddr(i netip.Addr) error {
+	if !i.IsValid() {
+		return fmt.Errorf("invalid source address")
+	}
+	return a.SetSourcePrefix(netip.PrefixFrom(i, i.BitLen()))
+}
+
+// SetSourcePrefix sets a source network for the current Rule
+func (a *Rule) SetSourcePrefix(p netip.Prefix) error {
+	if !a.committed {
+		ipNet, err := prefixToIPNet(p)
+		if err != nil {
+			return err
+		}
+		if a.destination().family() != "" && a.destination().family() != ipFamily(ipNet) {
+			return fmt.Errorf("address family of source %s does not match the destination address", p)
+		}
+		a.setSource(Endpoint{NetworkAddr(ipNet)})
 	}
 	return nil
 }
 
-// SetSourcePort sets the source port for the current Rule
+// SetDestinationAddr sets a single destination address for the current Rule
+func (a *Rule) SetDestinationAddr(i netip.Addr) error {
+	if !i.IsValid() {
+		return fmt.Errorf("invalid destination address")
+	}
+	return a.SetDestinationPrefix(netip.PrefixFrom(i, i.BitLen()))
+}
+
+// SetDestinationPrefix sets a destination network for the current Rule
+func (a *Rule) SetDestinationPrefix(p netip.Prefix) error {
+	if !a.committed {
+		ipNet, err := prefixToIPNet(p)
+		if err != nil {
+			return err
+		}
+		if a.source().family() != "" && a.source().family() != ipFamily(ipNet) {
+			return fmt.Errorf("address family of destination %s does not match the source address", p)
+		}
+		a.setDestination(Endpoint{NetworkAddr(ipNet)})
+	}
+	return nil
+}
+
+// SetSource sets the source addresses for the current Rule. Without addresses, the Rule matches
+// any source. Multiple addresses are rendered as pf list
+func (a *Rule) SetSource(e ...Address) error {
+	if !a.committed {
+		ep := Endpoint(e)
+		if err := ep.Validate(); err != nil {
+			return err
+		}
+		if ep.family() != "" && a.destination().family() != "" && ep.family() != a.destination().family() {
+			return fmt.Errorf("address family of source %s does not match the destination address", ep)
+		}
+		a.setSource(ep)
+	}
+	return nil
+}
+
+// SetDestination sets the destination addresses for the current Rule. Without addresses, the Rule
+// matches any destination. Multiple addresses are rendered as pf list
+func (a *Rule) SetDestination(e ...Address) error {
+	if !a.committed {
+		ep := Endpoint(e)
+		if err := ep.Validate(); err != nil {
+			return err
+		}
+		if ep.has(AddrURPFFailed) {
+			return fmt.Errorf("urpf-failed is only valid as source address")
+		}
+		if ep.family() != "" && a.source().family() != "" && ep.family() != a.source().family() {
+			return fmt.Errorf("address family of destination %s does not match the source address", ep)
+		}
+		a.setDestination(ep)
+	}
+	return nil
+}
+
+// SetSourcePort sets the source port for the current Rule. A port of 0 removes the source port
 func (a *Rule) SetSourcePort(p uint32) {
 	if !a.committed {
-		a.SourcePort = p
+		a.SourcePort, a.SourcePorts = p, portSpec(p)
 	}
 }
 
-// SetDestinationPort sets the source port for the current Rule
+// SetDestinationPort sets the source port for the current Rule. A port of 0 removes the
+// destination port
 func (a *Rule) SetDestinationPort(p uint32) {
 	if !a.committed {
-		a.DestPort = p
+		a.DestPort, a.DestPorts = p, portSpec(p)
+	}
+}
+
+// SetSourcePortSpec sets the source PortSpec (i. e. a port range or list) for the current Rule
+func (a *Rule) SetSourcePortSpec(ps PortSpec) error {
+	if !a.committed {
+		if err := ps.Validate(); err != nil {
+			return err
+		}
+		a.setSourcePorts(ps)
 	}
+	return nil
+}
+
+// SetDestinationPortSpec sets the destination PortSpec (i. e. a port range or list) for the current Rule
+func (a *Rule) SetDestinationPortSpec(ps PortSpec) error {
+	if !a.committed {
+		if err := ps.Validate(); err != nil {
+			return err
+		}
+		a.setDestPorts(ps)
+	}
+	return nil
 }
 
 // SetInterface sets the interface for the current Rule
@@ -115,12 +299,41 @@ func (a *Rule) SetAction(ac Action) {
 			a.Action = "pass"
 		case ActionBlock:
 			a.Action = "block"
-		case ActionUnknown:
-			a.Action = ""
+		case ActionMatch:
+			a.Action = "match"
+		case ActionAntispoof:
+			a.Action = "antispoof"
+		case ActionAnchor:
+			a.Action = "anchor"
 		default:
-			a.Action = "block"
+			a.Action = ""
+		}
+	}
+}
+
+// SetAnchor turns the current Rule into an anchor call that evaluates the rules of the given anchor
+// for all packets matching the Rule, i. e. anchor "web" in on em0 proto tcp. The anchor name is
+// relative to the anchor the Rule is loaded into and can end with the wildcard /*
+func (a *Rule) SetAnchor(n string) error {
+	if !a.committed {
+		if err := validateAnchorName(n, true); err != nil {
+			return err
+		}
+		a.Action = "anchor"
+		a.Anchor = n
+	}
+	return nil
+}
+
+// SetBlockPolicy sets the BlockPolicy (i. e. drop or return-rst) for the current block Rule
+func (a *Rule) SetBlockPolicy(p BlockPolicy) error {
+	if !a.committed {
+		if err := p.Validate(); err != nil {
+			return err
 		}
+		a.Block = p
 	}
+	return nil
 }
 
 // SetAddrFamily sets the address family for the current Rule
@@ -158,48 +371,518 @@ func (a *Rule) SetLogging() {
 	a.Log = true
 }
 
-// Commit commits the current Rule so it is immutable
+// SetLogOptions enables logging with the given LogOptions for the current Rule
+func (a *Rule) SetLogOptions(o LogOptions) {
+	if !a.committed {
+		a.Log = true
+		a.LogOpts = o
+	}
+}
+
+// SetFlags sets the TCP flags that the current Rule matches on, i. e. TCPFlags{Set: "S", Mask: "SA"}
+func (a *Rule) SetFlags(f TCPFlags) error {
+	if !a.committed {
+		if err := f.Validate(); err != nil {
+			return err
+		}
+		a.setFlags(f)
+	}
+	return nil
+}
+
+// SetState sets the state keyword (i. e. keep state or no state) for the current Rule
+func (a *Rule) SetState(m StateMode) {
+	if !a.committed {
+		a.setState(m, a.StateOpts)
+	}
+}
+
+// SetStateOptions sets the StateOptions for the current Rule. If no state keyword that takes
+// options has been set yet, the Rule is set to keep state
+func (a *Rule) SetStateOptions(o StateOptions) error {
+	if !a.committed {
+		if err := o.Validate(); err != nil {
+			return err
+		}
+		m, _ := a.state()
+		if m == StateDefault || m == StateNone {
+			m = StateKeep
+		}
+		a.setState(m, o)
+	}
+	return nil
+}
+
+// SetRoute sets the policy routing option (i. e. route-to or reply-to) for the current Rule
+func (a *Rule) SetRoute(o RouteOptions) error {
+	if !a.committed {
+		if err := o.Validate(); err != nil {
+			return err
+		}
+		a.Route = o
+	}
+	return nil
+}
+
+// SetLabel sets the label for the current Rule. The label can contain the macros $if, $srcaddr,
+// $dstaddr, $srcport, $dstport, $proto and $nr, which pfctl expands when loading the rule
+func (a *Rule) SetLabel(l string) error {
+	if !a.committed {
+		if err := validateLabel(l); err != nil {
+			return err
+		}
+		a.Label = l
+	}
+	return nil
+}
+
+// SetTag sets the tag that the current Rule attaches to matching packets
+func (a *Rule) SetTag(t string) error {
+	if !a.committed {
+		if err := validateTag(t); err != nil {
+			return err
+		}
+		a.Tag = t
+	}
+	return nil
+}
+
+// SetTagged restricts the current Rule to packets that have been tagged with the given tag
+func (a *Rule) SetTagged(t string) error {
+	if !a.committed {
+		if err := validateTag(t); err != nil {
+			return err
+		}
+		a.Tagged, a.NotTagged = t, false
+	}
+	return nil
+}
+
+// SetNotTagged restricts the current Rule to packets that have not been tagged with the given tag
+func (a *Rule) SetNotTagged(t string) error {
+	if err := a.SetTagged(t); err != nil {
+		return err
+	}
+	if !a.committed {
+		a.NotTagged = true
+	}
+	return nil
+}
+
+// SetQuick sets the quick option for the current Rule, so that rule evaluation stops when it matches
+func (a *Rule) SetQuick() {
+	if !a.committed {
+		a.Quick = true
+	}
+}
+
+// Commit commits the current Rule so it is immutable. If no address family has been set, it is
+// derived from the source and destination addresses
 func (a *Rule) Commit() {
+	if !a.committed && a.AdressFamily == "" {
+		a.AdressFamily = a.source().family()
+		if a.AdressFamily == "" {
+			a.AdressFamily = a.destination().family()
+		}
+	}
 	a.committed = true
 }
 
+// Validate checks the current Rule for inconsistencies that pfctl would reject, like source and
+// destination addresses of different address families
+func (a *Rule) Validate() error {
+	if err := a.validateLabels(); err != nil {
+		return err
+	}
+	if err := a.Block.Validate(); err != nil {
+		return err
+	}
+	if a.Block.Mode != BlockModeDefault && a.Action != "block" {
+		return fmt.Errorf("block policy %s is only valid for block rules", a.Block)
+	}
+	if a.Block.Mode == BlockModeReturnRST && a.Protocol != "" && a.Protocol != "tcp" {
+		return fmt.Errorf("return-rst is only valid for tcp")
+	}
+	if a.Action == "antispoof" {
+		return a.validateAntispoof()
+	}
+	if a.Action == "anchor" {
+		if err := a.validateAnchorCall(); err != nil {
+			return err
+		}
+	} else if a.Anchor != "" {
+		return fmt.Errorf("anchor name is only valid for anchor calls")
+	}
+	if a.StateMode == StateDefault && a.State != "" {
+		if _, _, err := parseStateString(a.State); err != nil {
+			return err
+		}
+	}
+	stateMode, stateOpts := a.state()
+	if a.Action == "match" && stateMode != StateDefault && stateMode != StateNone {
+		return fmt.Errorf("match rules cannot create state")
+	}
+	if err := a.validateHosts(); err != nil {
+		return err
+	}
+	if err := a.validateRoute(); err != nil {
+		return err
+	}
+	if err := a.flags().Validate(); err != nil {
+		return err
+	}
+	if !a.flags().isZero() && a.Protocol != "" && a.Protocol != "tcp" {
+		return fmt.Errorf("flags are only valid for tcp")
+	}
+	if stateMode == StateSynproxy && a.Protocol != "" && a.Protocol != "tcp" {
+		return fmt.Errorf("synproxy state is only valid for tcp")
+	}
+	if err := stateOpts.Validate(); err != nil {
+		return err
+	}
+	if !stateOpts.isZero() && (stateMode == StateDefault || stateMode == StateNone) {
+		return fmt.Errorf("state options require keep, modulate or synproxy state")
+	}
+	return nil
+}
+
+// validateLabels checks the label, tag and tagged options of the Rule
+func (a *Rule) validateLabels() error {
+	if err := validateLabel(a.Label); err != nil {
+		return err
+	}
+	for _, t := range []string{a.Tag, a.Tagged} {
+		if t == "" {
+			continue
+		}
+		if err := validateTag(t); err != nil {
+			return err
+		}
+	}
+	if a.NotTagged && a.Tagged == "" {
+		return fmt.Errorf("negated tagged option requires a tag")
+	}
+	return nil
+}
+
+// validateRoute checks that the policy routing option is only used on pass rules with an explicit
+// direction and that the gateways match the address family of the Rule
+func (a *Rule) validateRoute() error {
+	if a.Route.Type == RouteNone {
+		return nil
+	}
+	if err := a.Route.Validate(); err != nil {
+		return err
+	}
+	if a.Action != "pass" {
+		return fmt.Errorf("%s is only valid for pass rules", a.Route.Type)
+	}
+	if a.Direction == "" {
+		return fmt.Errorf("direction must be explicit with rules that specify routing")
+	}
+	if stateMode, _ := a.state(); a.Route.Type == RouteReplyTo && stateMode == StateNone {
+		return fmt.Errorf("reply-to requires a rule that creates state")
+	}
+	routeFam := a.Route.family()
+	for _, fam := range []string{a.AdressFamily, a.source().family(), a.destination().family()} {
+		if fam != "" && routeFam != "" && fam != routeFam {
+			return fmt.Errorf("address family of %s gateways does not match the %s rule", a.Route.Type, fam)
+		}
+	}
+	return nil
+}
+
+// validateHosts checks the address families, addresses and ports of the Rule. It is shared with the
+// translation rules, which use the same matching criteria
+func (a *Rule) validateHosts() error {
+	for _, e := range []Endpoint{a.source(), a.destination()} {
+		if err := e.Validate(); err != nil {
+			return err
+		}
+	}
+	if a.destination().has(AddrURPFFailed) {
+		return fmt.Errorf("urpf-failed is only valid as source address")
+	}
+	srcFam, dstFam := a.source().family(), a.destination().family()
+	if srcFam != "" && dstFam != "" && srcFam != dstFam {
+		return fmt.Errorf("source address %s and destination address %s are of different address families",
+			a.source(), a.destination())
+	}
+	for _, fam := range []string{srcFam, dstFam} {
+		if a.AdressFamily != "" && fam != "" && fam != a.AdressFamily {
+			return fmt.Errorf("rule address family %s does not match the %s addresses", a.AdressFamily, fam)
+		}
+	}
+	srcPorts, dstPorts := a.sourcePorts(), a.destPorts()
+	if (len(srcPorts) > 0 || len(dstPorts) > 0) && a.Protocol != "tcp" && a.Protocol != "udp" {
+		return fmt.Errorf("port specifications are only valid for tcp and udp")
+	}
+	for _, ps := range []PortSpec{srcPorts, dstPorts} {
+		if err := ps.Validate(); err != nil {
+			return err
+		}
+	}
+	if (a.Protocol == "icmp" && a.AdressFamily == "inet6") || (a.Protocol == "icmp6" && a.AdressFamily == "inet") {
+		return fmt.Errorf("protocol %s is not valid for address family %s", a.Protocol, a.AdressFamily)
+	}
+	return nil
+}
+
+// validateAntispoof checks that an antispoof Rule has an interface and only uses the options
+// that are valid for antispoof
+func (a *Rule) validateAntispoof() error {
+	if a.Interface == "" {
+		return fmt.Errorf("antispoof requires an interface")
+	}
+	stateMode, stateOpts := a.state()
+	if a.Direction != "" || a.Protocol != "" || len(a.source()) > 0 || len(a.destination()) > 0 ||
+		len(a.sourcePorts()) > 0 || len(a.destPorts()) > 0 || !a.flags().isZero() || stateMode != StateDefault ||
+		!stateOpts.isZero() || a.Tag != "" || a.Tagged != "" {
+		return fmt.Errorf("antispoof only supports log, quick, an address family and a label")
+	}
+	return nil
+}
+
+// validateAnchorCall checks that an anchor call Rule references a valid anchor and only uses the
+// options that are valid for anchor calls
+func (a *Rule) validateAnchorCall() error {
+	if err := validateAnchorName(a.Anchor, true); err != nil {
+		return err
+	}
+	stateMode, stateOpts := a.state()
+	if a.Log || a.Route.Type != RouteNone || stateMode != StateDefault || !stateOpts.isZero() {
+		return fmt.Errorf("anchor calls do not take log, routing or state options")
+	}
+	return nil
+}
+
 // String parses a given Rule and returns the full rule as string
 func (a *Rule) String() string {
+	if a.Action == "antispoof" {
+		return a.antispoofString()
+	}
 	var fwRule string
 	if a.Action != "" {
 		fwRule = a.Action
 	}
+	if a.Action == "anchor" {
+		fwRule = fmt.Sprintf("%s \"%s\"", fwRule, a.Anchor)
+	}
+	if a.Block.Mode != BlockModeDefault {
+		fwRule = fmt.Sprintf("%s %s", fwRule, a.Block)
+	}
 	if a.Direction != "" {
 		fwRule = fmt.Sprintf("%s %s", fwRule, a.Direction)
 	}
 	if a.Log {
-		fwRule = fmt.Sprintf("%s log", fwRule)
+		fwRule = fmt.Sprintf("%s %s", fwRule, a.logString())
+	}
+	if a.Quick {
+		fwRule = fmt.Sprintf("%s quick", fwRule)
+	}
+	fwRule = fmt.Sprintf("%s %s", fwRule, a.hostsString())
+	if flags := a.flags(); !flags.isZero() {
+		fwRule = fmt.Sprintf("%s flags %s", fwRule, flags)
+	}
+	if stateMode, stateOpts := a.state(); stateMode != StateDefault {
+		fwRule = fmt.Sprintf("%s %s", fwRule, stateString(stateMode, stateOpts))
+	}
+	if a.Label != "" {
+		fwRule = fmt.Sprintf("%s label \"%s\"", fwRule, a.Label)
+	}
+	if a.Tag != "" {
+		fwRule = fmt.Sprintf("%s tag %s", fwRule, a.Tag)
+	}
+	if a.NotTagged {
+		fwRule = fmt.Sprintf("%s !", fwRule)
+	}
+	if a.Tagged != "" {
+		fwRule = fmt.Sprintf("%s tagged %s", fwRule, a.Tagged)
+	}
+
+	return fwRule
+}
+
+// antispoofString returns an antispoof Rule in pf syntax
+func (a *Rule) antispoofString() string {
+	fwRule := a.Action
+	if a.Log {
+		fwRule = fmt.Sprintf("%s %s", fwRule, a.logString())
+	}
+	if a.Quick {
+		fwRule = fmt.Sprintf("%s quick", fwRule)
+	}
+	fwRule = fmt.Sprintf("%s for %s", fwRule, a.Interface)
+	if a.AdressFamily != "" {
+		fwRule = fmt.Sprintf("%s %s", fwRule, a.AdressFamily)
+	}
+	if a.Label != "" {
+		fwRule = fmt.Sprintf("%s label \"%s\"", fwRule, a.Label)
+	}
+	return fwRule
+}
+
+// logString returns the log keyword of the Rule with its options in pf syntax
+func (a *Rule) logString() string {
+	if logOpts := a.LogOpts.String(); logOpts != "" {
+		return fmt.Sprintf("log (%s)", logOpts)
 	}
+	return "log"
+}
+
+// hostsString returns the interface, routing option, address family, protocol, source and destination of the Rule
+// in pf syntax. It is shared with the translation rules, which use the same matching criteria
+func (a *Rule) hostsString() string {
+	hostArray := make([]string, 0)
 	if a.Interface != "" {
-		fwRule = fmt.Sprintf("%s on %s", fwRule, a.Interface)
+		hostArray = append(hostArray, fmt.Sprintf("on %s", a.Interface))
+	}
+	if a.Route.Type != RouteNone {
+		hostArray = append(hostArray, a.Route.String())
 	}
 	if a.AdressFamily != "" {
-		fwRule = fmt.Sprintf("%s on %s", fwRule, a.Interface)
+		hostArray = append(hostArray, a.AdressFamily)
 	}
 	if a.Protocol != "" {
-		fwRule = fmt.Sprintf("%s proto %s", fwRule, a.Protocol)
+		hostArray = append(hostArray, fmt.Sprintf("proto %s", a.Protocol))
+	}
+	hostArray = append(hostArray, fmt.Sprintf("from %s", a.source()))
+	if srcPorts := a.sourcePorts(); len(srcPorts) > 0 {
+		hostArray = append(hostArray, fmt.Sprintf("port %s", srcPorts))
+	}
+	hostArray = append(hostArray, fmt.Sprintf("to %s", a.destination()))
+	if dstPorts := a.destPorts(); len(dstPorts) > 0 {
+		hostArray = append(hostArray, fmt.Sprintf("port %s", dstPorts))
+	}
+	return strings.Join(hostArray, " ")
+}
+
+// source returns the source Endpoint of the Rule. Without SourceAddrs, the single Source network is used
+func (a *Rule) source() Endpoint {
+	if len(a.SourceAddrs) > 0 || a.Source == nil {
+		return a.SourceAddrs
+	}
+	return Endpoint{NetworkAddr(a.Source)}
+}
+
+// destination returns the destination Endpoint of the Rule. Without DestAddrs, the single
+// Destination network is used
+func (a *Rule) destination() Endpoint {
+	if len(a.DestAddrs) > 0 || a.Destination == nil {
+		return a.DestAddrs
+	}
+	return Endpoint{NetworkAddr(a.Destination)}
+}
+
+// setSource sets the source Endpoint of the Rule and its single network representation
+func (a *Rule) setSource(ep Endpoint) {
+	a.SourceAddrs, a.Source = ep, ep.network()
+}
+
+// setDestination sets the destination Endpoint of the Rule and its single network representation
+func (a *Rule) setDestination(ep Endpoint) {
+	a.DestAddrs, a.Destination = ep, ep.network()
+}
+
+// sourcePorts returns the source PortSpec of the Rule. Without SourcePorts, the single SourcePort is used
+func (a *Rule) sourcePorts() PortSpec {
+	if len(a.SourcePorts) > 0 {
+		return a.SourcePorts
+	}
+	return portSpec(a.SourcePort)
+}
+
+// destPorts returns the destination PortSpec of the Rule. Without DestPorts, the single DestPort is used
+func (a *Rule) destPorts() PortSpec {
+	if len(a.DestPorts) > 0 {
+		return a.DestPorts
+	}
+	return portSpec(a.DestPort)
+}
+
+// setSourcePorts sets the source PortSpec of the Rule and its single port number representation
+func (a *Rule) setSourcePorts(ps PortSpec) {
+	a.SourcePorts, a.SourcePort = ps, ps.number()
+}
+
+// setDestPorts sets the destination PortSpec of the Rule and its single port number representation
+func (a *Rule) setDestPorts(ps PortSpec) {
+	a.DestPorts, a.DestPort = ps, ps.number()
+}
+
+// expandLists returns the Rules that pfctl loads for the Rule: one Rule for every combination of the
+// items of its address and port lists, in the order of the pfctl rule expansion. Combinations of
+// addresses of different address families are skipped, as pfctl does
+func (a *Rule) expandLists() []Rule {
+	ruleArray := make([]Rule, 0)
+	for _, src := range splitEndpoint(a.source()) {
+		for _, srcPort := range splitPortSpec(a.sourcePorts()) {
+			for _, dst := range splitEndpoint(a.destination()) {
+				if !familiesMatch(a.AdressFamily, src.family(), dst.family()) {
+					continue
+				}
+				for _, dstPort := range splitPortSpec(a.destPorts()) {
+					r := *a
+					r.setSource(src)
+					r.setSourcePorts(srcPort)
+					r.setDestination(dst)
+					r.setDestPorts(dstPort)
+					ruleArray = append(ruleArray, r)
+				}
+			}
+		}
 	}
-	if a.Source != nil {
-		fwRule = fmt.Sprintf("%s from %s", fwRule, a.Source.String())
-	} else {
-		fwRule = fmt.Sprintf("%s from any", fwRule)
+	return ruleArray
+}
+
+// flags returns the TCP flags of the Rule. Without TCPFlags, the Flags string is parsed
+func (a *Rule) flags() TCPFlags {
+	if !a.TCPFlags.isZero() || a.Flags == "" {
+		return a.TCPFlags
 	}
-	if a.SourcePort > 0 {
-		fwRule = fmt.Sprintf("%s port %d", fwRule, a.SourcePort)
+	return parseTCPFlags(a.Flags)
+}
+
+// state returns the state keyword and the state options of the Rule. Without StateMode, the State
+// string is parsed. If it has no options, StateOpts is used
+func (a *Rule) state() (StateMode, StateOptions) {
+	if a.StateMode != StateDefault || a.State == "" {
+		return a.StateMode, a.StateOpts
 	}
-	if a.Destination != nil {
-		fwRule = fmt.Sprintf("%s to %s", fwRule, a.Destination.String())
-	} else {
-		fwRule = fmt.Sprintf("%s to any", fwRule)
+	m, o, err := parseStateString(a.State)
+	if err != nil {
+		return StateDefault, a.StateOpts
 	}
-	if a.DestPort > 0 {
-		fwRule = fmt.Sprintf("%s port %d", fwRule, a.DestPort)
+	if o.isZero() {
+		o = a.StateOpts
 	}
+	return m, o
+}
 
-	return fwRule
+// setFlags sets the TCPFlags of the Rule and their Flags string representation
+func (a *Rule) setFlags(f TCPFlags) {
+	a.TCPFlags, a.Flags = f, f.String()
+}
+
+// setState sets the StateMode and StateOptions of the Rule and their State string representation
+func (a *Rule) setState(m StateMode, o StateOptions) {
+	a.StateMode, a.StateOpts, a.State = m, o, stateString(m, o)
+}
+
+// String returns the LogOptions in pf syntax without the surrounding parentheses
+func (o LogOptions) String() string {
+	optArray := make([]string, 0)
+	if o.All {
+		optArray = append(optArray, "all")
+	}
+	if o.Matches {
+		optArray = append(optArray, "matches")
+	}
+	if o.User {
+		optArray = append(optArray, "user")
+	}
+	if o.To != "" {
+		optArray = append(optArray, fmt.Sprintf("to %s", o.To))
+	}
+	return strings.Join(optArray, ", ")
 }
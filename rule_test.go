@@ -0,0 +1,652 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package pf
+
+import (
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+// testNetwork returns the IPNet of the given IP address or CIDR network for the use in test tables
+func testNetwork(s string) *net.IPNet {
+	ipNet, err := parseTableAddr(s)
+	if err != nil {
+		panic(err)
+	}
+	return ipNet
+}
+
+// TestRule_SetIP tests the IPv4 and IPv6 address handling of the Rule setters
+func TestRule_SetIP(t *testing.T) {
+	testTable := []struct {
+		testName string
+		ip       string
+		mask     []string
+		want     string
+		family   string
+	}{
+		{"IPv4 host", "192.0.2.1", nil, "192.0.2.1/32", "inet"},
+		{"IPv4 full netmask", "192.0.2.0", []string{"255.255.255.0"}, "192.0.2.0/24", "inet"},
+		{"IPv4 prefix length", "192.0.2.0", []string{"24"}, "192.0.2.0/24", "inet"},
+		{"IPv6 host", "2001:db8::1", nil, "2001:db8::1/128", "inet6"},
+		{"IPv6 prefix length", "2001:db8::", []string{"48"}, "2001:db8::/48", "inet6"},
+		{"IPv6 full netmask", "2001:db8::", []string{"ffff:ffff:ffff:ffff::"}, "2001:db8::/64", "inet6"},
+		{"IPv6 with IPv4 netmask", "2001:db8::1", []string{"255.255.255.0"}, "", ""},
+		{"IPv4 with IPv6 netmask", "192.0.2.0", []string{"ffff:ffff::"}, "", ""},
+		{"Non-contiguous netmask", "192.0.2.1", []string{"255.0.255.0"}, "", ""},
+		{"Invalid prefix length", "192.0.2.0", []string{"2x"}, "", ""},
+		{"Prefix length out of range", "192.0.2.0", []string{"33"}, "", ""},
+		{"Invalid IP", "192.0.2", nil, "", ""},
+	}
+	for _, testCase := range testTable {
+		t.Run(testCase.testName, func(t *testing.T) {
+			ar := Rule{}
+			err := ar.SetSourceIP(testCase.ip, testCase.mask...)
+			if testCase.want == "" {
+				if err == nil {
+					t.Errorf("SetSourceIP was supposed to fail, got: %s", ar.Source)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SetSourceIP failed: %s", err)
+			}
+			if ar.Source.String() != testCase.want {
+				t.Errorf("unexpected source. Expected: %s, got: %s", testCase.want, ar.Source)
+			}
+			ar.Commit()
+			if ar.AdressFamily != testCase.family {
+				t.Errorf("unexpected address family. Expected: %s, got: %s", testCase.family, ar.AdressFamily)
+			}
+		})
+	}
+}
+
+// TestRule_Validate tests the validation of address families
+func TestRule_Validate(t *testing.T) {
+	ar := Rule{}
+	_ = ar.SetSourceIP("192.0.2.1")
+	if err := ar.SetDestinationCIDR("2001:db8::/32"); err == nil {
+		t.Errorf("SetDestinationCIDR with mixed address families was supposed to fail")
+	}
+	if err := ar.SetDestinationIP("2001:db8::1"); err == nil {
+		t.Errorf("SetDestinationIP with mixed address families was supposed to fail")
+	}
+	ar.Destination = testNetwork("2001:db8::1")
+	if err := ar.Validate(); err == nil {
+		t.Errorf("Validate with mixed address families was supposed to fail")
+	}
+
+	ar = Rule{}
+	ar.SetAddrFamily(AdressFamilyInetv6)
+	ar.SetProtocol(ProtocolIcmp)
+	if err := ar.Validate(); err == nil {
+		t.Errorf("Validate with icmp for inet6 was supposed to fail")
+	}
+
+	ar = Rule{}
+	ar.SetAction(ActionPass)
+	_ = ar.SetDestinationIP("2001:db8::1")
+	ar.Commit()
+	if err := ar.Validate(); err != nil {
+		t.Errorf("Validate failed: %s", err)
+	}
+	if ar.String() != "pass inet6 from any to 2001:db8::1/128" {
+		t.Errorf("unexpected rule: %s", ar.String())
+	}
+}
+
+// TestRule_SetPrefix tests the netip based Rule setters
+func TestRule_SetPrefix(t *testing.T) {
+	ar := Rule{}
+	if err := ar.SetSourceAddr(netip.MustParseAddr("::ffff:192.0.2.1")); err != nil {
+		t.Fatalf("SetSourceAddr failed: %s", err)
+	}
+	if ar.Source.String() != "192.0.2.1/32" {
+		t.Errorf("unexpected source. Expected: 192.0.2.1/32, got: %s", ar.Source)
+	}
+	if err := ar.SetDestinationPrefix(netip.MustParsePrefix("2001:db8::/32")); err == nil {
+		t.Errorf("SetDestinationPrefix with mixed address families was supposed to fail")
+	}
+	if err := ar.SetDestinationPrefix(netip.MustParsePrefix("198.51.100.0/24")); err != nil {
+		t.Errorf("SetDestinationPrefix failed: %s", err)
+	}
+	if err := ar.SetSourceAddr(netip.Addr{}); err == nil {
+		t.Errorf("SetSourceAddr with invalid address was supposed to fail")
+	}
+	if ar.Destination.String() != "198.51.100.0/24" {
+		t.Errorf("unexpected destination. Expected: 198.51.100.0/24, got: %s", ar.Destination)
+	}
+}
+
+// TestRule_SetEndpoint tests the Endpoint based Rule setters
+func TestRule_SetEndpoint(t *testing.T) {
+	testTable := []struct {
+		testName   string
+		source     []Address
+		dest       []Address
+		want       string
+		shouldFail bool
+	}{
+		{"Table", []Address{TableAddr("bruteforce")}, nil, "block from <bruteforce> to any", false},
+		{"Negated network", nil, []Address{NetworkAddr(testNetwork("10.0.0.0/8")).Not()},
+			"block inet from any to ! 10.0.0.0/8", false},
+		{"List", []Address{NetworkAddr(testNetwork("192.0.2.1")), TableAddr("trusted")}, []Address{SelfAddr()},
+			"block from { 192.0.2.1/32 <trusted> } to self", false},
+		{"Interface", []Address{InterfaceAddr("em0", "network")}, []Address{DynamicInterfaceAddr("em1")},
+			"block from em0:network to (em1)", false},
+		{"urpf-failed", []Address{URPFFailedAddr()}, []Address{NoRouteAddr()},
+			"block from urpf-failed to no-route", false},
+		{"urpf-failed destination", nil, []Address{URPFFailedAddr()}, "", true},
+		{"Invalid table name", []Address{TableAddr("bad table")}, nil, "", true},
+		{"Invalid modifier", []Address{InterfaceAddr("em0", "foo")}, nil, "", true},
+		{"Missing network", []Address{{Kind: AddrNetwork}}, nil, "", true},
+		{"Mixed address families", []Address{NetworkAddr(testNetwork("192.0.2.1"))},
+			[]Address{NetworkAddr(testNetwork("2001:db8::1"))}, "", true},
+	}
+	for _, testCase := range testTable {
+		t.Run(testCase.testName, func(t *testing.T) {
+			ar := Rule{}
+			ar.SetAction(ActionBlock)
+			err := ar.SetSource(testCase.source...)
+			if err == nil {
+				err = ar.SetDestination(testCase.dest...)
+			}
+			if err != nil {
+				if !testCase.shouldFail {
+					t.Errorf("setting the endpoints failed: %s", err)
+				}
+				return
+			}
+			if testCase.shouldFail {
+				t.Errorf("setting the endpoints was supposed to fail")
+			}
+			ar.Commit()
+			if ar.String() != testCase.want {
+				t.Errorf("unexpected rule. Expected: %q, got: %q", testCase.want, ar.String())
+			}
+		})
+	}
+}
+
+// TestRule_SetStateOptions tests the stateful filtering options of a Rule
+func TestRule_SetStateOptions(t *testing.T) {
+	ar := Rule{}
+	ar.SetAction(ActionPass)
+	ar.SetDirection(DirectionIn)
+	ar.SetQuick()
+	ar.SetProtocol(ProtocolTcp)
+	if err := ar.SetFlags(TCPFlags{Set: "S", Mask: "SA"}); err != nil {
+		t.Errorf("SetFlags failed: %s", err)
+	}
+	if err := ar.SetStateOptions(StateOptions{Max: 1000, MaxSrcNodes: 50, Overload: "bruteforce",
+		OverloadFlush: true, Binding: "floating", Timeouts: []StateTimeout{{Name: "tcp.first", Seconds: 30}}}); err != nil {
+		t.Errorf("SetStateOptions failed: %s", err)
+	}
+	want := "pass in quick proto tcp from any to any flags S/SA keep state (max 1000, max-src-nodes 50, " +
+		"overload <bruteforce> flush, floating, tcp.first 30)"
+	if ar.String() != want {
+		t.Errorf("unexpected rule. Expected: %q, got: %q", want, ar.String())
+	}
+	ar.SetState(StateModulate)
+	if err := ar.Validate(); err != nil {
+		t.Errorf("Validate failed: %s", err)
+	}
+	ar.SetState(StateNone)
+	if err := ar.Validate(); err == nil {
+		t.Errorf("Validate with state options and no state was supposed to fail")
+	}
+
+	if err := ar.SetFlags(TCPFlags{Set: "S", Mask: "SA", Any: true}); err == nil {
+		t.Errorf("SetFlags with flags any and a mask was supposed to fail")
+	}
+	if err := ar.SetStateOptions(StateOptions{SourceTrack: "host"}); err == nil {
+		t.Errorf("SetStateOptions with invalid source-track mode was supposed to fail")
+	}
+	if err := ar.SetStateOptions(StateOptions{Timeouts: []StateTimeout{{Name: "tcp.foo", Seconds: 1}}}); err == nil {
+		t.Errorf("SetStateOptions with unknown timeout was supposed to fail")
+	}
+}
+
+// TestRule_SetBlockPolicy tests the block policies and actions of a Rule
+func TestRule_SetBlockPolicy(t *testing.T) {
+	testTable := []struct {
+		testName   string
+		policy     string
+		want       BlockPolicy
+		shouldFail bool
+	}{
+		{"Drop", "drop", BlockPolicy{Mode: BlockModeDrop}, false},
+		{"Return", "return", BlockPolicy{Mode: BlockModeReturn}, false},
+		{"Return-rst with ttl", "return-rst (ttl 5)", BlockPolicy{Mode: BlockModeReturnRST, TTL: 5}, false},
+		{"Return-icmp", "return-icmp (host-unr)", BlockPolicy{Mode: BlockModeReturnICMP, ICMPCode: "host-unr"}, false},
+		{"Return-icmp6", "return-icmp6 (port-unr)", BlockPolicy{Mode: BlockModeReturnICMP6, ICMP6Code: "port-unr"}, false},
+		{"Invalid icmp code", "return-icmp (300)", BlockPolicy{}, true},
+		{"Missing ttl", "return-rst (64)", BlockPolicy{}, true},
+		{"Trailing token", "drop in", BlockPolicy{}, true},
+	}
+	for _, testCase := range testTable {
+		t.Run(testCase.testName, func(t *testing.T) {
+			bp, err := ParseBlockPolicy(testCase.policy)
+			if err != nil {
+				if !testCase.shouldFail {
+					t.Errorf("ParseBlockPolicy failed: %s", err)
+				}
+				return
+			}
+			if testCase.shouldFail {
+				t.Errorf("ParseBlockPolicy was supposed to fail")
+			}
+			if bp != testCase.want {
+				t.Errorf("unexpected block policy. Expected: %+v, got: %+v", testCase.want, bp)
+			}
+			if bp.String() != testCase.policy {
+				t.Errorf("unexpected block policy string. Expected: %q, got: %q", testCase.policy, bp.String())
+			}
+		})
+	}
+
+	ar := Rule{}
+	ar.SetAction(Action(42))
+	if ar.Action != "" {
+		t.Errorf("SetAction with unknown action was supposed to reset the action, got: %s", ar.Action)
+	}
+	ar.SetAction(ParseAction("block return"))
+	if err := ar.SetBlockPolicy(BlockPolicy{Mode: BlockModeReturnRST, ICMPCode: "port-unr"}); err == nil {
+		t.Errorf("SetBlockPolicy with icmp code for return-rst was supposed to fail")
+	}
+	if err := ar.SetBlockPolicy(BlockPolicy{Mode: BlockModeReturn}); err != nil {
+		t.Errorf("SetBlockPolicy failed: %s", err)
+	}
+	if ar.String() != "block return from any to any" {
+		t.Errorf("unexpected rule: %s", ar.String())
+	}
+	ar.SetAction(ActionPass)
+	if err := ar.Validate(); err == nil {
+		t.Errorf("Validate with block policy for pass rule was supposed to fail")
+	}
+	for _, a := range []Action{ActionPass, ActionBlock, ActionMatch, ActionAntispoof, ActionAnchor} {
+		if ParseAction(a.String()) != a {
+			t.Errorf("ParseAction(%q) did not return %d", a, a)
+		}
+	}
+	for _, a := range []string{"block return-rst (port-unr)", "pass return", "block foo", "", "nat"} {
+		if ParseAction(a) != ActionUnknown {
+			t.Errorf("ParseAction(%q) was supposed to return ActionUnknown", a)
+		}
+	}
+	ac, bp, err := ParseActionPolicy("block return-icmp (port-unr)")
+	if err != nil {
+		t.Fatalf("ParseActionPolicy failed: %s", err)
+	}
+	if ac != ActionBlock || bp.Mode != BlockModeReturnICMP || bp.ICMPCode != "port-unr" {
+		t.Errorf("unexpected action or block policy: %s, %+v", ac, bp)
+	}
+}
+
+// TestRule_SetRoute tests the policy routing options of a Rule
+func TestRule_SetRoute(t *testing.T) {
+	gw1, err := RouteGateway("em0", netip.MustParseAddr("192.0.2.1"))
+	if err != nil {
+		t.Fatalf("RouteGateway failed: %s", err)
+	}
+	gw2, err := RouteGateway("em1", netip.MustParseAddr("198.51.100.1"))
+	if err != nil {
+		t.Fatalf("RouteGateway failed: %s", err)
+	}
+	if _, err := RouteGateway("em0", netip.Addr{}); err == nil {
+		t.Errorf("RouteGateway with invalid address was supposed to fail")
+	}
+
+	ar := Rule{}
+	ar.SetAction(ActionPass)
+	ar.SetDirection(DirectionOut)
+	ar.SetInterface("em2")
+	if err := ar.SetRoute(RouteOptions{Type: RouteTo, Hosts: []RouteHost{gw1, gw2}}); err == nil {
+		t.Errorf("SetRoute with two gateways and without round-robin was supposed to fail")
+	}
+	if err := ar.SetRoute(RouteOptions{Type: RouteTo, Hosts: []RouteHost{gw1, gw2},
+		Pool: PoolOptions{Type: PoolRoundRobin}}); err != nil {
+		t.Errorf("SetRoute failed: %s", err)
+	}
+	want := "pass out on em2 route-to { (em0 192.0.2.1), (em1 198.51.100.1) } round-robin from any to any"
+	if ar.String() != want {
+		t.Errorf("unexpected rule. Expected: %q, got: %q", want, ar.String())
+	}
+
+	// Swapping the gateway of a rule, as a failover controller would do
+	if err := ar.SetRoute(RouteOptions{Type: RouteTo, Hosts: []RouteHost{gw2}}); err != nil {
+		t.Errorf("SetRoute failed: %s", err)
+	}
+	ar.Commit()
+	if err := ar.Validate(); err != nil {
+		t.Errorf("Validate failed: %s", err)
+	}
+	if ar.String() != "pass out on em2 route-to (em1 198.51.100.1) from any to any" {
+		t.Errorf("unexpected rule: %s", ar.String())
+	}
+
+	if err := (RouteOptions{Type: RouteReplyTo}).Validate(); err == nil {
+		t.Errorf("Validate of reply-to without gateway was supposed to fail")
+	}
+	netGw := RouteHost{Interface: "em1", Address: testNetwork("198.51.100.0/24")}
+	if err := (RouteOptions{Type: RouteTo, Hosts: []RouteHost{netGw}}).Validate(); err == nil {
+		t.Errorf("Validate of route-to with a network as gateway was supposed to fail")
+	}
+	if err := (RouteOptions{Hosts: []RouteHost{gw1}}).Validate(); err == nil {
+		t.Errorf("Validate of gateways without route type was supposed to fail")
+	}
+}
+
+// TestRule_ExpandLabel tests the label macro expansion of a Rule
+func TestRule_ExpandLabel(t *testing.T) {
+	testTable := []struct {
+		testName string
+		label    string
+		want     string
+	}{
+		{"No macros", "web", "web"},
+		{"Interface", "$if-in", "em0-in"},
+		{"Addresses", "$srcaddr to $dstaddr", "any to 192.0.2.0/24"},
+		{"Ports and protocol", "$proto:$srcport:$dstport", "tcp::"},
+		{"Rule number", "rule-$nr", "rule-7"},
+		{"Literal dollar", "cost $5", "cost $5"},
+	}
+	for _, testCase := range testTable {
+		t.Run(testCase.testName, func(t *testing.T) {
+			ar := Rule{}
+			ar.SetAction(ActionPass)
+			ar.SetInterface("em0")
+			ar.SetProtocol(ProtocolTcp)
+			if err := ar.SetDestinationCIDR("192.0.2.0/24"); err != nil {
+				t.Fatalf("SetDestinationCIDR failed: %s", err)
+			}
+			if err := ar.SetDestinationPortSpec(PortRangeSpec(8000, 8100)); err != nil {
+				t.Fatalf("SetDestinationPortSpec failed: %s", err)
+			}
+			if err := ar.SetLabel(testCase.label); err != nil {
+				t.Fatalf("SetLabel failed: %s", err)
+			}
+			if ar.ExpandLabel(7) != testCase.want {
+				t.Errorf("unexpected label. Expected: %q, got: %q", testCase.want, ar.ExpandLabel(7))
+			}
+		})
+	}
+
+	ar := Rule{}
+	_ = ar.SetSourceIP("192.0.2.1")
+	_ = ar.SetLabel("$srcaddr")
+	if ar.ExpandLabel(0) != "192.0.2.1" {
+		t.Errorf("unexpected label for host address: %q", ar.ExpandLabel(0))
+	}
+
+	// pfctl loads one rule per list item, with service names resolved to port numbers
+	lr, err := ParseRule(`pass in proto tcp from { 192.0.2.0/24 2001:db8::/32 } to ! 198.51.100.0/24 ` +
+		`port { 22 8000 >< 8100 } label "$nr:$srcaddr:$dstaddr:$dstport"`)
+	if err != nil {
+		t.Fatalf("ParseRule failed: %s", err)
+	}
+	want := []string{"3:192.0.2.0/24:! 198.51.100.0/24:22", "4:192.0.2.0/24:! 198.51.100.0/24:8000><8100"}
+	if labelArray := lr.ExpandLabels(3); strings.Join(labelArray, ",") != strings.Join(want, ",") {
+		t.Errorf("unexpected labels. Expected: %q, got: %q", want, labelArray)
+	}
+	lr, err = ParseRule(`pass in inet6 proto udp to port domain label "$proto:$dstport"`)
+	if err != nil {
+		t.Fatalf("ParseRule failed: %s", err)
+	}
+	if lr.ExpandLabel(0) != "udp:53" {
+		t.Errorf("unexpected label for service name: %q", lr.ExpandLabel(0))
+	}
+	lr = Rule{Action: "pass", Protocol: "icmp6", Label: "$proto"}
+	if lr.ExpandLabel(0) != "ipv6-icmp" {
+		t.Errorf("unexpected label for protocol icmp6: %q", lr.ExpandLabel(0))
+	}
+	for _, l := range []string{"$iface", "with \"quote\"", strings.Repeat("x", 64)} {
+		if err := ar.SetLabel(l); err == nil {
+			t.Errorf("SetLabel with label %q was supposed to fail", l)
+		}
+	}
+}
+
+// TestRule_SetTagged tests the tag and tagged options of a Rule
+func TestRule_SetTagged(t *testing.T) {
+	ar := Rule{}
+	ar.SetAction(ActionPass)
+	ar.SetDirection(DirectionIn)
+	if err := ar.SetTag("WEB"); err != nil {
+		t.Errorf("SetTag failed: %s", err)
+	}
+	if err := ar.SetNotTagged("SPAM"); err != nil {
+		t.Errorf("SetNotTagged failed: %s", err)
+	}
+	if ar.String() != "pass in from any to any tag WEB ! tagged SPAM" {
+		t.Errorf("unexpected rule: %s", ar.String())
+	}
+	if err := ar.SetTagged("MAIL"); err != nil {
+		t.Errorf("SetTagged failed: %s", err)
+	}
+	if ar.String() != "pass in from any to any tag WEB tagged MAIL" {
+		t.Errorf("unexpected rule: %s", ar.String())
+	}
+	for _, tag := range []string{"", "with space", strings.Repeat("x", 64)} {
+		if err := ar.SetTag(tag); err == nil {
+			t.Errorf("SetTag with tag %q was supposed to fail", tag)
+		}
+	}
+}
+
+// TestRule_SetAnchor tests anchor call rules and the validation of anchor names
+func TestRule_SetAnchor(t *testing.T) {
+	testTable := []struct {
+		testName   string
+		anchor     string
+		want       string
+		shouldFail bool
+	}{
+		{"Child anchor", "web", "anchor \"web\" in on em0 proto tcp from any to any", false},
+		{"Nested anchor", "outer/inner", "anchor \"outer/inner\" in on em0 proto tcp from any to any", false},
+		{"Wildcard", "outer/*", "anchor \"outer/*\" in on em0 proto tcp from any to any", false},
+		{"Empty name", "", "", true},
+		{"Reserved name", "_pf", "", true},
+		{"Empty component", "outer//inner", "", true},
+		{"Quote", "we\"b", "", true},
+	}
+	for _, testCase := range testTable {
+		t.Run(testCase.testName, func(t *testing.T) {
+			ar := Rule{}
+			ar.SetDirection(DirectionIn)
+			ar.SetInterface("em0")
+			ar.SetProtocol(ProtocolTcp)
+			err := ar.SetAnchor(testCase.anchor)
+			if err != nil && !testCase.shouldFail {
+				t.Fatalf("SetAnchor failed: %s", err)
+			}
+			if err == nil && testCase.shouldFail {
+				t.Fatalf("SetAnchor was supposed to fail, but didn't")
+			}
+			if testCase.shouldFail {
+				return
+			}
+			if err := ar.Validate(); err != nil {
+				t.Errorf("Validate failed: %s", err)
+			}
+			if ar.String() != testCase.want {
+				t.Errorf("unexpected rule. Expected: %s, got: %s", testCase.want, ar.String())
+			}
+		})
+	}
+
+	ar := Rule{}
+	ar.SetAction(ActionPass)
+	ar.Anchor = "web"
+	if err := ar.Validate(); err == nil {
+		t.Errorf("Validate of pass rule with anchor name was supposed to fail")
+	}
+	ar = Rule{}
+	_ = ar.SetAnchor("web")
+	ar.SetState(StateKeep)
+	if err := ar.Validate(); err == nil {
+		t.Errorf("Validate of anchor call with state was supposed to fail")
+	}
+}
+
+// TestPortSpec tests the rendering and validation of port specifications
+func TestPortSpec(t *testing.T) {
+	testTable := []struct {
+		testName   string
+		spec       PortSpec
+		want       string
+		shouldFail bool
+	}{
+		{"Single port", Port(22), "22", false},
+		{"Port list", Ports(80, 443), "{ 80 443 }", false},
+		{"Port range", PortRangeSpec(8000, 8100), "8000:8100", false},
+		{"Unary operator", PortSpec{{Op: PortOpGreater, From: "1024"}}, "> 1024", false},
+		{"Not equal", PortSpec{{Op: PortOpNotEqual, From: "22"}}, "!= 22", false},
+		{"Service name", PortSpec{{Op: PortOpEqual, From: "ssh"}}, "ssh", false},
+		{"Except range", PortSpec{{Op: PortOpExceptRange, From: "1", To: "1023"}}, "1 <> 1023", false},
+		{"Invalid port", PortSpec{{Op: PortOpEqual, From: "70000"}}, "", true},
+		{"Missing second port", PortSpec{{Op: PortOpExclusiveRange, From: "1"}}, "", true},
+		{"Unary with second port", PortSpec{{Op: PortOpLess, From: "1", To: "2"}}, "", true},
+	}
+	for _, testCase := range testTable {
+		t.Run(testCase.testName, func(t *testing.T) {
+			if err := testCase.spec.Validate(); err != nil {
+				if !testCase.shouldFail {
+					t.Errorf("Validate failed: %s", err)
+				}
+				return
+			}
+			if testCase.shouldFail {
+				t.Errorf("Validate was supposed to fail")
+			}
+			if testCase.spec.String() != testCase.want {
+				t.Errorf("unexpected port spec. Expected: %q, got: %q", testCase.want, testCase.spec.String())
+			}
+			ps, err := ParsePortSpec(testCase.want)
+			if err != nil {
+				t.Fatalf("ParsePortSpec failed: %s", err)
+			}
+			if ps.String() != testCase.want {
+				t.Errorf("unexpected parsed port spec. Expected: %q, got: %q", testCase.want, ps.String())
+			}
+		})
+	}
+
+	ar := Rule{}
+	ar.SetProtocol(ProtocolIcmp)
+	if err := ar.SetDestinationPortSpec(PortRangeSpec(8000, 8100)); err != nil {
+		t.Errorf("SetDestinationPortSpec failed: %s", err)
+	}
+	if err := ar.Validate(); err == nil {
+		t.Errorf("Validate with port spec for icmp was supposed to fail")
+	}
+}
+
+// TestRule_LegacyPorts tests that the single port fields keep working next to the PortSpec fields
+func TestRule_LegacyPorts(t *testing.T) {
+	ar := Rule{Action: "pass", Protocol: "tcp", SourcePort: 1024, DestPort: 22}
+	if err := ar.Validate(); err != nil {
+		t.Errorf("Validate failed: %s", err)
+	}
+	if ar.String() != "pass proto tcp from any port 1024 to any port 22" {
+		t.Errorf("unexpected rule: %s", ar.String())
+	}
+
+	ar = Rule{}
+	ar.SetDestinationPort(443)
+	if ar.DestPort != 443 || ar.DestPorts.String() != "443" {
+		t.Errorf("unexpected destination ports: %d, %s", ar.DestPort, ar.DestPorts)
+	}
+	if err := ar.SetDestinationPortSpec(PortRangeSpec(8000, 8100)); err != nil {
+		t.Fatalf("SetDestinationPortSpec failed: %s", err)
+	}
+	if ar.DestPort != 0 || ar.DestPorts.String() != "8000:8100" {
+		t.Errorf("unexpected destination ports: %d, %s", ar.DestPort, ar.DestPorts)
+	}
+
+	pr, err := ParseRule("pass in proto tcp from any port ssh to any port 80")
+	if err != nil {
+		t.Fatalf("ParseRule failed: %s", err)
+	}
+	if pr.SourcePort != 0 || pr.SourcePorts.String() != "ssh" || pr.DestPort != 80 {
+		t.Errorf("unexpected ports of parsed rule: %+v", pr)
+	}
+}
+
+// TestRule_LegacyAddresses tests that the single network fields keep working next to the Endpoint fields
+func TestRule_LegacyAddresses(t *testing.T) {
+	ar := Rule{Action: "pass", Source: testNetwork("10.0.0.0/8"), Destination: testNetwork("192.0.2.1")}
+	ar.Commit()
+	if err := ar.Validate(); err != nil {
+		t.Errorf("Validate failed: %s", err)
+	}
+	if ar.String() != "pass inet from 10.0.0.0/8 to 192.0.2.1/32" {
+		t.Errorf("unexpected rule: %s", ar.String())
+	}
+
+	ar = Rule{}
+	if err := ar.SetSource(TableAddr("trusted")); err != nil {
+		t.Fatalf("SetSource failed: %s", err)
+	}
+	if ar.Source != nil || ar.SourceAddrs.String() != "<trusted>" {
+		t.Errorf("unexpected source: %v, %s", ar.Source, ar.SourceAddrs)
+	}
+	if err := ar.SetSourceCIDR("198.51.100.0/24"); err != nil {
+		t.Fatalf("SetSourceCIDR failed: %s", err)
+	}
+	if ar.Source.String() != "198.51.100.0/24" || ar.SourceAddrs.String() != "198.51.100.0/24" {
+		t.Errorf("unexpected source: %v, %s", ar.Source, ar.SourceAddrs)
+	}
+
+	pr, err := ParseRule("block in from 192.0.2.0/24 to ! 10.0.0.0/8")
+	if err != nil {
+		t.Fatalf("ParseRule failed: %s", err)
+	}
+	if pr.Source.String() != "192.0.2.0/24" || pr.Destination != nil || pr.DestAddrs.String() != "! 10.0.0.0/8" {
+		t.Errorf("unexpected addresses of parsed rule: %+v", pr)
+	}
+}
+
+func TestRule_LegacyFlagsState(t *testing.T) {
+	ar := Rule{Action: "pass", Protocol: "tcp", Flags: "S/SA", State: "keep state (max 100)"}
+	ar.Commit()
+	if err := ar.Validate(); err != nil {
+		t.Errorf("Validate failed: %s", err)
+	}
+	if ar.String() != "pass proto tcp from any to any flags S/SA keep state (max 100)" {
+		t.Errorf("unexpected rule: %s", ar.String())
+	}
+
+	ar = Rule{Action: "pass", Protocol: "udp", Flags: "S/SA"}
+	if err := ar.Validate(); err == nil {
+		t.Errorf("Validate of flags for udp was supposed to fail")
+	}
+	ar = Rule{Action: "pass", State: "keep stat"}
+	if err := ar.Validate(); err == nil {
+		t.Errorf("Validate of an invalid state was supposed to fail")
+	}
+
+	ar = Rule{}
+	if err := ar.SetFlags(TCPFlags{Set: "S", Mask: "SAFR"}); err != nil {
+		t.Fatalf("SetFlags failed: %s", err)
+	}
+	ar.SetState(StateModulate)
+	if err := ar.SetStateOptions(StateOptions{Max: 10}); err != nil {
+		t.Fatalf("SetStateOptions failed: %s", err)
+	}
+	if ar.Flags != "S/SAFR" || ar.State != "modulate state (max 10)" {
+		t.Errorf("unexpected flags or state: %q, %q", ar.Flags, ar.State)
+	}
+
+	pr, err := ParseRule("pass in proto tcp flags any no state")
+	if err != nil {
+		t.Fatalf("ParseRule failed: %s", err)
+	}
+	if pr.Flags != "any" || pr.State != "no state" || !pr.TCPFlags.Any || pr.StateMode != StateNone {
+		t.Errorf("unexpected flags or state of parsed rule: %+v", pr)
+	}
+}
@@ -1,12 +1,16 @@
-// +build !windows,!plan9,!linux
+//go:build !windows && !plan9
+// +build !windows,!plan9
 
 package pf
 
 import "strings"
 
-// RuleSet represents a set of firewall rules
+// RuleSet represents a set of firewall rules. Unsupported holds the rules that ParseRuleSet skipped,
+// as they are valid pf syntax, but use features that cannot be represented by a Rule. They are
+// not part of the rendered RuleSet
 type RuleSet struct {
-	Rules []Rule
+	Rules       []Rule
+	Unsupported []*ParseError
 }
 
 // AddRule adds a given rule to the RuleSet struct rules array. The rule must have the committed
@@ -28,6 +32,20 @@ func (rs *RuleSet) GetRules() []string {
 	return ruleArray
 }
 
+// ruleLines returns the lines of all committed rules of the current RuleSet, each with the index of
+// the rule it has been rendered from
+func (rs *RuleSet) ruleLines() []ruleLine {
+	lineArray := make([]ruleLine, 0, len(rs.Rules))
+	for i := range rs.Rules {
+		r := rs.Rules[i]
+		if r.committed {
+			lineArray = append(lineArray, ruleLine{kind: RuleKindFilter, index: i, text: r.String(),
+				validate: r.Validate})
+		}
+	}
+	return lineArray
+}
+
 // RulesString returns a line separated string of all committed rules of the current RuleSet
 func (rs *RuleSet) RulesString() string {
 	ruleArray := make([]string, 0)
@@ -0,0 +1,56 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package pf
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os/exec"
+)
+
+// Runner is the interface that wraps the execution of the pfctl command. Run executes pfctl with
+// the given arguments, feeding it stdin (which may be nil). It returns the raw stdout and stderr
+// output and the exit code of the process. A non-zero exit code is not an error on its own; err
+// is only set if the command could not be executed or was aborted
+type Runner interface {
+	Run(ctx context.Context, args []string, stdin io.Reader) (stdout, stderr []byte, exitCode int, err error)
+}
+
+// ExecRunner is the default Runner. It executes the pfctl binary at Path via os/exec
+type ExecRunner struct {
+	Path string
+}
+
+// NewExecRunner returns a new ExecRunner for the given pfctl binary path
+func NewExecRunner(p string) *ExecRunner {
+	return &ExecRunner{Path: p}
+}
+
+// Run executes the pfctl binary with the given arguments and stdin and satisfies the Runner interface
+func (r *ExecRunner) Run(ctx context.Context, args []string, stdin io.Reader) ([]byte, []byte, int, error) {
+	var stdoutBuf, stderrBuf bytes.Buffer
+
+	execCmd := exec.CommandContext(ctx, r.Path, args...)
+	execCmd.Stdout = &stdoutBuf
+	execCmd.Stderr = &stderrBuf
+	if stdin != nil {
+		execCmd.Stdin = stdin
+	}
+
+	err := execCmd.Run()
+	if ctx.Err() != nil {
+		return stdoutBuf.Bytes(), stderrBuf.Bytes(), -1, ctx.Err()
+	}
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return stdoutBuf.Bytes(), stderrBuf.Bytes(), exitErr.ExitCode(), nil
+		}
+		return stdoutBuf.Bytes(), stderrBuf.Bytes(), -1, err
+	}
+
+	return stdoutBuf.Bytes(), stderrBuf.Bytes(), 0, nil
+}
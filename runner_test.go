@@ -0,0 +1,139 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package pf
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wneessen/go-pf/pftest"
+)
+
+// Make sure that the fake runner satisfies the Runner interface
+var _ Runner = (*pftest.Runner)(nil)
+
+// newTestFirewall returns a new Firewall that uses a pftest.Runner
+func newTestFirewall(t *testing.T) (Firewall, *pftest.Runner) {
+	t.Helper()
+	r := pftest.NewRunner()
+	f, err := NewFirewallWithRunner(r)
+	if err != nil {
+		t.Fatalf("Could not create firewall object: %s", err)
+	}
+	return f, r
+}
+
+// TestNewFirewallWithRunner tests the NewFirewallWithRunner function
+func TestNewFirewallWithRunner(t *testing.T) {
+	if _, err := NewFirewallWithRunner(nil); err == nil {
+		t.Errorf("NewFirewallWithRunner with nil runner was supposed to fail")
+	}
+	f, _ := newTestFirewall(t)
+	if _, ok := f.getRunner().(*pftest.Runner); !ok {
+		t.Errorf("Firewall does not use the given runner")
+	}
+}
+
+// TestFirewall_Enabled_Runner tests the Enabled method with a fake runner
+func TestFirewall_Enabled_Runner(t *testing.T) {
+	testTable := []struct {
+		testName string
+		stdout   string
+		exitCode int
+		enabled  bool
+	}{
+		{"Enabled", "Enabled\n", 0, true},
+		{"Disabled", "Disabled\n", 0, false},
+		{"Failed", "", 1, false},
+	}
+	for _, testCase := range testTable {
+		t.Run(testCase.testName, func(t *testing.T) {
+			f, r := newTestFirewall(t)
+			r.On(pftest.Response{Stdout: testCase.stdout, ExitCode: testCase.exitCode}, "-s", "Running")
+			if f.Enabled() != testCase.enabled {
+				t.Errorf("Enabled() returned unexpected result. Expected: %t", testCase.enabled)
+			}
+			c, ok := r.LastCall()
+			if !ok {
+				t.Fatalf("runner has not been called")
+			}
+			if strings.Join(c.Args, " ") != "-q -s Running" {
+				t.Errorf("unexpected pfctl arguments: %q", c.Args)
+			}
+		})
+	}
+}
+
+// TestFirewall_CommitAnchor_Runner tests that CommitAnchor pipes the ruleset to the runner
+func TestFirewall_CommitAnchor_Runner(t *testing.T) {
+	f, r := newTestFirewall(t)
+	a := f.NewAnchor("testanchor")
+	ar := a.NewRule()
+	ar.SetDirection(DirectionIn)
+	ar.SetProtocol(ProtocolTcp)
+	ar.Commit()
+	a.AddRule(ar)
+
+	if err := f.CommitAnchor(&a); err != nil {
+		t.Errorf("CommitAnchor failed: %s", err)
+	}
+	c, _ := r.LastCall()
+	if strings.Join(c.Args, " ") != "-q -a testanchor -f - -v" {
+		t.Errorf("unexpected pfctl arguments: %q", c.Args)
+	}
+	if string(c.Stdin) != "block in proto tcp from any to any\n" {
+		t.Errorf("unexpected stdin: %q", string(c.Stdin))
+	}
+
+	r.On(pftest.Response{Stderr: "stdin:1: syntax error\n", ExitCode: 1}, "-a", "testanchor", "-f", "-", "-v")
+	err := f.CommitAnchor(&a)
+	if err == nil {
+		t.Errorf("CommitAnchor was supposed to fail")
+	}
+	if err != nil && !strings.Contains(err.Error(), "syntax error") {
+		t.Errorf("error does not contain stderr output: %s", err)
+	}
+}
+
+// TestFirewall_Context tests that the context and the Firewall timeout are honored
+func TestFirewall_Context(t *testing.T) {
+	f, r := newTestFirewall(t)
+	r.On(pftest.Response{Delay: time.Millisecond * 200}, "-e")
+	r.On(pftest.Response{Stdout: "Disabled\n"}, "-s", "Running")
+
+	f.SetTimeout(time.Millisecond * 20)
+	if err := f.Enable(); err == nil {
+		t.Errorf("Enable was supposed to fail due to the Firewall timeout")
+	}
+
+	f.SetTimeout(time.Millisecond * 20)
+	ctx, cancelFunc := context.WithTimeout(context.Background(), time.Second)
+	defer cancelFunc()
+	if err := f.EnableContext(ctx); err != nil {
+		t.Errorf("EnableContext with deadline was not supposed to fail: %s", err)
+	}
+
+	ctx, cancelFunc = context.WithCancel(context.Background())
+	cancelFunc()
+	if err := f.AddToTableIPContext(ctx, "testtable", "192.0.2.1", "192.0.2.2"); err == nil {
+		t.Errorf("AddToTableIPContext with cancelled context was supposed to fail")
+	}
+	for _, c := range r.Calls() {
+		if strings.Contains(strings.Join(c.Args, " "), "-T add") {
+			t.Errorf("cancelled context should not execute table additions")
+		}
+	}
+}
+
+// TestFirewall_LongOutputLine tests that output lines exceeding the maximum line length are reported
+// instead of silently truncating the output
+func TestFirewall_LongOutputLine(t *testing.T) {
+	f, r := newTestFirewall(t)
+	r.Fallback = pftest.Response{Stdout: "Enabled\n" + strings.Repeat("x", maxLineLen+1) + "\n"}
+	if _, err := f.GetRules(); err == nil {
+		t.Errorf("GetRules was supposed to fail on an overlong output line")
+	}
+}
@@ -0,0 +1,368 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package pf
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// anchorRuleRegex matches anchor call rules in the pfctl -v -s rules output
+var anchorRuleRegex = regexp.MustCompile(`^@(\d+) anchor "([^"]+)"`)
+
+// State represents a single entry of the pf state table
+type State struct {
+	Interface      string
+	Protocol       string
+	Direction      string
+	Source         StateHost
+	SourceNAT      *StateHost
+	Destination    StateHost
+	DestinationNAT *StateHost
+	SourceState    string
+	DestState      string
+	Age            time.Duration
+	Expires        time.Duration
+	PacketsFwd     uint64
+	PacketsRev     uint64
+	BytesFwd       uint64
+	BytesRev       uint64
+	Rule           int
+	Anchor         int
+	ID             string
+	CreatorID      string
+	Gateway        string
+	OrigIf         string
+}
+
+// StateHost represents an address and port of a State
+type StateHost struct {
+	Addr net.IP
+	Port uint16
+}
+
+// StateFilter selects the states returned by Firewall.States. All fields are optional and a zero
+// StateFilter matches all states. Address and Port match either side of a state including its
+// translated addresses. Anchor matches states created by rules within the named anchor. pf only
+// records the anchor call of the main ruleset a state was created under, so for nested anchors
+// the states of the calling anchor, and for wildcard calls like anchor "blacklistd/*" the states
+// of all anchors evaluated by the call, are matched as well
+type StateFilter struct {
+	Address   *net.IPNet
+	Port      uint16
+	Protocol  string
+	Interface string
+	Anchor    string
+}
+
+// States returns all entries of the pf state table that match the given StateFilter
+func (f *Firewall) States(sf StateFilter) ([]State, error) {
+	return f.StatesContext(context.Background(), sf)
+}
+
+// StatesContext returns all entries of the pf state table that match the given StateFilter. The
+// given context is used for the pfctl executions
+func (f *Firewall) StatesContext(ctx context.Context, sf StateFilter) ([]State, error) {
+	var anchorNums map[int]bool
+	if sf.Anchor != "" {
+		ruleOutput, err := f.execPfCtl(ctx, "-v", "-s", "rules")
+		if err != nil {
+			return nil, err
+		}
+		anchorNums = make(map[int]bool)
+		for _, l := range ruleOutput {
+			m := anchorRuleRegex.FindStringSubmatch(l)
+			if m != nil && anchorCallMatches(m[2], sf.Anchor) {
+				anchorNum, _ := strconv.Atoi(m[1])
+				anchorNums[anchorNum] = true
+			}
+		}
+	}
+
+	stateOutput, err := f.execPfCtl(ctx, "-vv", "-s", "states")
+	if err != nil {
+		return nil, err
+	}
+	stateArray, err := parseStates(stateOutput)
+	if err != nil {
+		return nil, err
+	}
+
+	filteredArray := make([]State, 0, len(stateArray))
+	for _, s := range stateArray {
+		if anchorNums != nil && !anchorNums[s.Anchor] {
+			continue
+		}
+		if sf.Match(s) {
+			filteredArray = append(filteredArray, s)
+		}
+	}
+	return filteredArray, nil
+}
+
+// anchorCallMatches returns true if the rules of the anchor a are evaluated by the anchor call c of
+// the main ruleset, i. e. if a is the called anchor, one of its nested anchors or, for a wildcard
+// call, one of the anchors below the wildcard
+func anchorCallMatches(c, a string) bool {
+	a = strings.Trim(a, "/")
+	if c == a {
+		return true
+	}
+	return strings.HasPrefix(a, strings.TrimSuffix(c, "/*")+"/")
+}
+
+// Match returns true if the given State matches the address, port, protocol and interface criteria
+// of the StateFilter. The Anchor criteria is resolved by Firewall.States and not considered here
+func (sf StateFilter) Match(s State) bool {
+	if sf.Protocol != "" && !strings.EqualFold(sf.Protocol, s.Protocol) {
+		return false
+	}
+	if sf.Interface != "" && sf.Interface != s.Interface && sf.Interface != s.OrigIf {
+		return false
+	}
+	hostArray := s.hosts()
+	if sf.Address != nil {
+		found := false
+		for _, h := range hostArray {
+			if h.Addr != nil && sf.Address.Contains(h.Addr) {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if sf.Port != 0 {
+		found := false
+		for _, h := range hostArray {
+			if h.Port == sf.Port {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// hosts returns all hosts of the State including the translated ones
+func (s State) hosts() []StateHost {
+	hostArray := []StateHost{s.Source, s.Destination}
+	if s.SourceNAT != nil {
+		hostArray = append(hostArray, *s.SourceNAT)
+	}
+	if s.DestinationNAT != nil {
+		hostArray = append(hostArray, *s.DestinationNAT)
+	}
+	return hostArray
+}
+
+// String returns the StateHost in the notation used by pfctl
+func (h StateHost) String() string {
+	if h.Port == 0 {
+		return h.Addr.String()
+	}
+	if h.Addr.To4() == nil {
+		return fmt.Sprintf("%s[%d]", h.Addr.String(), h.Port)
+	}
+	return fmt.Sprintf("%s:%d", h.Addr.String(), h.Port)
+}
+
+// parseStates parses the output of pfctl -s states (optionally with -v or -vv) into a list of State
+func parseStates(o []string) ([]State, error) {
+	stateArray := make([]State, 0)
+	for _, l := range o {
+		if strings.TrimSpace(l) == "" {
+			continue
+		}
+
+		// Detail lines of -v/-vv are indented and belong to the previous state
+		if strings.HasPrefix(l, " ") || strings.HasPrefix(l, "\t") {
+			if len(stateArray) == 0 {
+				return stateArray, fmt.Errorf("state details without state: %q", l)
+			}
+			if err := parseStateDetails(&stateArray[len(stateArray)-1], l); err != nil {
+				return stateArray, err
+			}
+			continue
+		}
+
+		s, err := parseStateLine(l)
+		if err != nil {
+			return stateArray, err
+		}
+		stateArray = append(stateArray, s)
+	}
+	return stateArray, nil
+}
+
+// parseStateLine parses the first line of a state entry in the form of
+// "iface proto host [(host)] -> host [(host)] SRCSTATE:DSTSTATE"
+func parseStateLine(l string) (State, error) {
+	s := State{Rule: -1, Anchor: -1}
+	fieldArray := strings.Fields(l)
+	if len(fieldArray) < 6 {
+		return s, fmt.Errorf("failed to parse state line: %q", l)
+	}
+	s.Interface = fieldArray[0]
+	s.Protocol = fieldArray[1]
+
+	// Collect the hosts on both sides of the direction arrow
+	var sideArray [2][]StateHost
+	side := 0
+	for i := 2; i < len(fieldArray)-1; i++ {
+		field := fieldArray[i]
+		if field == "->" || field == "<-" {
+			if side != 0 {
+				return s, fmt.Errorf("failed to parse state line: %q", l)
+			}
+			s.Direction = "out"
+			if field == "<-" {
+				s.Direction = "in"
+			}
+			side = 1
+			continue
+		}
+		h, err := parseStateHost(strings.Trim(field, "()"))
+		if err != nil {
+			return s, fmt.Errorf("failed to parse state line: %q: %w", l, err)
+		}
+		sideArray[side] = append(sideArray[side], h)
+	}
+	if s.Direction == "" || len(sideArray[0]) == 0 || len(sideArray[1]) == 0 ||
+		len(sideArray[0]) > 2 || len(sideArray[1]) > 2 {
+		return s, fmt.Errorf("failed to parse state line: %q", l)
+	}
+	stateArray := strings.SplitN(fieldArray[len(fieldArray)-1], ":", 2)
+	s.SourceState = stateArray[0]
+	if len(stateArray) == 2 {
+		s.DestState = stateArray[1]
+	}
+
+	// For outbound states the local side is printed first, for inbound states the remote side
+	srcSide, dstSide := sideArray[0], sideArray[1]
+	if s.Direction == "in" {
+		srcSide, dstSide = sideArray[1], sideArray[0]
+	}
+	s.Source = srcSide[0]
+	if len(srcSide) == 2 {
+		s.SourceNAT = &srcSide[1]
+	}
+	s.Destination = dstSide[0]
+	if len(dstSide) == 2 {
+		s.DestinationNAT = &dstSide[1]
+	}
+	return s, nil
+}
+
+// parseStateDetails parses a verbose detail line of a state entry into the given State
+func parseStateDetails(s *State, l string) error {
+	l = strings.TrimSpace(l)
+	switch {
+	case strings.HasPrefix(l, "age "):
+		for _, p := range strings.Split(l, ", ") {
+			fieldArray := strings.Fields(p)
+			if len(fieldArray) < 2 {
+				continue
+			}
+			var err error
+			switch {
+			case fieldArray[0] == "age":
+				s.Age, err = parseClockDuration(fieldArray[1])
+			case fieldArray[0] == "expires" && len(fieldArray) == 3:
+				s.Expires, err = parseClockDuration(fieldArray[2])
+			case fieldArray[1] == "pkts":
+				s.PacketsFwd, s.PacketsRev, err = parseCounterPair(fieldArray[0])
+			case fieldArray[1] == "bytes":
+				s.BytesFwd, s.BytesRev, err = parseCounterPair(fieldArray[0])
+			case fieldArray[0] == "rule":
+				s.Rule, err = strconv.Atoi(fieldArray[1])
+			case fieldArray[0] == "anchor":
+				s.Anchor, err = strconv.Atoi(fieldArray[1])
+			}
+			if err != nil {
+				return fmt.Errorf("failed to parse state details %q: %w", l, err)
+			}
+		}
+	case strings.HasPrefix(l, "id:"):
+		fieldArray := strings.Fields(l)
+		for i := 0; i+1 < len(fieldArray); i += 2 {
+			switch fieldArray[i] {
+			case "id:":
+				s.ID = fieldArray[i+1]
+			case "creatorid:":
+				s.CreatorID = fieldArray[i+1]
+			case "gateway:":
+				s.Gateway = fieldArray[i+1]
+			}
+		}
+	case strings.HasPrefix(l, "origif:"):
+		s.OrigIf = strings.TrimSpace(strings.TrimPrefix(l, "origif:"))
+	}
+	return nil
+}
+
+// parseStateHost parses a host of a state entry in the form of "192.0.2.1:80", "2001:db8::1[80]"
+// or a plain address without port
+func parseStateHost(h string) (StateHost, error) {
+	sh := StateHost{}
+	addr, port := h, ""
+	if i := strings.Index(h, "["); i > 0 && strings.HasSuffix(h, "]") {
+		addr, port = h[:i], h[i+1:len(h)-1]
+	} else if strings.Count(h, ":") == 1 {
+		addr, port = h[:strings.Index(h, ":")], h[strings.Index(h, ":")+1:]
+	}
+	sh.Addr = net.ParseIP(addr)
+	if sh.Addr == nil {
+		return sh, fmt.Errorf("invalid address: %q", addr)
+	}
+	if port != "" {
+		portNum, err := strconv.ParseUint(port, 10, 16)
+		if err != nil {
+			return sh, fmt.Errorf("invalid port: %q", port)
+		}
+		sh.Port = uint16(portNum)
+	}
+	return sh, nil
+}
+
+// parseClockDuration parses a duration in the form of "hh:mm:ss" as printed by pfctl
+func parseClockDuration(d string) (time.Duration, error) {
+	partArray := strings.Split(d, ":")
+	if len(partArray) != 3 {
+		return 0, fmt.Errorf("invalid duration: %q", d)
+	}
+	var dur time.Duration
+	for i, unit := range []time.Duration{time.Hour, time.Minute, time.Second} {
+		v, err := strconv.ParseUint(partArray[i], 10, 32)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration: %q", d)
+		}
+		dur += time.Duration(v) * unit
+	}
+	return dur, nil
+}
+
+// parseCounterPair parses a counter pair in the form of "123:456" as printed by pfctl
+func parseCounterPair(c string) (uint64, uint64, error) {
+	partArray := strings.SplitN(c, ":", 2)
+	if len(partArray) != 2 {
+		return 0, 0, fmt.Errorf("invalid counter pair: %q", c)
+	}
+	fwd, err := strconv.ParseUint(partArray[0], 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid counter pair: %q", c)
+	}
+	rev, err := strconv.ParseUint(partArray[1], 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid counter pair: %q", c)
+	}
+	return fwd, rev, nil
+}
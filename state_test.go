@@ -0,0 +1,101 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package pf
+
+import (
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/wneessen/go-pf/pftest"
+)
+
+// TestFirewall_States tests the parsing and filtering of the pf state table
+func TestFirewall_States(t *testing.T) {
+	stateOutput, err := os.ReadFile("testdata/pfctl-vvs-states.txt")
+	if err != nil {
+		t.Fatalf("failed to read test data: %s", err)
+	}
+	_, docNet, _ := net.ParseCIDR("203.0.113.0/24")
+	testTable := []struct {
+		testName string
+		filter   StateFilter
+		want     []string
+	}{
+		{"All states", StateFilter{}, []string{"5f3e1a0000000001", "5f3e1a0000000002", "5f3e1a0000000003",
+			"5f3e1a0000000004", "5f3e1a0000000005", "5f3e1a0000000006"}},
+		{"Protocol", StateFilter{Protocol: "udp"}, []string{"5f3e1a0000000002"}},
+		{"Address", StateFilter{Address: docNet}, []string{"5f3e1a0000000002", "5f3e1a0000000003",
+			"5f3e1a0000000005"}},
+		{"NAT address and port", StateFilter{Port: 61234}, []string{"5f3e1a0000000003"}},
+		{"Interface", StateFilter{Interface: "em1"}, []string{"5f3e1a0000000003"}},
+		{"Anchor", StateFilter{Anchor: "dns"}, []string{"5f3e1a0000000002"}},
+		{"Nested anchor", StateFilter{Anchor: "dns/resolver"}, []string{"5f3e1a0000000002"}},
+		{"Wildcard anchor call", StateFilter{Anchor: "blacklistd/25"}, []string{"5f3e1a0000000006"}},
+		{"Wildcard anchor parent", StateFilter{Anchor: "blacklistd"}, []string{}},
+		{"Anchor name prefix", StateFilter{Anchor: "dnsmasq"}, []string{}},
+	}
+	for _, testCase := range testTable {
+		t.Run(testCase.testName, func(t *testing.T) {
+			f, r := newTestFirewall(t)
+			r.On(pftest.Response{Stdout: string(stateOutput)}, "-vv", "-s", "states")
+			r.On(pftest.Response{Stdout: "@0 pass all flags S/SA keep state\n" +
+				"  [ Evaluations: 10        Packets: 0         Bytes: 0           States: 0     ]\n" +
+				"@5 anchor \"dns\" all\n" +
+				"@6 anchor \"blacklistd/*\" in on em0 all\n"}, "-v", "-s", "rules")
+			stateArray, err := f.States(testCase.filter)
+			if err != nil {
+				t.Fatalf("States failed: %s", err)
+			}
+			if len(stateArray) != len(testCase.want) {
+				t.Fatalf("unexpected number of states. Expected: %d, got: %d", len(testCase.want),
+					len(stateArray))
+			}
+			for i, s := range stateArray {
+				if s.ID != testCase.want[i] {
+					t.Errorf("unexpected state. Expected: %s, got: %s", testCase.want[i], s.ID)
+				}
+			}
+		})
+	}
+}
+
+// TestParseStates tests the parsing of single state entries
+func TestParseStates(t *testing.T) {
+	stateOutput, err := os.ReadFile("testdata/pfctl-vvs-states.txt")
+	if err != nil {
+		t.Fatalf("failed to read test data: %s", err)
+	}
+	f, r := newTestFirewall(t)
+	r.Fallback = pftest.Response{Stdout: string(stateOutput)}
+	stateArray, err := f.States(StateFilter{})
+	if err != nil {
+		t.Fatalf("States failed: %s", err)
+	}
+
+	s := stateArray[0]
+	if s.Direction != "in" || s.Source.String() != "198.51.100.7:54321" || s.Destination.String() != "192.0.2.10:22" {
+		t.Errorf("unexpected inbound state: %+v", s)
+	}
+	if s.SourceState != "ESTABLISHED" || s.Age != time.Minute*10+time.Second*22 || s.PacketsFwd != 1234 ||
+		s.BytesRev != 789012 || s.Rule != 3 || s.Anchor != -1 || s.CreatorID != "2bb2e0fb" {
+		t.Errorf("unexpected state details: %+v", s)
+	}
+
+	s = stateArray[2]
+	if s.Direction != "out" || s.SourceNAT == nil || s.SourceNAT.String() != "192.0.2.10:61234" ||
+		s.Source.String() != "10.0.0.5:40000" || s.DestinationNAT != nil {
+		t.Errorf("unexpected NAT state: %+v", s)
+	}
+
+	s = stateArray[3]
+	if s.Source.String() != "2001:db8::2[55555]" || s.Expires != time.Hour*24 {
+		t.Errorf("unexpected IPv6 state: %+v", s)
+	}
+
+	if _, err := parseStates([]string{"all tcp foo -> bar ESTABLISHED:ESTABLISHED"}); err == nil {
+		t.Errorf("parseStates was supposed to fail on invalid hosts")
+	}
+}
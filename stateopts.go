@@ -0,0 +1,249 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package pf
+
+import (
+	"fmt"
+	"strings"
+)
+
+// State modes
+const (
+	StateDefault StateMode = iota
+	StateNone
+	StateKeep
+	StateModulate
+	StateSynproxy
+)
+
+// tcpFlagChars are the TCP flags in pf syntax (FIN, SYN, RST, PUSH, ACK, URG, ECE and CWR)
+const tcpFlagChars = "FSRPAUEW"
+
+// stateTimeouts are the timeout names that can be set per rule
+var stateTimeouts = []string{"tcp.first", "tcp.opening", "tcp.established", "tcp.closing", "tcp.finwait",
+	"tcp.closed", "sctp.first", "sctp.opening", "sctp.established", "sctp.closing", "sctp.closed",
+	"udp.first", "udp.single", "udp.multiple", "icmp.first", "icmp.error", "other.first", "other.single",
+	"other.multiple", "frag", "interval", "adaptive.start", "adaptive.end", "src.track"}
+
+// StateMode represents the state keyword of a Rule. StateDefault omits the keyword, so pf applies
+// its default (keep state for pass rules)
+type StateMode int
+
+// TCPFlags represents the flags option of a Rule. A Rule with TCPFlags{Set: "S", Mask: "SA"} only
+// matches TCP packets with SYN set out of SYN and ACK. Any matches all packets regardless of their flags
+type TCPFlags struct {
+	Set  string
+	Mask string
+	Any  bool
+}
+
+// ConnRate represents a connection rate limit of Conns connections within Seconds seconds
+type ConnRate struct {
+	Conns   uint32
+	Seconds uint32
+}
+
+// StateTimeout represents a per-rule state timeout in seconds, i. e. tcp.established 600
+type StateTimeout struct {
+	Name    string
+	Seconds uint32
+}
+
+// StateOptions represents the options of a keep, modulate or synproxy state keyword of a Rule.
+// Zero values are omitted. SourceTrack is either "rule" or "global", Binding either "if-bound" or
+// "floating". Overload names the table that hosts exceeding the source limits are added to
+type StateOptions struct {
+	Max                 uint32
+	NoSync              bool
+	SourceTrack         string
+	MaxSrcStates        uint32
+	MaxSrcConn          uint32
+	MaxSrcConnRate      ConnRate
+	MaxSrcNodes         uint32
+	Overload            string
+	OverloadFlush       bool
+	OverloadFlushGlobal bool
+	Binding             string
+	Sloppy              bool
+	Timeouts            []StateTimeout
+}
+
+// String returns the StateMode in pf syntax
+func (m StateMode) String() string {
+	switch m {
+	case StateNone:
+		return "no state"
+	case StateKeep:
+		return "keep state"
+	case StateModulate:
+		return "modulate state"
+	case StateSynproxy:
+		return "synproxy state"
+	default:
+		return ""
+	}
+}
+
+// String returns the TCPFlags in pf syntax without the leading flags keyword
+func (f TCPFlags) String() string {
+	if f.Any {
+		return "any"
+	}
+	if f.Set == "" && f.Mask == "" {
+		return ""
+	}
+	if f.Mask == "" {
+		return f.Set
+	}
+	return fmt.Sprintf("%s/%s", f.Set, f.Mask)
+}
+
+// Validate checks the TCPFlags for unknown flags and flags that are not part of the mask
+func (f TCPFlags) Validate() error {
+	if f.Any {
+		if f.Set != "" || f.Mask != "" {
+			return fmt.Errorf("flags any cannot be combined with other flags")
+		}
+		return nil
+	}
+	for _, c := range f.Set + f.Mask {
+		if !strings.ContainsRune(tcpFlagChars, c) {
+			return fmt.Errorf("unknown tcp flag: %q", c)
+		}
+	}
+	if f.Mask == "" {
+		return nil
+	}
+	for _, c := range f.Set {
+		if !strings.ContainsRune(f.Mask, c) {
+			return fmt.Errorf("tcp flag %q is not part of the mask %s", c, f.Mask)
+		}
+	}
+	return nil
+}
+
+// isZero returns true if no flags are set
+func (f TCPFlags) isZero() bool {
+	return !f.Any && f.Set == "" && f.Mask == ""
+}
+
+// parseTCPFlags parses TCP flags in pf syntax (i. e. S/SA or any) without validating them
+func parseTCPFlags(s string) TCPFlags {
+	if s == "any" {
+		return TCPFlags{Any: true}
+	}
+	flagArray := strings.SplitN(s, "/", 2)
+	tf := TCPFlags{Set: flagArray[0]}
+	if len(flagArray) == 2 {
+		tf.Mask = flagArray[1]
+	}
+	return tf
+}
+
+// stateString returns the given StateMode and StateOptions in pf syntax, i. e. keep state (max 100)
+func stateString(m StateMode, o StateOptions) string {
+	if m == StateDefault || m == StateNone {
+		return m.String()
+	}
+	if stateOpts := o.String(); stateOpts != "" {
+		return fmt.Sprintf("%s (%s)", m, stateOpts)
+	}
+	return m.String()
+}
+
+// String returns the StateOptions in pf syntax without the surrounding parentheses
+func (o StateOptions) String() string {
+	optArray := make([]string, 0)
+	if o.Max > 0 {
+		optArray = append(optArray, fmt.Sprintf("max %d", o.Max))
+	}
+	if o.NoSync {
+		optArray = append(optArray, "no-sync")
+	}
+	if o.SourceTrack != "" {
+		optArray = append(optArray, fmt.Sprintf("source-track %s", o.SourceTrack))
+	}
+	if o.MaxSrcStates > 0 {
+		optArray = append(optArray, fmt.Sprintf("max-src-states %d", o.MaxSrcStates))
+	}
+	if o.MaxSrcConn > 0 {
+		optArray = append(optArray, fmt.Sprintf("max-src-conn %d", o.MaxSrcConn))
+	}
+	if o.MaxSrcConnRate != (ConnRate{}) {
+		optArray = append(optArray, fmt.Sprintf("max-src-conn-rate %d/%d", o.MaxSrcConnRate.Conns,
+			o.MaxSrcConnRate.Seconds))
+	}
+	if o.MaxSrcNodes > 0 {
+		optArray = append(optArray, fmt.Sprintf("max-src-nodes %d", o.MaxSrcNodes))
+	}
+	if o.Overload != "" {
+		overload := fmt.Sprintf("overload <%s>", o.Overload)
+		if o.OverloadFlush {
+			overload = fmt.Sprintf("%s flush", overload)
+			if o.OverloadFlushGlobal {
+				overload = fmt.Sprintf("%s global", overload)
+			}
+		}
+		optArray = append(optArray, overload)
+	}
+	if o.Binding != "" {
+		optArray = append(optArray, o.Binding)
+	}
+	if o.Sloppy {
+		optArray = append(optArray, "sloppy")
+	}
+	for _, st := range o.Timeouts {
+		optArray = append(optArray, fmt.Sprintf("%s %d", st.Name, st.Seconds))
+	}
+	return strings.Join(optArray, ", ")
+}
+
+// Validate checks the StateOptions for unknown values and options that depend on each other
+func (o StateOptions) Validate() error {
+	switch o.SourceTrack {
+	case "", "rule", "global":
+	default:
+		return fmt.Errorf("invalid source-track mode: %q", o.SourceTrack)
+	}
+	switch o.Binding {
+	case "", "if-bound", "floating":
+	default:
+		return fmt.Errorf("invalid state binding: %q", o.Binding)
+	}
+	if o.MaxSrcConnRate != (ConnRate{}) && (o.MaxSrcConnRate.Conns == 0 || o.MaxSrcConnRate.Seconds == 0) {
+		return fmt.Errorf("invalid max-src-conn-rate: %d/%d", o.MaxSrcConnRate.Conns, o.MaxSrcConnRate.Seconds)
+	}
+	if o.Overload != "" {
+		if err := validateTableName(o.Overload); err != nil {
+			return err
+		}
+	}
+	if o.OverloadFlush && o.Overload == "" {
+		return fmt.Errorf("overload flush requires an overload table")
+	}
+	if o.OverloadFlushGlobal && !o.OverloadFlush {
+		return fmt.Errorf("overload flush global requires overload flush")
+	}
+	for _, st := range o.Timeouts {
+		if !isStateTimeout(st.Name) {
+			return fmt.Errorf("unknown state timeout: %q", st.Name)
+		}
+	}
+	return nil
+}
+
+// isZero returns true if no state option is set
+func (o StateOptions) isZero() bool {
+	return o.String() == ""
+}
+
+// isStateTimeout returns true if the given name is a timeout that can be set per rule
+func isStateTimeout(n string) bool {
+	for _, st := range stateTimeouts {
+		if st == n {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,256 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package pf
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ruleNumRegex matches the rule number prefix of the pfctl -vv -s rules output
+var ruleNumRegex = regexp.MustCompile(`^@(\d+)\s+(.+)$`)
+
+// ruleEvalRegex matches the counter line of a rule in the pfctl -v -s rules output
+var ruleEvalRegex = regexp.MustCompile(`Evaluations:\s*(\d+)\s+Packets:\s*(\d+)\s+Bytes:\s*(\d+)\s+States:\s*(\d+)`)
+
+// ruleInsertedRegex matches the insertion line of a rule in the pfctl -v -s rules output
+var ruleInsertedRegex = regexp.MustCompile(`Inserted:\s*uid\s+(\d+)\s+pid\s+(\d+)(?:\s+State Creations:\s*(\d+))?`)
+
+// ruleLastActiveRegex matches the last active line of a rule in the pfctl -v -s rules output
+var ruleLastActiveRegex = regexp.MustCompile(`Last Active Time:\s*(.+?)\s*\]`)
+
+// RuleStat represents a loaded rule with its counters as reported by pfctl -vv -s rules. Rule holds
+// the parsed rule and is nil if the rule cannot be represented by a Rule (i. e. scrub rules).
+// LastActive is the zero time if the rule has never matched or pfctl does not report it
+type RuleStat struct {
+	Number         int
+	Text           string
+	Rule           *Rule
+	Evaluations    uint64
+	Packets        uint64
+	Bytes          uint64
+	States         uint64
+	StateCreations uint64
+	InsertedUID    int
+	InsertedPID    int
+	LastActive     time.Time
+}
+
+// LabelStat represents the counters of all rules with the same label as reported by pfctl -s labels.
+// Rules is the number of rules that share the label
+type LabelStat struct {
+	Label       string
+	Rules       int
+	Evaluations uint64
+	Packets     uint64
+	Bytes       uint64
+	PacketsIn   uint64
+	BytesIn     uint64
+	PacketsOut  uint64
+	BytesOut    uint64
+	States      uint64
+}
+
+// RuleStats returns the rules of the given anchor with their counters. An empty anchor name
+// returns the rules of the main ruleset
+func (f *Firewall) RuleStats(a string) ([]RuleStat, error) {
+	return f.RuleStatsContext(context.Background(), a)
+}
+
+// RuleStatsContext returns the rules of the given anchor with their counters. The given context is
+// used for the pfctl execution
+func (f *Firewall) RuleStatsContext(ctx context.Context, a string) ([]RuleStat, error) {
+	argArray := []string{"-vv", "-s", "rules"}
+	if a != "" {
+		argArray = append([]string{"-a", a}, argArray...)
+	}
+	ruleOutput, err := f.execPfCtl(ctx, argArray...)
+	if err != nil {
+		return nil, err
+	}
+	return parseRuleStats(ruleOutput)
+}
+
+// LabelStats returns the counters of all labels of the main ruleset
+func (f *Firewall) LabelStats() ([]LabelStat, error) {
+	return f.LabelStatsContext(context.Background())
+}
+
+// LabelStatsContext returns the counters of all labels of the main ruleset. The given context is
+// used for the pfctl execution
+func (f *Firewall) LabelStatsContext(ctx context.Context) ([]LabelStat, error) {
+	labelOutput, err := f.execPfCtl(ctx, "-s", "labels")
+	if err != nil {
+		return nil, err
+	}
+	return parseLabelStats(labelOutput)
+}
+
+// ZeroStats clears the global statistics of the packet filter and returns them as they were reported
+// right before they were cleared
+func (f *Firewall) ZeroStats() (Status, error) {
+	return f.ZeroStatsContext(context.Background())
+}
+
+// ZeroStatsContext clears the global statistics of the packet filter and returns them as they were
+// reported right before they were cleared. The given context is used for the pfctl executions. As
+// reading and clearing the statistics takes two pfctl invocations, events in between are lost
+func (f *Firewall) ZeroStatsContext(ctx context.Context) (Status, error) {
+	s, err := f.InfoContext(ctx)
+	if err != nil {
+		return s, err
+	}
+	if _, err := f.execPfCtl(ctx, "-F", "info"); err != nil {
+		return s, err
+	}
+	return s, nil
+}
+
+// ZeroRuleCounters clears the counters of all rules of the given anchor and returns the rules with
+// their counters right before they were cleared. An empty anchor name clears the counters of the
+// main ruleset
+func (f *Firewall) ZeroRuleCounters(a string) ([]RuleStat, error) {
+	return f.ZeroRuleCountersContext(context.Background(), a)
+}
+
+// ZeroRuleCountersContext clears the counters of all rules of the given anchor and returns the rules
+// with their counters right before they were cleared. The given context is used for the pfctl
+// execution. pfctl reads and clears the counters of each rule at once, so no events are lost
+func (f *Firewall) ZeroRuleCountersContext(ctx context.Context, a string) ([]RuleStat, error) {
+	argArray := []string{"-vv", "-s", "rules", "-z"}
+	if a != "" {
+		argArray = append([]string{"-a", a}, argArray...)
+	}
+	ruleOutput, err := f.execPfCtl(ctx, argArray...)
+	if err != nil {
+		return nil, err
+	}
+	return parseRuleStats(ruleOutput)
+}
+
+// ZeroTableCounters clears the statistics of the given addresses of the given pf table. Without
+// addresses, the statistics of all entries are cleared
+func (f *Firewall) ZeroTableCounters(t string, e ...string) (TableResult, error) {
+	return f.ZeroTableCountersContext(context.Background(), t, e...)
+}
+
+// ZeroTableCountersContext clears the statistics of the given addresses of the given pf table.
+// Without addresses, the statistics of all entries are cleared. The given context is used for the
+// pfctl execution
+func (f *Firewall) ZeroTableCountersContext(ctx context.Context, t string, e ...string) (TableResult, error) {
+	addrArray, err := tableAddrArgs(e)
+	if err != nil {
+		return TableResult{}, err
+	}
+	return f.execTableCmd(ctx, t, "zero", addrArray...)
+}
+
+// parseRuleStats parses the output of pfctl -vv -s rules into a list of RuleStat
+func parseRuleStats(o []string) ([]RuleStat, error) {
+	statArray := make([]RuleStat, 0)
+	for _, l := range o {
+		trimmed := strings.TrimSpace(l)
+		if trimmed == "" {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "[") {
+			if len(statArray) == 0 {
+				return nil, fmt.Errorf("rule counters without rule: %q", l)
+			}
+			if err := parseRuleCounters(&statArray[len(statArray)-1], trimmed); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		m := ruleNumRegex.FindStringSubmatch(trimmed)
+		if m == nil {
+			return nil, fmt.Errorf("failed to parse rule line: %q", l)
+		}
+		rs := RuleStat{Text: m[2]}
+		rs.Number, _ = strconv.Atoi(m[1])
+		if ar, err := ParseRule(rs.Text); err == nil {
+			rs.Rule = &ar
+		}
+		statArray = append(statArray, rs)
+	}
+	return statArray, nil
+}
+
+// parseRuleCounters parses a bracketed counter line of the pfctl -v -s rules output into the RuleStat
+func parseRuleCounters(rs *RuleStat, l string) error {
+	var err error
+	if m := ruleEvalRegex.FindStringSubmatch(l); m != nil {
+		for i, c := range []*uint64{&rs.Evaluations, &rs.Packets, &rs.Bytes, &rs.States} {
+			if *c, err = strconv.ParseUint(m[i+1], 10, 64); err != nil {
+				return fmt.Errorf("failed to parse rule counters %q: %w", l, err)
+			}
+		}
+	}
+	if m := ruleInsertedRegex.FindStringSubmatch(l); m != nil {
+		rs.InsertedUID, _ = strconv.Atoi(m[1])
+		rs.InsertedPID, _ = strconv.Atoi(m[2])
+		if m[3] != "" {
+			if rs.StateCreations, err = strconv.ParseUint(m[3], 10, 64); err != nil {
+				return fmt.Errorf("failed to parse state creations %q: %w", l, err)
+			}
+		}
+	}
+	if m := ruleLastActiveRegex.FindStringSubmatch(l); m != nil && m[1] != "N/A" {
+		if rs.LastActive, err = time.ParseInLocation(time.ANSIC, m[1], time.Local); err != nil {
+			return fmt.Errorf("failed to parse last active time %q: %w", l, err)
+		}
+	}
+	return nil
+}
+
+// parseLabelStats parses the output of pfctl -s labels into a list of LabelStat. The counters of
+// rules with the same label are summed up. As labels can contain spaces, the counters are parsed
+// from the end of the line
+func parseLabelStats(o []string) ([]LabelStat, error) {
+	statArray := make([]LabelStat, 0)
+	labelIndex := make(map[string]int)
+	for _, l := range o {
+		fieldArray := strings.Fields(l)
+		if len(fieldArray) == 0 {
+			continue
+		}
+		if len(fieldArray) < 9 {
+			return nil, fmt.Errorf("failed to parse label line: %q", l)
+		}
+		counterArray := fieldArray[len(fieldArray)-8:]
+		ls := LabelStat{Label: strings.Join(fieldArray[:len(fieldArray)-8], " "), Rules: 1}
+		for i, c := range []*uint64{&ls.Evaluations, &ls.Packets, &ls.Bytes, &ls.PacketsIn, &ls.BytesIn,
+			&ls.PacketsOut, &ls.BytesOut, &ls.States} {
+			var err error
+			if *c, err = strconv.ParseUint(counterArray[i], 10, 64); err != nil {
+				return nil, fmt.Errorf("failed to parse label counters %q: %w", l, err)
+			}
+		}
+		i, ok := labelIndex[ls.Label]
+		if !ok {
+			labelIndex[ls.Label] = len(statArray)
+			statArray = append(statArray, ls)
+			continue
+		}
+		statArray[i].add(ls)
+	}
+	return statArray, nil
+}
+
+// add adds the counters of the given LabelStat to the LabelStat
+func (ls *LabelStat) add(o LabelStat) {
+	ls.Rules += o.Rules
+	ls.Evaluations += o.Evaluations
+	ls.Packets += o.Packets
+	ls.Bytes += o.Bytes
+	ls.PacketsIn += o.PacketsIn
+	ls.BytesIn += o.BytesIn
+	ls.PacketsOut += o.PacketsOut
+	ls.BytesOut += o.BytesOut
+	ls.States += o.States
+}
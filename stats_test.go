@@ -0,0 +1,212 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package pf
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wneessen/go-pf/pftest"
+)
+
+// TestFirewall_RuleStats tests the parsing of the pfctl -vv -s rules output
+func TestFirewall_RuleStats(t *testing.T) {
+	ruleOutput, err := os.ReadFile("testdata/pfctl-vvsr.txt")
+	if err != nil {
+		t.Fatalf("failed to read test data: %s", err)
+	}
+	f, r := newTestFirewall(t)
+	r.On(pftest.Response{Stdout: string(ruleOutput)}, "-a", "go-pf", "-vv", "-s", "rules")
+	statArray, err := f.RuleStats("go-pf")
+	if err != nil {
+		t.Fatalf("RuleStats failed: %s", err)
+	}
+	if len(statArray) != 4 {
+		t.Fatalf("unexpected number of rules. Expected: %d, got: %d", 4, len(statArray))
+	}
+
+	rs := statArray[0]
+	lastActive := time.Date(2026, time.October, 15, 9, 12, 44, 0, time.Local)
+	if rs.Number != 0 || rs.Text != "block drop in log all" || rs.Evaluations != 18426 || rs.Packets != 312 ||
+		rs.Bytes != 18720 || rs.InsertedPID != 2913 || !rs.LastActive.Equal(lastActive) {
+		t.Errorf("unexpected rule stats: %+v", rs)
+	}
+	if rs.Rule == nil || rs.Rule.Action != "block" || rs.Rule.Direction != "in" || !rs.Rule.Log {
+		t.Errorf("unexpected parsed rule: %+v", rs.Rule)
+	}
+
+	rs = statArray[1]
+	if !rs.LastActive.IsZero() || rs.Packets != 0 {
+		t.Errorf("unexpected stats for inactive rule: %+v", rs)
+	}
+
+	rs = statArray[2]
+	if rs.Number != 2 || rs.States != 14 || rs.StateCreations != 1204 || rs.Bytes != 51822911 ||
+		rs.Rule == nil || rs.Rule.Label != "web" {
+		t.Errorf("unexpected stats for labeled rule: %+v", rs)
+	}
+
+	rs = statArray[3]
+	if rs.Number != 3 || rs.Rule == nil || rs.Rule.Anchor != "blacklistd/*" || rs.Text != `anchor "blacklistd/*" all` {
+		t.Errorf("unexpected stats for anchor call: %+v", rs)
+	}
+}
+
+// TestParseRuleStats tests the parsing of invalid pfctl -vv -s rules output
+func TestParseRuleStats(t *testing.T) {
+	testTable := []struct {
+		testName   string
+		output     []string
+		shouldFail bool
+	}{
+		{"Empty output", []string{}, false},
+		{"Rule without counters", []string{"@0 pass all"}, false},
+		{"Counters without rule", []string{"  [ Evaluations: 1 Packets: 0 Bytes: 0 States: 0 ]"}, true},
+		{"Rule without number", []string{"pass all"}, true},
+		{"Invalid last active time", []string{"@0 pass all", "  [ Last Active Time: yesterday ]"}, true},
+	}
+	for _, testCase := range testTable {
+		t.Run(testCase.testName, func(t *testing.T) {
+			_, err := parseRuleStats(testCase.output)
+			if err != nil && !testCase.shouldFail {
+				t.Errorf("parseRuleStats failed: %s", err)
+			}
+			if err == nil && testCase.shouldFail {
+				t.Errorf("parseRuleStats was supposed to fail, but didn't")
+			}
+		})
+	}
+}
+
+// TestFirewall_LabelStats tests the parsing and aggregation of the pfctl -s labels output
+func TestFirewall_LabelStats(t *testing.T) {
+	labelOutput, err := os.ReadFile("testdata/pfctl-s-labels.txt")
+	if err != nil {
+		t.Fatalf("failed to read test data: %s", err)
+	}
+	f, r := newTestFirewall(t)
+	r.On(pftest.Response{Stdout: string(labelOutput)}, "-s", "labels")
+	statArray, err := f.LabelStats()
+	if err != nil {
+		t.Fatalf("LabelStats failed: %s", err)
+	}
+	if len(statArray) != 2 {
+		t.Fatalf("unexpected number of labels. Expected: %d, got: %d", 2, len(statArray))
+	}
+	ls := statArray[0]
+	if ls.Label != "web" || ls.Rules != 2 || ls.Evaluations != 12130 || ls.Packets != 48713 ||
+		ls.BytesIn != 2432033 || ls.States != 15 {
+		t.Errorf("unexpected aggregated label stats: %+v", ls)
+	}
+	ls = statArray[1]
+	if ls.Label != "ssh em0" || ls.Rules != 1 || ls.PacketsOut != 60 || ls.States != 2 {
+		t.Errorf("unexpected label stats: %+v", ls)
+	}
+
+	if _, err := parseLabelStats([]string{"web 1 2 3"}); err == nil {
+		t.Errorf("parseLabelStats was supposed to fail on missing counters")
+	}
+	if _, err := parseLabelStats([]string{"web 1 2 3 4 5 6 7 x"}); err == nil {
+		t.Errorf("parseLabelStats was supposed to fail on invalid counters")
+	}
+}
+
+// TestFirewall_ZeroStats tests that the global statistics are read before they are cleared
+func TestFirewall_ZeroStats(t *testing.T) {
+	infoOutput, err := os.ReadFile("testdata/pfctl-vs-info.txt")
+	if err != nil {
+		t.Fatalf("failed to read test data: %s", err)
+	}
+	f, r := newTestFirewall(t)
+	r.On(pftest.Response{Stdout: string(infoOutput)}, "-v", "-s", "info")
+	r.On(pftest.Response{}, "-F", "info")
+	s, err := f.ZeroStats()
+	if err != nil {
+		t.Fatalf("ZeroStats failed: %s", err)
+	}
+	if !s.Running || len(s.Counters) == 0 {
+		t.Errorf("unexpected status: %+v", s)
+	}
+	callArray := r.Calls()
+	if len(callArray) != 2 || strings.Join(callArray[1].Args, " ") != "-q -F info" {
+		t.Errorf("unexpected pfctl calls: %+v", callArray)
+	}
+
+	r.On(pftest.Response{Stderr: "pfctl: /dev/pf: Permission denied\n", ExitCode: 1}, "-F", "info")
+	if _, err := f.ZeroStats(); err == nil {
+		t.Errorf("ZeroStats was supposed to fail, but didn't")
+	}
+}
+
+// TestFirewall_ZeroRuleCounters tests that the rule counters are returned and cleared at once
+func TestFirewall_ZeroRuleCounters(t *testing.T) {
+	ruleOutput, err := os.ReadFile("testdata/pfctl-vvsr.txt")
+	if err != nil {
+		t.Fatalf("failed to read test data: %s", err)
+	}
+	testTable := []struct {
+		testName string
+		anchor   string
+		args     []string
+	}{
+		{"Main ruleset", "", []string{"-vv", "-s", "rules", "-z"}},
+		{"Anchor", "go-pf", []string{"-a", "go-pf", "-vv", "-s", "rules", "-z"}},
+	}
+	for _, testCase := range testTable {
+		t.Run(testCase.testName, func(t *testing.T) {
+			f, r := newTestFirewall(t)
+			r.On(pftest.Response{Stdout: string(ruleOutput)}, testCase.args...)
+			statArray, err := f.ZeroRuleCounters(testCase.anchor)
+			if err != nil {
+				t.Fatalf("ZeroRuleCounters failed: %s", err)
+			}
+			if len(statArray) != 4 || statArray[2].Packets != 48213 {
+				t.Errorf("unexpected rule stats: %+v", statArray)
+			}
+		})
+	}
+}
+
+// TestFirewall_ZeroTableCounters tests the clearing of table entry statistics
+func TestFirewall_ZeroTableCounters(t *testing.T) {
+	testTable := []struct {
+		testName   string
+		addrs      []string
+		args       string
+		stderr     string
+		want       TableResult
+		shouldFail bool
+	}{
+		{"All entries", nil, "-t blocklist -T zero", "1 table/stats cleared.\n", TableResult{Cleared: 1}, false},
+		{"Single addresses", []string{"192.0.2.1", "198.51.100.0/24", "203.0.113.5"},
+			"-t blocklist -T zero 192.0.2.1 198.51.100.0/24 203.0.113.5", "2/3 stats cleared.\n",
+			TableResult{Cleared: 2, Ignored: 1, Total: 3}, false},
+		{"Invalid address", []string{"foo"}, "", "", TableResult{}, true},
+	}
+	for _, testCase := range testTable {
+		t.Run(testCase.testName, func(t *testing.T) {
+			f, r := newTestFirewall(t)
+			r.Fallback = pftest.Response{Stderr: testCase.stderr}
+			tr, err := f.ZeroTableCounters("blocklist", testCase.addrs...)
+			if err != nil && !testCase.shouldFail {
+				t.Fatalf("ZeroTableCounters failed: %s", err)
+			}
+			if err == nil && testCase.shouldFail {
+				t.Fatalf("ZeroTableCounters was supposed to fail, but didn't")
+			}
+			if testCase.shouldFail {
+				return
+			}
+			c, _ := r.LastCall()
+			if strings.Join(c.Args, " ") != testCase.args {
+				t.Errorf("unexpected pfctl arguments. Expected: %q, got: %q", testCase.args, c.Args)
+			}
+			if tr != testCase.want {
+				t.Errorf("unexpected table result. Expected: %+v, got: %+v", testCase.want, tr)
+			}
+		})
+	}
+}
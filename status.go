@@ -0,0 +1,176 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package pf
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// statusRegex matches the status line of the pfctl -s info output
+var statusRegex = regexp.MustCompile(`^Status: (Enabled|Disabled)(?: for (\d+) days (\d+):(\d+):(\d+))?` +
+	`(?:\s+Debug: (\S+))?`)
+
+// Status represents the runtime status and statistics of the packet filter as reported by pfctl -s info
+type Status struct {
+	Running        bool
+	Since          time.Duration
+	Debug          string
+	HostID         string
+	Checksum       string
+	StateTable     TableStats
+	SourceTracking TableStats
+	Counters       map[string]Counter
+	LimitCounters  map[string]Counter
+}
+
+// TableStats represents the statistics of the state table or source tracking table of the packet filter
+type TableStats struct {
+	CurrentEntries uint64
+	Searches       Counter
+	Inserts        Counter
+	Removals       Counter
+}
+
+// Counter represents a single pf counter with its total and its rate per second
+type Counter struct {
+	Total uint64
+	Rate  float64
+}
+
+// Info returns the runtime status and statistics of the packet filter
+func (f *Firewall) Info() (Status, error) {
+	return f.InfoContext(context.Background())
+}
+
+// InfoContext returns the runtime status and statistics of the packet filter. The given context
+// is used for the pfctl execution
+func (f *Firewall) InfoContext(ctx context.Context) (Status, error) {
+	infoOutput, err := f.execPfCtl(ctx, "-v", "-s", "info")
+	if err != nil {
+		return Status{}, err
+	}
+	return parseStatus(infoOutput)
+}
+
+// parseStatus parses the output of pfctl -s info or pfctl -vs info into a Status
+func parseStatus(o []string) (Status, error) {
+	s := Status{
+		Counters:      make(map[string]Counter),
+		LimitCounters: make(map[string]Counter),
+	}
+	statusFound := false
+	section := ""
+	for _, l := range o {
+		if strings.TrimSpace(l) == "" {
+			continue
+		}
+
+		// Section content is indented, everything else is a header or key/value line. The content
+		// of sections we do not know (i. e. interface stats) is skipped
+		if strings.HasPrefix(l, " ") || strings.HasPrefix(l, "\t") {
+			if section == "" {
+				continue
+			}
+			name, c, err := parseCounterLine(l)
+			if err != nil {
+				return s, err
+			}
+			switch section {
+			case "State Table":
+				s.StateTable.set(name, c)
+			case "Source Tracking Table":
+				s.SourceTracking.set(name, c)
+			case "Counters":
+				s.Counters[name] = c
+			case "Limit Counters":
+				s.LimitCounters[name] = c
+			}
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(l, "Status:"):
+			m := statusRegex.FindStringSubmatch(l)
+			if m == nil {
+				return s, fmt.Errorf("failed to parse status line: %q", l)
+			}
+			statusFound = true
+			s.Running = m[1] == "Enabled"
+			if m[2] != "" {
+				days, _ := strconv.Atoi(m[2])
+				hours, _ := strconv.Atoi(m[3])
+				mins, _ := strconv.Atoi(m[4])
+				secs, _ := strconv.Atoi(m[5])
+				s.Since = time.Duration(days)*time.Hour*24 + time.Duration(hours)*time.Hour +
+					time.Duration(mins)*time.Minute + time.Duration(secs)*time.Second
+			}
+			s.Debug = m[6]
+		case strings.HasPrefix(l, "Hostid:"):
+			s.HostID = strings.TrimSpace(strings.TrimPrefix(l, "Hostid:"))
+		case strings.HasPrefix(l, "Checksum:"):
+			s.Checksum = strings.TrimSpace(strings.TrimPrefix(l, "Checksum:"))
+		case strings.HasPrefix(l, "State Table"):
+			section = "State Table"
+		case strings.HasPrefix(l, "Source Tracking Table"):
+			section = "Source Tracking Table"
+		case strings.HasPrefix(l, "Limit Counters"):
+			section = "Limit Counters"
+		case strings.HasPrefix(l, "Counters"):
+			section = "Counters"
+		default:
+			section = ""
+		}
+	}
+	if !statusFound {
+		return s, fmt.Errorf("no status line found in pfctl output")
+	}
+	return s, nil
+}
+
+// parseCounterLine parses a single counter line in the form of "name   total   rate/s" of the
+// pfctl -s info output
+func parseCounterLine(l string) (string, Counter, error) {
+	c := Counter{}
+	fieldArray := strings.Fields(l)
+	if len(fieldArray) < 2 {
+		return "", c, fmt.Errorf("failed to parse counter line: %q", l)
+	}
+	n := len(fieldArray)
+	if strings.HasSuffix(fieldArray[n-1], "/s") {
+		rate, err := strconv.ParseFloat(strings.TrimSuffix(fieldArray[n-1], "/s"), 64)
+		if err != nil {
+			return "", c, fmt.Errorf("failed to parse counter rate: %q", l)
+		}
+		c.Rate = rate
+		n--
+	}
+	if n < 2 {
+		return "", c, fmt.Errorf("failed to parse counter line: %q", l)
+	}
+	total, err := strconv.ParseUint(fieldArray[n-1], 10, 64)
+	if err != nil {
+		return "", c, fmt.Errorf("failed to parse counter total: %q", l)
+	}
+	c.Total = total
+	return strings.Join(fieldArray[:n-1], " "), c, nil
+}
+
+// set assigns the given Counter to the TableStats field of the given name
+func (t *TableStats) set(n string, c Counter) {
+	switch n {
+	case "current entries":
+		t.CurrentEntries = c.Total
+	case "searches":
+		t.Searches = c
+	case "inserts":
+		t.Inserts = c
+	case "removals":
+		t.Removals = c
+	}
+}
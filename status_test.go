@@ -0,0 +1,64 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package pf
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/wneessen/go-pf/pftest"
+)
+
+// TestFirewall_Info tests the parsing of the pfctl -vs info output into a Status
+func TestFirewall_Info(t *testing.T) {
+	infoOutput, err := os.ReadFile("testdata/pfctl-vs-info.txt")
+	if err != nil {
+		t.Fatalf("failed to read test data: %s", err)
+	}
+	f, r := newTestFirewall(t)
+	r.On(pftest.Response{Stdout: string(infoOutput)}, "-v", "-s", "info")
+
+	s, err := f.Info()
+	if err != nil {
+		t.Fatalf("Info failed: %s", err)
+	}
+	if !s.Running {
+		t.Errorf("packet filter is expected to be running")
+	}
+	since := time.Hour*24*12 + time.Hour*3 + time.Minute*4 + time.Second*5
+	if s.Since != since {
+		t.Errorf("unexpected since duration. Expected: %s, got: %s", since, s.Since)
+	}
+	if s.Debug != "Urgent" || s.HostID != "0x2bb2e0fb" || s.Checksum != "0x7f5e0c2a4e0f4b7c8e2a1d9f3c4b5a6d" {
+		t.Errorf("unexpected debug level, hostid or checksum: %+v", s)
+	}
+	if s.StateTable.CurrentEntries != 22 || s.StateTable.Searches.Total != 12345678 ||
+		s.StateTable.Searches.Rate != 11.8 {
+		t.Errorf("unexpected state table stats: %+v", s.StateTable)
+	}
+	if s.SourceTracking.CurrentEntries != 3 || s.SourceTracking.Inserts.Total != 42 {
+		t.Errorf("unexpected source tracking stats: %+v", s.SourceTracking)
+	}
+	if len(s.Counters) != 16 || s.Counters["match"].Total != 234567 || s.Counters["match"].Rate != 0.2 {
+		t.Errorf("unexpected counters: %+v", s.Counters)
+	}
+	if len(s.LimitCounters) != 10 || s.LimitCounters["overload table insertion"].Total != 2 {
+		t.Errorf("unexpected limit counters: %+v", s.LimitCounters)
+	}
+}
+
+// TestParseStatus_Disabled tests the parsing of the status of a disabled packet filter
+func TestParseStatus_Disabled(t *testing.T) {
+	s, err := parseStatus([]string{"Status: Disabled for 0 days 00:00:10           Debug: None"})
+	if err != nil {
+		t.Fatalf("parseStatus failed: %s", err)
+	}
+	if s.Running || s.Since != time.Second*10 || s.Debug != "None" {
+		t.Errorf("unexpected status: %+v", s)
+	}
+	if _, err := parseStatus([]string{"foo"}); err == nil {
+		t.Errorf("parseStatus was supposed to fail without status line")
+	}
+}
@@ -1,40 +1,64 @@
-// +build !windows,!plan9,!linux
+//go:build !windows && !plan9
+// +build !windows,!plan9
 
 package pf
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
-	"log"
 	"net"
+	"net/netip"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 )
 
+// AnchorTables returns a copy of the Firewall whose table operations (i. e. TableAdd or TableEntries)
+// work on the tables of the given anchor instead of the tables of the main ruleset
+func (f *Firewall) AnchorTables(a string) *Firewall {
+	fwObj := *f
+	fwObj.tableAnchor = a
+	return &fwObj
+}
+
 // GetTables returns a string array of currently configured firewall table
 func (f *Firewall) GetTables() ([]string, error) {
-	return f.execPfCtl("-s", "Tables")
+	return f.GetTablesContext(context.Background())
+}
+
+// GetTablesContext returns a string array of currently configured firewall table. The given context
+// is used for the pfctl execution
+func (f *Firewall) GetTablesContext(ctx context.Context) ([]string, error) {
+	return f.execPfCtl(ctx, f.tableArgs("-s", "Tables")...)
 }
 
 // AddToTableCIDR adds one or more CIDR entries to a pf radix table.
 // Returns error on parsing failures or execution issues
 func (f *Firewall) AddToTableCIDR(t string, e ...string) error {
-	errArray := make([]string, 0)
+	return f.AddToTableCIDRContext(context.Background(), t, e...)
+}
 
+// AddToTableCIDRContext adds one or more CIDR entries to a pf radix table.
+// Returns error on parsing failures or execution issues. All entries are validated before
+// anything is passed to pfctl in bulk. The given context is used for the pfctl executions
+func (f *Firewall) AddToTableCIDRContext(ctx context.Context, t string, e ...string) error {
+	prefixArray := make([]netip.Prefix, 0, len(e))
 	for _, cidrEntry := range e {
-		ipAddr, _, err := net.ParseCIDR(cidrEntry)
-		if err != nil {
-			log.Printf("CIDR parsing for CIDR entry %q failed: %s", cidrEntry, err)
-			continue
-		}
-
-		_, err = f.execPfCtl("-t", t, "-T", "add", ipAddr.String())
+		prefix, err := netip.ParsePrefix(cidrEntry)
 		if err != nil {
-			errArray = append(errArray, err.Error())
+			return fmt.Errorf("CIDR parsing for CIDR entry %q failed: %w", cidrEntry, err)
 		}
+		prefixArray = append(prefixArray, prefix.Masked())
 	}
 
-	if len(errArray) > 0 {
-		return fmt.Errorf("One or more errors occurred adding IP(s) to table: %s",
-			strings.Join(errArray, ", "))
+	if _, err := f.execTableBulk(ctx, t, "add", len(prefixArray), prefixAppender(prefixArray), true); err != nil {
+		return fmt.Errorf("One or more errors occurred adding IP(s) to table: %w", err)
+	}
+	if _, err := f.killAddedStates(ctx, prefixNetworks(prefixArray)); err != nil {
+		return fmt.Errorf("failed to kill states of IP(s) added to table: %w", err)
 	}
 
 	return nil
@@ -43,24 +67,27 @@ func (f *Firewall) AddToTableCIDR(t string, e ...string) error {
 // AddToTableIP adds one or more IP entries to a pf radix table.
 // Returns error on parsing failures or execution issues
 func (f *Firewall) AddToTableIP(t string, e ...string) error {
-	errArray := make([]string, 0)
+	return f.AddToTableIPContext(context.Background(), t, e...)
+}
 
+// AddToTableIPContext adds one or more IP entries to a pf radix table.
+// Returns error on parsing failures or execution issues. All entries are validated before
+// anything is passed to pfctl in bulk. The given context is used for the pfctl executions
+func (f *Firewall) AddToTableIPContext(ctx context.Context, t string, e ...string) error {
+	prefixArray := make([]netip.Prefix, 0, len(e))
 	for _, ipEntry := range e {
-		ipAddr := net.ParseIP(ipEntry)
-		if ipAddr == nil {
-			log.Printf("IP address parsing for IP entry %q failed", ipEntry)
-			continue
-		}
-
-		_, err := f.execPfCtl("-t", t, "-T", "add", ipAddr.String())
+		ipAddr, err := netip.ParseAddr(ipEntry)
 		if err != nil {
-			errArray = append(errArray, err.Error())
+			return fmt.Errorf("IP address parsing for IP entry %q failed: %w", ipEntry, err)
 		}
+		prefixArray = append(prefixArray, netip.PrefixFrom(ipAddr, ipAddr.BitLen()))
 	}
 
-	if len(errArray) > 0 {
-		return fmt.Errorf("One or more errors occurred adding IP(s) to table: %s",
-			strings.Join(errArray, ", "))
+	if _, err := f.execTableBulk(ctx, t, "add", len(prefixArray), prefixAppender(prefixArray), true); err != nil {
+		return fmt.Errorf("One or more errors occurred adding IP(s) to table: %w", err)
+	}
+	if _, err := f.killAddedStates(ctx, prefixNetworks(prefixArray)); err != nil {
+		return fmt.Errorf("failed to kill states of IP(s) added to table: %w", err)
 	}
 
 	return nil
@@ -69,24 +96,24 @@ func (f *Firewall) AddToTableIP(t string, e ...string) error {
 // RemoveFromTableCIDR adds one or more CIDR entries to a pf radix table.
 // Returns error on parsing failures or execution issues
 func (f *Firewall) RemoveFromTableCIDR(t string, e ...string) error {
-	errArray := make([]string, 0)
+	return f.RemoveFromTableCIDRContext(context.Background(), t, e...)
+}
 
+// RemoveFromTableCIDRContext adds one or more CIDR entries to a pf radix table.
+// Returns error on parsing failures or execution issues. All entries are validated before
+// anything is passed to pfctl in bulk. The given context is used for the pfctl executions
+func (f *Firewall) RemoveFromTableCIDRContext(ctx context.Context, t string, e ...string) error {
+	prefixArray := make([]netip.Prefix, 0, len(e))
 	for _, cidrEntry := range e {
-		ipAddr, _, err := net.ParseCIDR(cidrEntry)
+		prefix, err := netip.ParsePrefix(cidrEntry)
 		if err != nil {
-			log.Printf("CIDR parsing for CIDR entry %q failed: %s", cidrEntry, err)
-			continue
-		}
-
-		_, err = f.execPfCtl("-t", t, "-T", "delete", ipAddr.String())
-		if err != nil {
-			errArray = append(errArray, err.Error())
+			return fmt.Errorf("CIDR parsing for CIDR entry %q failed: %w", cidrEntry, err)
 		}
+		prefixArray = append(prefixArray, prefix.Masked())
 	}
 
-	if len(errArray) > 0 {
-		return fmt.Errorf("One or more errors occurred removing IP(s) from table: %s",
-			strings.Join(errArray, ", "))
+	if _, err := f.execTableBulk(ctx, t, "delete", len(prefixArray), prefixAppender(prefixArray), true); err != nil {
+		return fmt.Errorf("One or more errors occurred removing IP(s) from table: %w", err)
 	}
 
 	return nil
@@ -95,25 +122,582 @@ func (f *Firewall) RemoveFromTableCIDR(t string, e ...string) error {
 // RemoveFromTableIP adds one or more IP entries to a pf radix table.
 // Returns error on parsing failures or execution issues
 func (f *Firewall) RemoveFromTableIP(t string, e ...string) error {
-	errArray := make([]string, 0)
+	return f.RemoveFromTableIPContext(context.Background(), t, e...)
+}
 
+// RemoveFromTableIPContext adds one or more IP entries to a pf radix table.
+// Returns error on parsing failures or execution issues. All entries are validated before
+// anything is passed to pfctl in bulk. The given context is used for the pfctl executions
+func (f *Firewall) RemoveFromTableIPContext(ctx context.Context, t string, e ...string) error {
+	prefixArray := make([]netip.Prefix, 0, len(e))
 	for _, ipEntry := range e {
-		ipAddr := net.ParseIP(ipEntry)
-		if ipAddr == nil {
-			log.Printf("IP address parsing for IP entry %q failed", ipEntry)
+		ipAddr, err := netip.ParseAddr(ipEntry)
+		if err != nil {
+			return fmt.Errorf("IP address parsing for IP entry %q failed: %w", ipEntry, err)
+		}
+		prefixArray = append(prefixArray, netip.PrefixFrom(ipAddr, ipAddr.BitLen()))
+	}
+
+	if _, err := f.execTableBulk(ctx, t, "delete", len(prefixArray), prefixAppender(prefixArray), true); err != nil {
+		return fmt.Errorf("One or more errors occurred removing IP(s) from table: %w", err)
+	}
+
+	return nil
+}
+
+// TableAddPrefixes adds the given prefixes to the given pf table. The prefixes are streamed to
+// pfctl in chunks of the Firewall table chunk size without any string conversion. Invalid prefixes
+// are rejected before anything is passed to pfctl
+func (f *Firewall) TableAddPrefixes(t string, p []netip.Prefix) (TableResult, error) {
+	return f.TableAddPrefixesContext(context.Background(), t, p)
+}
+
+// TableAddPrefixesContext adds the given prefixes to the given pf table. The given context is used
+// for the pfctl executions
+func (f *Firewall) TableAddPrefixesContext(ctx context.Context, t string, p []netip.Prefix) (TableResult, error) {
+	if err := validatePrefixes(p); err != nil {
+		return TableResult{}, err
+	}
+	tr, err := f.execTableBulk(ctx, t, "add", len(p), prefixAppender(p), true)
+	if err != nil {
+		return tr, err
+	}
+	tr.StatesKilled, err = f.killAddedStates(ctx, prefixNetworks(p))
+	return tr, err
+}
+
+// TableDeletePrefixes deletes the given prefixes from the given pf table. The prefixes are streamed
+// to pfctl in chunks of the Firewall table chunk size without any string conversion. Invalid
+// prefixes are rejected before anything is passed to pfctl
+func (f *Firewall) TableDeletePrefixes(t string, p []netip.Prefix) (TableResult, error) {
+	return f.TableDeletePrefixesContext(context.Background(), t, p)
+}
+
+// TableDeletePrefixesContext deletes the given prefixes from the given pf table. The given context
+// is used for the pfctl executions
+func (f *Firewall) TableDeletePrefixesContext(ctx context.Context, t string, p []netip.Prefix) (TableResult, error) {
+	if err := validatePrefixes(p); err != nil {
+		return TableResult{}, err
+	}
+	return f.execTableBulk(ctx, t, "delete", len(p), prefixAppender(p), true)
+}
+
+// TableReplacePrefixes atomically replaces all entries of the given pf table with the given
+// prefixes. Invalid prefixes are rejected before anything is passed to pfctl
+func (f *Firewall) TableReplacePrefixes(t string, p []netip.Prefix) (TableResult, error) {
+	return f.TableReplacePrefixesContext(context.Background(), t, p)
+}
+
+// TableReplacePrefixesContext atomically replaces all entries of the given pf table with the given
+// prefixes. The given context is used for the pfctl execution
+func (f *Firewall) TableReplacePrefixesContext(ctx context.Context, t string, p []netip.Prefix) (TableResult, error) {
+	if err := validatePrefixes(p); err != nil {
+		return TableResult{}, err
+	}
+	return f.execTableBulk(ctx, t, "replace", len(p), prefixAppender(p), false)
+}
+
+// TableEntry represents a single address entry of a pf table
+type TableEntry struct {
+	Address  *net.IPNet
+	Negated  bool
+	Cleared  time.Time
+	InBlock  TableCounter
+	InPass   TableCounter
+	InXPass  TableCounter
+	OutBlock TableCounter
+	OutPass  TableCounter
+	OutXPass TableCounter
+}
+
+// TableCounter represents the packet and byte counters of a TableEntry
+type TableCounter struct {
+	Packets uint64
+	Bytes   uint64
+}
+
+// TableResult represents the result of a table operation as reported by pfctl. Total is the number
+// of addresses given to the operation and Ignored the number of those that had no effect (i. e.
+// addresses that were already present on add). StatesKilled is the number of states killed after
+// an add, if the Firewall is set to kill the states of added addresses
+type TableResult struct {
+	Added         int
+	Deleted       int
+	Changed       int
+	Expired       int
+	Cleared       int
+	Matched       int
+	Ignored       int
+	Total         int
+	TablesDeleted int
+	StatesKilled  int
+}
+
+// TableTestResult represents the result of a table test
+type TableTestResult struct {
+	Matched int
+	Total   int
+	Matches []*net.IPNet
+}
+
+// tableSummaryRegex matches the summary lines pfctl prints after a table operation
+var tableSummaryRegex = regexp.MustCompile(`^(\d+)(?:/(\d+))? (?:addresses|table/stats|tables?|stats) ` +
+	`(added|deleted|changed|expired|cleared|match)`)
+
+// tableCounterRegex matches the counter lines of the pfctl -T show -vv output
+var tableCounterRegex = regexp.MustCompile(`^(In|Out)/(Block|Pass|XPass):\s+\[ Packets: (\d+)\s+Bytes: (\d+)\s+]`)
+
+// TableEntries returns all entries of the given pf table including their counters
+func (f *Firewall) TableEntries(t string) ([]TableEntry, error) {
+	return f.TableEntriesContext(context.Background(), t)
+}
+
+// TableEntriesContext returns all entries of the given pf table including their counters. The
+// given context is used for the pfctl execution
+func (f *Firewall) TableEntriesContext(ctx context.Context, t string) ([]TableEntry, error) {
+	showOutput, err := f.execPfCtl(ctx, f.tableArgs("-vv", "-t", t, "-T", "show")...)
+	if err != nil {
+		return nil, err
+	}
+	return parseTableEntries(showOutput)
+}
+
+// TableTest tests the given addresses against the given pf table and returns which of them match
+func (f *Firewall) TableTest(t string, e ...string) (TableTestResult, error) {
+	return f.TableTestContext(context.Background(), t, e...)
+}
+
+// TableTestContext tests the given addresses against the given pf table and returns which of them
+// match. The given context is used for the pfctl execution
+func (f *Firewall) TableTestContext(ctx context.Context, t string, e ...string) (TableTestResult, error) {
+	tr := TableTestResult{}
+	addrArray, err := tableAddrArgs(e)
+	if err != nil {
+		return tr, err
+	}
+	argArray := f.tableArgs(append([]string{"-v", "-t", t, "-T", "test"}, addrArray...)...)
+	stdoutArray, stderrArray, err := f.execPfCtlSummary(ctx, nil, argArray...)
+
+	// pfctl exits with status 2 if not all addresses match
+	var pfErr *PfctlError
+	if err != nil && !(errors.As(err, &pfErr) && pfErr.ExitCode == 2) {
+		return tr, err
+	}
+	res := parseTableSummary(stderrArray)
+	tr.Matched, tr.Total = res.Matched, res.Total
+	for _, l := range stdoutArray {
+		if strings.TrimSpace(l) == "" {
+			continue
+		}
+		fb, te, err := parseTableFeedbackLine(l)
+		if err != nil {
+			return tr, err
+		}
+		if fb == 'M' {
+			tr.Matches = append(tr.Matches, te.Address)
+		}
+	}
+	return tr, nil
+}
+
+// TableReplace atomically replaces all entries of the given pf table with the given addresses
+func (f *Firewall) TableReplace(t string, e ...string) (TableResult, error) {
+	return f.TableReplaceContext(context.Background(), t, e...)
+}
+
+// TableReplaceContext atomically replaces all entries of the given pf table with the given
+// addresses. The given context is used for the pfctl execution. To keep the replacement atomic,
+// the addresses are streamed to a single pfctl invocation and never split into chunks
+func (f *Firewall) TableReplaceContext(ctx context.Context, t string, e ...string) (TableResult, error) {
+	addrArray, err := tableAddrArgs(e)
+	if err != nil {
+		return TableResult{}, err
+	}
+	return f.execTableBulk(ctx, t, "replace", len(addrArray), stringAppender(addrArray), false)
+}
+
+// TableAdd adds the given addresses to the given pf table. The addresses are streamed to pfctl in
+// chunks of the Firewall table chunk size
+func (f *Firewall) TableAdd(t string, e ...string) (TableResult, error) {
+	return f.TableAddContext(context.Background(), t, e...)
+}
+
+// TableAddContext adds the given addresses to the given pf table. The addresses are streamed to pfctl
+// in chunks of the Firewall table chunk size. The given context is used for the pfctl executions
+func (f *Firewall) TableAddContext(ctx context.Context, t string, e ...string) (TableResult, error) {
+	addrArray, err := tableAddrArgs(e)
+	if err != nil {
+		return TableResult{}, err
+	}
+	tr, err := f.execTableBulk(ctx, t, "add", len(addrArray), stringAppender(addrArray), true)
+	if err != nil {
+		return tr, err
+	}
+	netArray := make([]*net.IPNet, 0, len(addrArray))
+	for _, a := range addrArray {
+		ipNet, _ := parseTableAddr(a)
+		netArray = append(netArray, ipNet)
+	}
+	tr.StatesKilled, err = f.killAddedStates(ctx, netArray)
+	return tr, err
+}
+
+// TableDelete deletes the given addresses from the given pf table. The addresses are streamed to
+// pfctl in chunks of the Firewall table chunk size
+func (f *Firewall) TableDelete(t string, e ...string) (TableResult, error) {
+	return f.TableDeleteContext(context.Background(), t, e...)
+}
+
+// TableDeleteContext deletes the given addresses from the given pf table. The addresses are streamed
+// to pfctl in chunks of the Firewall table chunk size. The given context is used for the pfctl executions
+func (f *Firewall) TableDeleteContext(ctx context.Context, t string, e ...string) (TableResult, error) {
+	addrArray, err := tableAddrArgs(e)
+	if err != nil {
+		return TableResult{}, err
+	}
+	return f.execTableBulk(ctx, t, "delete", len(addrArray), stringAppender(addrArray), true)
+}
+
+// TableFlush deletes all entries of the given pf table
+func (f *Firewall) TableFlush(t string) (TableResult, error) {
+	return f.TableFlushContext(context.Background(), t)
+}
+
+// TableFlushContext deletes all entries of the given pf table. The given context is used for the
+// pfctl execution
+func (f *Firewall) TableFlushContext(ctx context.Context, t string) (TableResult, error) {
+	return f.execTableCmd(ctx, t, "flush")
+}
+
+// TableExpire deletes all entries of the given pf table whose statistics have not been cleared
+// within the given age
+func (f *Firewall) TableExpire(t string, a time.Duration) (TableResult, error) {
+	return f.TableExpireContext(context.Background(), t, a)
+}
+
+// TableExpireContext deletes all entries of the given pf table whose statistics have not been
+// cleared within the given age. The given context is used for the pfctl execution
+func (f *Firewall) TableExpireContext(ctx context.Context, t string, a time.Duration) (TableResult, error) {
+	if a < 0 {
+		return TableResult{}, fmt.Errorf("negative expire age given")
+	}
+	return f.execTableCmd(ctx, t, "expire", strconv.FormatInt(int64(a/time.Second), 10))
+}
+
+// TableZero clears the statistics of the given pf table
+func (f *Firewall) TableZero(t string) (TableResult, error) {
+	return f.TableZeroContext(context.Background(), t)
+}
+
+// TableZeroContext clears the statistics of the given pf table. The given context is used for the
+// pfctl execution
+func (f *Firewall) TableZeroContext(ctx context.Context, t string) (TableResult, error) {
+	return f.execTableCmd(ctx, t, "zero")
+}
+
+// TableKill deletes the given pf table
+func (f *Firewall) TableKill(t string) (TableResult, error) {
+	return f.TableKillContext(context.Background(), t)
+}
+
+// TableKillContext deletes the given pf table. The given context is used for the pfctl execution
+func (f *Firewall) TableKillContext(ctx context.Context, t string) (TableResult, error) {
+	return f.execTableCmd(ctx, t, "kill")
+}
+
+// execTableCmd executes the given table command with the given arguments and parses the summary
+// pfctl reports into a TableResult
+func (f *Firewall) execTableCmd(ctx context.Context, t, c string, a ...string) (TableResult, error) {
+	argArray := f.tableArgs(append([]string{"-t", t, "-T", c}, a...)...)
+	_, stderrArray, err := f.execPfCtlSummary(ctx, nil, argArray...)
+	if err != nil {
+		return TableResult{}, err
+	}
+	return parseTableSummary(stderrArray), nil
+}
+
+// execTableBulk streams n addresses to pfctl for the given table command via stdin. The addresses
+// are appended to the stdin buffer by the given addrAppender. If c is true, the addresses are split
+// into chunks of the Firewall table chunk size, each with its own pfctl invocation. The summaries
+// of all invocations are added up. Failed chunks are returned as ErrorList, the remaining chunks
+// are still processed unless the context is done
+func (f *Firewall) execTableBulk(ctx context.Context, t, cmd string, n int, w addrAppender, c bool) (TableResult, error) {
+	tr := TableResult{}
+	if n == 0 && cmd != "replace" {
+		return tr, nil
+	}
+	chunkSize := n
+	if c {
+		chunkSize = f.tableChunkSize
+		if chunkSize <= 0 {
+			chunkSize = DefaultTableChunkSize
+		}
+	}
+
+	var errList ErrorList
+	var addrBuffer []byte
+	argArray := f.tableArgs("-t", t, "-T", cmd, "-f", "-")
+	for start := 0; start == 0 || start < n; start += chunkSize {
+		// The remaining chunks are reported like a pfctl execution that exceeded the context
+		if ctx.Err() != nil {
+			errList = append(errList, newPfctlError(argArray, -1, nil, ctx.Err()))
+			break
+		}
+		end := start + chunkSize
+		if end > n {
+			end = n
+		}
+		addrBuffer = addrBuffer[:0]
+		for i := start; i < end; i++ {
+			addrBuffer = w(addrBuffer, i)
+			addrBuffer = append(addrBuffer, '\n')
+		}
+		_, stderrArray, err := f.execPfCtlSummary(ctx, bytes.NewReader(addrBuffer), argArray...)
+		if err != nil {
+			errList = append(errList, err)
+		} else {
+			tr.add(parseTableSummary(stderrArray))
+		}
+		if chunkSize == 0 {
+			break
+		}
+	}
+
+	if len(errList) > 0 {
+		return tr, errList
+	}
+	return tr, nil
+}
+
+// tableArgs returns the given pfctl arguments of a table operation, prefixed with the anchor the
+// table operations of the Firewall are scoped to
+func (f *Firewall) tableArgs(a ...string) []string {
+	if f.tableAnchor == "" {
+		return a
+	}
+	return append([]string{"-a", f.tableAnchor}, a...)
+}
+
+// addrAppender appends the table address with the given index to the given buffer
+type addrAppender func(b []byte, i int) []byte
+
+// stringAppender returns an addrAppender for the given list of address strings
+func stringAppender(e []string) addrAppender {
+	return func(b []byte, i int) []byte {
+		return append(b, e[i]...)
+	}
+}
+
+// prefixAppender returns an addrAppender for the given list of validated prefixes. Single host
+// prefixes are appended as plain address, IPv4-mapped IPv6 prefixes as IPv4 prefix
+func prefixAppender(p []netip.Prefix) addrAppender {
+	return func(b []byte, i int) []byte {
+		prefix, err := unmapPrefix(p[i])
+		if err != nil {
+			prefix = p[i]
+		}
+		if prefix.IsSingleIP() {
+			return prefix.Addr().AppendTo(b)
+		}
+		return prefix.AppendTo(b)
+	}
+}
+
+// add adds the counters of the given TableResult to the TableResult
+func (tr *TableResult) add(o TableResult) {
+	tr.Added += o.Added
+	tr.Deleted += o.Deleted
+	tr.Changed += o.Changed
+	tr.Expired += o.Expired
+	tr.Cleared += o.Cleared
+	tr.Matched += o.Matched
+	tr.Ignored += o.Ignored
+	tr.Total += o.Total
+	tr.TablesDeleted += o.TablesDeleted
+	tr.StatesKilled += o.StatesKilled
+}
+
+// parseTableSummary parses the summary lines pfctl reports after a table operation into a TableResult
+func parseTableSummary(o []string) TableResult {
+	tr := TableResult{}
+	for _, l := range o {
+		m := tableSummaryRegex.FindStringSubmatch(strings.TrimSpace(l))
+		if m == nil {
+			continue
+		}
+		n, _ := strconv.Atoi(m[1])
+		total := -1
+		if m[2] != "" {
+			total, _ = strconv.Atoi(m[2])
+			tr.Total = total
+		}
+		switch m[3] {
+		case "added":
+			tr.Added = n
+		case "deleted":
+			if strings.Contains(l, "table") && !strings.Contains(l, "addresses") {
+				tr.TablesDeleted = n
+				continue
+			}
+			tr.Deleted = n
+		case "changed":
+			tr.Changed = n
+		case "expired":
+			tr.Expired = n
+		case "cleared":
+			tr.Cleared = n
+		case "match":
+			tr.Matched = n
+		}
+		if total >= n && m[3] != "match" {
+			tr.Ignored = total - n
+		}
+	}
+	return tr
+}
+
+// parseTableEntries parses the output of pfctl -T show (optionally with -vv) into a list of TableEntry
+func parseTableEntries(o []string) ([]TableEntry, error) {
+	entryArray := make([]TableEntry, 0)
+	for _, l := range o {
+		if strings.TrimSpace(l) == "" {
 			continue
 		}
 
-		_, err := f.execPfCtl("-t", t, "-T", "delete", ipAddr.String())
+		// Counter lines of -vv are indented by a tab and belong to the previous entry
+		if strings.HasPrefix(l, "\t") {
+			if len(entryArray) == 0 {
+				return entryArray, fmt.Errorf("table counters without entry: %q", l)
+			}
+			if err := parseTableEntryDetails(&entryArray[len(entryArray)-1], strings.TrimSpace(l)); err != nil {
+				return entryArray, err
+			}
+			continue
+		}
+
+		te, err := parseTableEntryLine(l)
+		if err != nil {
+			return entryArray, err
+		}
+		entryArray = append(entryArray, te)
+	}
+	return entryArray, nil
+}
+
+// parseTableEntryLine parses a single address line of the pfctl -T show output
+func parseTableEntryLine(l string) (TableEntry, error) {
+	te := TableEntry{}
+	addr := strings.TrimSpace(l)
+	if strings.HasPrefix(addr, "!") {
+		te.Negated = true
+		addr = strings.TrimSpace(strings.TrimPrefix(addr, "!"))
+	}
+	if fieldArray := strings.Fields(addr); len(fieldArray) > 0 {
+		addr = fieldArray[0]
+	}
+	ipNet, err := parseTableAddr(addr)
+	if err != nil {
+		return te, err
+	}
+	te.Address = ipNet
+	return te, nil
+}
+
+// parseTableFeedbackLine parses a single address line that pfctl prints with a leading feedback
+// column (i. e. "M  192.0.2.1" for a matching address of pfctl -v -T test). It returns the feedback
+// character and the address
+func parseTableFeedbackLine(l string) (byte, TableEntry, error) {
+	if len(l) < 4 || l[1] != ' ' {
+		return 0, TableEntry{}, fmt.Errorf("invalid table feedback line: %q", l)
+	}
+	te, err := parseTableEntryLine(l[2:])
+	return l[0], te, err
+}
+
+// parseTableEntryDetails parses a counter or timestamp line of the pfctl -T show -vv output into
+// the given TableEntry
+func parseTableEntryDetails(te *TableEntry, l string) error {
+	if strings.HasPrefix(l, "Cleared:") {
+		cleared, err := time.ParseInLocation(time.ANSIC, strings.TrimSpace(strings.TrimPrefix(l, "Cleared:")),
+			time.Local)
+		if err != nil {
+			return fmt.Errorf("failed to parse table entry timestamp %q: %w", l, err)
+		}
+		te.Cleared = cleared
+		return nil
+	}
+	m := tableCounterRegex.FindStringSubmatch(l)
+	if m == nil {
+		return nil
+	}
+	packets, _ := strconv.ParseUint(m[3], 10, 64)
+	bytes, _ := strconv.ParseUint(m[4], 10, 64)
+	tc := TableCounter{Packets: packets, Bytes: bytes}
+	switch m[1] + "/" + m[2] {
+	case "In/Block":
+		te.InBlock = tc
+	case "In/Pass":
+		te.InPass = tc
+	case "In/XPass":
+		te.InXPass = tc
+	case "Out/Block":
+		te.OutBlock = tc
+	case "Out/Pass":
+		te.OutPass = tc
+	case "Out/XPass":
+		te.OutXPass = tc
+	}
+	return nil
+}
+
+// parseTableAddr parses a table address in the form of an IP address or CIDR network
+func parseTableAddr(a string) (*net.IPNet, error) {
+	if strings.Contains(a, "/") {
+		_, ipNet, err := net.ParseCIDR(a)
 		if err != nil {
-			errArray = append(errArray, err.Error())
+			return nil, fmt.Errorf("invalid table address %q: %w", a, err)
 		}
+		return ipNet, nil
 	}
+	ipAddr := net.ParseIP(a)
+	if ipAddr == nil {
+		return nil, fmt.Errorf("invalid table address %q", a)
+	}
+	return hostNetwork(ipAddr), nil
+}
 
-	if len(errArray) > 0 {
-		return fmt.Errorf("One or more errors occurred removing IP(s) from table: %s",
-			strings.Join(errArray, ", "))
+// prefixNetworks converts the given valid prefixes into IPNets
+func prefixNetworks(p []netip.Prefix) []*net.IPNet {
+	netArray := make([]*net.IPNet, 0, len(p))
+	for _, prefix := range p {
+		if ipNet, err := prefixToIPNet(prefix); err == nil {
+			netArray = append(netArray, ipNet)
+		}
 	}
+	return netArray
+}
 
+// validatePrefixes makes sure that all given prefixes are valid and contain no host bits
+func validatePrefixes(p []netip.Prefix) error {
+	for i, prefix := range p {
+		if !prefix.IsValid() {
+			return fmt.Errorf("invalid prefix at index %d", i)
+		}
+		if prefix.Masked() != prefix {
+			return fmt.Errorf("prefix %s at index %d has host bits set", prefix, i)
+		}
+	}
 	return nil
 }
+
+// tableAddrArgs validates the given table addresses and returns them as pfctl arguments
+func tableAddrArgs(e []string) ([]string, error) {
+	addrArray := make([]string, 0, len(e))
+	for _, a := range e {
+		if _, err := parseTableAddr(a); err != nil {
+			return nil, err
+		}
+		addrArray = append(addrArray, a)
+	}
+	return addrArray, nil
+}
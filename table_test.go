@@ -0,0 +1,284 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package pf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wneessen/go-pf/pftest"
+)
+
+// TestFirewall_TableEntries tests the parsing of the pfctl -T show -vv output
+func TestFirewall_TableEntries(t *testing.T) {
+	showOutput, err := os.ReadFile("testdata/pfctl-vvT-show.txt")
+	if err != nil {
+		t.Fatalf("failed to read test data: %s", err)
+	}
+	f, r := newTestFirewall(t)
+	r.On(pftest.Response{Stdout: string(showOutput)}, "-vv", "-t", "blocklist", "-T", "show")
+	entryArray, err := f.TableEntries("blocklist")
+	if err != nil {
+		t.Fatalf("TableEntries failed: %s", err)
+	}
+	if len(entryArray) != 3 {
+		t.Fatalf("unexpected number of entries. Expected: 3, got: %d", len(entryArray))
+	}
+	if entryArray[0].Address.String() != "192.0.2.1/32" || entryArray[0].InBlock.Packets != 12 ||
+		entryArray[0].OutPass.Bytes != 180 {
+		t.Errorf("unexpected table entry: %+v", entryArray[0])
+	}
+	if entryArray[0].Cleared.Format("2006-01-02 15:04:05") != "2026-10-15 12:00:00" {
+		t.Errorf("unexpected cleared timestamp: %s", entryArray[0].Cleared)
+	}
+	if !entryArray[1].Negated || entryArray[1].Address.String() != "198.51.100.0/24" {
+		t.Errorf("unexpected negated table entry: %+v", entryArray[1])
+	}
+	if entryArray[2].Address.String() != "2001:db8::/32" || entryArray[2].Cleared.Day() != 2 {
+		t.Errorf("unexpected IPv6 table entry: %+v", entryArray[2])
+	}
+}
+
+// TestFirewall_TableOperations tests the pfctl arguments and the result parsing of the table operations
+func TestFirewall_TableOperations(t *testing.T) {
+	testTable := []struct {
+		testName string
+		op       func(f *Firewall) (TableResult, error)
+		args     string
+		stderr   string
+		want     TableResult
+	}{
+		{"Replace", func(f *Firewall) (TableResult, error) {
+			return f.TableReplace("blocklist", "192.0.2.1", "198.51.100.0/24")
+		}, "-t blocklist -T replace -f -", "1 addresses added.\n2 addresses deleted.\n",
+			TableResult{Added: 1, Deleted: 2}},
+		{"Flush", func(f *Firewall) (TableResult, error) { return f.TableFlush("blocklist") },
+			"-t blocklist -T flush", "3 addresses deleted.\n", TableResult{Deleted: 3}},
+		{"Expire", func(f *Firewall) (TableResult, error) { return f.TableExpire("blocklist", time.Hour) },
+			"-t blocklist -T expire 3600", "2/5 addresses expired.\n", TableResult{Expired: 2, Ignored: 3, Total: 5}},
+		{"Zero", func(f *Firewall) (TableResult, error) { return f.TableZero("blocklist") },
+			"-t blocklist -T zero", "1 table/stats cleared.\n", TableResult{Cleared: 1}},
+		{"Kill", func(f *Firewall) (TableResult, error) { return f.TableKill("blocklist") },
+			"-t blocklist -T kill", "1 table deleted.\n", TableResult{TablesDeleted: 1}},
+	}
+	for _, testCase := range testTable {
+		t.Run(testCase.testName, func(t *testing.T) {
+			f, r := newTestFirewall(t)
+			r.Fallback = pftest.Response{Stderr: testCase.stderr}
+			tr, err := testCase.op(&f)
+			if err != nil {
+				t.Fatalf("table operation failed: %s", err)
+			}
+			c, _ := r.LastCall()
+			if strings.Join(c.Args, " ") != testCase.args {
+				t.Errorf("unexpected pfctl arguments. Expected: %q, got: %q", testCase.args, c.Args)
+			}
+			if tr != testCase.want {
+				t.Errorf("unexpected table result. Expected: %+v, got: %+v", testCase.want, tr)
+			}
+		})
+	}
+
+	f, _ := newTestFirewall(t)
+	if _, err := f.TableReplace("blocklist", "foo"); err == nil {
+		t.Errorf("TableReplace with invalid address was supposed to fail")
+	}
+}
+
+// TestFirewall_TableTest tests TableTest including the partial match exit status
+func TestFirewall_TableTest(t *testing.T) {
+	testOutput, err := os.ReadFile("testdata/pfctl-vT-test.txt")
+	if err != nil {
+		t.Fatalf("failed to read test data: %s", err)
+	}
+	f, r := newTestFirewall(t)
+	r.Fallback = pftest.Response{Stdout: string(testOutput), Stderr: "2/3 addresses match.\n", ExitCode: 2}
+	tr, err := f.TableTest("blocklist", "192.0.2.1", "192.0.2.2", "2001:db8::1")
+	if err != nil {
+		t.Fatalf("TableTest failed: %s", err)
+	}
+	if tr.Matched != 2 || tr.Total != 3 || len(tr.Matches) != 2 || tr.Matches[0].String() != "192.0.2.1/32" ||
+		tr.Matches[1].String() != "2001:db8::1/128" {
+		t.Errorf("unexpected table test result: %+v", tr)
+	}
+
+	r.Fallback = pftest.Response{Stdout: "192.0.2.1\n", Stderr: "1/1 addresses match.\n"}
+	if _, err := f.TableTest("blocklist", "192.0.2.1"); err == nil {
+		t.Errorf("TableTest was supposed to fail on output without feedback column")
+	}
+
+	r.Fallback = pftest.Response{Stderr: "pfctl: Table does not exist.\n", ExitCode: 1}
+	if _, err := f.TableTest("blocklist", "192.0.2.1"); err == nil {
+		t.Errorf("TableTest was supposed to fail")
+	}
+}
+
+// TestFirewall_TableBulk tests that bulk table operations stream the addresses in chunks and add up
+// the pfctl summaries
+func TestFirewall_TableBulk(t *testing.T) {
+	f, r := newTestFirewall(t)
+	f.SetTableChunkSize(2)
+	r.Handle(func(c pftest.Call) (pftest.Response, bool) {
+		n := strings.Count(string(c.Stdin), "\n")
+		return pftest.Response{Stderr: fmt.Sprintf("%d/%d addresses added.\n", n-1, n)}, true
+	})
+	addrArray := []string{"192.0.2.1", "192.0.2.2", "192.0.2.3", "198.51.100.0/24", "2001:db8::1"}
+	tr, err := f.TableAdd("blocklist", addrArray...)
+	if err != nil {
+		t.Fatalf("TableAdd failed: %s", err)
+	}
+	if tr.Added != 2 || tr.Ignored != 3 || tr.Total != 5 {
+		t.Errorf("unexpected table result: %+v", tr)
+	}
+	callArray := r.Calls()
+	if len(callArray) != 3 {
+		t.Fatalf("unexpected number of pfctl invocations. Expected: 3, got: %d", len(callArray))
+	}
+	if strings.Join(callArray[0].Args, " ") != "-t blocklist -T add -f -" {
+		t.Errorf("unexpected pfctl arguments: %q", callArray[0].Args)
+	}
+	if string(callArray[2].Stdin) != "2001:db8::1\n" {
+		t.Errorf("unexpected stdin of last chunk: %q", string(callArray[2].Stdin))
+	}
+
+	r.Reset()
+	if _, err := f.TableReplace("blocklist", addrArray...); err != nil {
+		t.Fatalf("TableReplace failed: %s", err)
+	}
+	if len(r.Calls()) != 1 {
+		t.Errorf("TableReplace must not be split into chunks")
+	}
+
+	r.Reset()
+	if err := f.AddToTableIP("blocklist", "192.0.2.1", "192.0.2.2", "192.0.2.3"); err != nil {
+		t.Fatalf("AddToTableIP failed: %s", err)
+	}
+	if len(r.Calls()) != 2 {
+		t.Errorf("unexpected number of pfctl invocations. Expected: 2, got: %d", len(r.Calls()))
+	}
+}
+
+// TestFirewall_TablePrefixes tests the netip based table operations and the rejection of malformed input
+func TestFirewall_TablePrefixes(t *testing.T) {
+	f, r := newTestFirewall(t)
+	prefixArray := []netip.Prefix{netip.MustParsePrefix("192.0.2.1/32"), netip.MustParsePrefix("198.51.100.0/24"),
+		netip.MustParsePrefix("2001:db8::/32")}
+	if _, err := f.TableAddPrefixes("blocklist", prefixArray); err != nil {
+		t.Fatalf("TableAddPrefixes failed: %s", err)
+	}
+	c, _ := r.LastCall()
+	if string(c.Stdin) != "192.0.2.1\n198.51.100.0/24\n2001:db8::/32\n" {
+		t.Errorf("unexpected stdin: %q", string(c.Stdin))
+	}
+
+	mappedArray := []netip.Prefix{netip.MustParsePrefix("::ffff:192.0.2.0/120"),
+		netip.MustParsePrefix("::ffff:198.51.100.7/128")}
+	if _, err := f.TableAddPrefixes("blocklist", mappedArray); err != nil {
+		t.Fatalf("TableAddPrefixes failed: %s", err)
+	}
+	c, _ = r.LastCall()
+	if string(c.Stdin) != "192.0.2.0/24\n198.51.100.7\n" {
+		t.Errorf("IPv4-mapped prefixes were not unmapped: %q", string(c.Stdin))
+	}
+
+	r.Reset()
+	if _, err := f.TableDeletePrefixes("blocklist", []netip.Prefix{{}}); err == nil {
+		t.Errorf("TableDeletePrefixes with invalid prefix was supposed to fail")
+	}
+	if _, err := f.TableReplacePrefixes("blocklist", []netip.Prefix{netip.MustParsePrefix("192.0.2.1/24")}); err == nil {
+		t.Errorf("TableReplacePrefixes with host bits was supposed to fail")
+	}
+	if err := f.AddToTableIP("blocklist", "192.0.2.1", "foo"); err == nil {
+		t.Errorf("AddToTableIP with invalid address was supposed to fail")
+	}
+	if err := f.AddToTableCIDR("blocklist", "192.0.2.1/24", "bar"); err == nil {
+		t.Errorf("AddToTableCIDR with invalid network was supposed to fail")
+	}
+	if len(r.Calls()) != 0 {
+		t.Errorf("malformed input must not be passed to pfctl")
+	}
+
+	if err := f.AddToTableCIDR("blocklist", "192.0.2.1/24"); err != nil {
+		t.Fatalf("AddToTableCIDR failed: %s", err)
+	}
+	c, _ = r.LastCall()
+	if string(c.Stdin) != "192.0.2.0/24\n" {
+		t.Errorf("unexpected stdin: %q", string(c.Stdin))
+	}
+}
+
+// TestFirewall_AnchorTables tests that the table operations of AnchorTables are scoped to the anchor
+func TestFirewall_AnchorTables(t *testing.T) {
+	f, r := newTestFirewall(t)
+	at := f.AnchorTables("go-pf")
+	testTable := []struct {
+		testName string
+		op       func() error
+		args     string
+	}{
+		{"Tables", func() error { _, err := at.GetTables(); return err }, "-q -a go-pf -s Tables"},
+		{"Entries", func() error { _, err := at.TableEntries("blocklist"); return err },
+			"-q -a go-pf -vv -t blocklist -T show"},
+		{"Add", func() error { _, err := at.TableAdd("blocklist", "192.0.2.1"); return err },
+			"-a go-pf -t blocklist -T add -f -"},
+		{"Test", func() error { _, err := at.TableTest("blocklist", "192.0.2.1"); return err },
+			"-a go-pf -v -t blocklist -T test 192.0.2.1"},
+		{"Zero", func() error { _, err := at.ZeroTableCounters("blocklist"); return err },
+			"-a go-pf -t blocklist -T zero"},
+		{"Main ruleset", func() error { _, err := f.TableFlush("blocklist"); return err },
+			"-t blocklist -T flush"},
+	}
+	for _, testCase := range testTable {
+		t.Run(testCase.testName, func(t *testing.T) {
+			if err := testCase.op(); err != nil {
+				t.Fatalf("table operation failed: %s", err)
+			}
+			c, _ := r.LastCall()
+			if strings.Join(c.Args, " ") != testCase.args {
+				t.Errorf("unexpected pfctl arguments. Expected: %q, got: %q", testCase.args, c.Args)
+			}
+		})
+	}
+}
+
+// slowRunner is a Runner that ignores the context and reports a single added address after the delay
+type slowRunner struct {
+	delay time.Duration
+}
+
+// Run satisfies the Runner interface for the slowRunner
+func (r slowRunner) Run(_ context.Context, _ []string, _ io.Reader) ([]byte, []byte, int, error) {
+	time.Sleep(r.delay)
+	return nil, []byte("1/1 addresses added.\n"), 0, nil
+}
+
+// TestFirewall_TableBulk_Deadline tests that a deadline exceeded between two chunks is reported as
+// ErrTimeout, like a deadline exceeded within pfctl
+func TestFirewall_TableBulk_Deadline(t *testing.T) {
+	f, err := NewFirewallWithRunner(slowRunner{delay: time.Millisecond * 50})
+	if err != nil {
+		t.Fatalf("Could not create firewall object: %s", err)
+	}
+	f.SetTableChunkSize(1)
+	ctx, cancelFunc := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancelFunc()
+	tr, err := f.TableAddContext(ctx, "blocklist", "192.0.2.1", "192.0.2.2")
+	if !errors.Is(err, ErrTimeout) {
+		t.Errorf("TableAddContext was supposed to fail with ErrTimeout, got: %v", err)
+	}
+	var pfErr *PfctlError
+	if !errors.As(err, &pfErr) {
+		t.Errorf("TableAddContext was supposed to return a PfctlError, got: %T", err)
+	}
+	if tr.Added != 1 {
+		t.Errorf("unexpected table result: %+v", tr)
+	}
+}
@@ -0,0 +1,111 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package pf
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Table flags
+const (
+	TablePersist TableFlag = 1 << iota
+	TableConst
+	TableCounters
+)
+
+// TableFlag represents the flags of a table definition (i. e. persist or const). Flags can be
+// combined, i. e. TablePersist | TableCounters
+type TableFlag int
+
+// TableDef represents a table definition of an Anchor, i. e. table <blocklist> persist { 192.0.2.1 }.
+// The table is initialized with the given Entries and the entries of the given Files
+type TableDef struct {
+	Name    string
+	Flags   TableFlag
+	Entries []string
+	Files   []string
+}
+
+// DefineTable adds a table definition with the given name, flags and initial entries to the current
+// Anchor. The table is created when the Anchor is committed. Its entries can be changed with the
+// table operations of the Firewall returned by AnchorTables, unless the table is const
+func (a *Anchor) DefineTable(n string, f TableFlag, e ...string) error {
+	return a.defineTable(TableDef{Name: n, Flags: f, Entries: e})
+}
+
+// DefineTableFromFile adds a table definition with the given name and flags to the current Anchor,
+// whose initial entries are read by pfctl from the given files
+func (a *Anchor) DefineTableFromFile(n string, f TableFlag, p ...string) error {
+	return a.defineTable(TableDef{Name: n, Flags: f, Files: p})
+}
+
+// Tables returns the table definitions of the current Anchor
+func (a *Anchor) Tables() []TableDef {
+	return a.tables
+}
+
+// defineTable validates the given TableDef and adds it to the current Anchor
+func (a *Anchor) defineTable(td TableDef) error {
+	if err := td.Validate(); err != nil {
+		return err
+	}
+	for _, t := range a.tables {
+		if t.Name == td.Name {
+			return fmt.Errorf("table <%s> is already defined in anchor %s", td.Name, a.Name)
+		}
+	}
+	a.tables = append(a.tables, td)
+	return nil
+}
+
+// String returns the TableFlag in pf syntax
+func (f TableFlag) String() string {
+	flagArray := make([]string, 0)
+	for _, tf := range []struct {
+		flag TableFlag
+		name string
+	}{{TablePersist, "persist"}, {TableConst, "const"}, {TableCounters, "counters"}} {
+		if f&tf.flag != 0 {
+			flagArray = append(flagArray, tf.name)
+		}
+	}
+	return strings.Join(flagArray, " ")
+}
+
+// String returns the TableDef in pf syntax
+func (td TableDef) String() string {
+	tableArray := []string{"table", fmt.Sprintf("<%s>", td.Name)}
+	if flags := td.Flags.String(); flags != "" {
+		tableArray = append(tableArray, flags)
+	}
+	for _, p := range td.Files {
+		tableArray = append(tableArray, fmt.Sprintf("file \"%s\"", p))
+	}
+	if len(td.Entries) > 0 {
+		tableArray = append(tableArray, fmt.Sprintf("{ %s }", strings.Join(td.Entries, " ")))
+	}
+	return strings.Join(tableArray, " ")
+}
+
+// Validate checks the TableDef for invalid names, flags, entries and file paths
+func (td TableDef) Validate() error {
+	if err := validateTableName(td.Name); err != nil {
+		return err
+	}
+	if td.Flags&^(TablePersist|TableConst|TableCounters) != 0 {
+		return fmt.Errorf("unknown table flags: %d", td.Flags)
+	}
+	for _, e := range td.Entries {
+		if _, err := parseTableAddr(strings.TrimPrefix(e, "!")); err != nil {
+			return err
+		}
+	}
+	for _, p := range td.Files {
+		if p == "" || strings.ContainsAny(p, "\"\n") {
+			return fmt.Errorf("invalid table file path: %q", p)
+		}
+	}
+	return nil
+}
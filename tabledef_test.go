@@ -0,0 +1,92 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package pf
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestAnchor_DefineTable tests the rendering and validation of table definitions
+func TestAnchor_DefineTable(t *testing.T) {
+	testTable := []struct {
+		testName   string
+		def        func(a *Anchor) error
+		want       string
+		shouldFail bool
+	}{
+		{"Persist with entries", func(a *Anchor) error {
+			return a.DefineTable("blocklist", TablePersist, "192.0.2.1", "!198.51.100.0/24", "2001:db8::/32")
+		}, "table <blocklist> persist { 192.0.2.1 !198.51.100.0/24 2001:db8::/32 }", false},
+		{"All flags", func(a *Anchor) error {
+			return a.DefineTable("trusted", TablePersist|TableConst|TableCounters, "10.0.0.0/8")
+		}, "table <trusted> persist const counters { 10.0.0.0/8 }", false},
+		{"Empty table", func(a *Anchor) error { return a.DefineTable("empty", 0) }, "table <empty>", false},
+		{"From file", func(a *Anchor) error {
+			return a.DefineTableFromFile("spamd", TablePersist, "/etc/spamd.txt", "/etc/spamd-extra.txt")
+		}, "table <spamd> persist file \"/etc/spamd.txt\" file \"/etc/spamd-extra.txt\"", false},
+		{"Invalid name", func(a *Anchor) error { return a.DefineTable("in valid", 0) }, "", true},
+		{"Invalid flags", func(a *Anchor) error { return a.DefineTable("blocklist", TableFlag(8)) }, "", true},
+		{"Invalid entry", func(a *Anchor) error { return a.DefineTable("blocklist", 0, "foo") }, "", true},
+		{"Invalid file", func(a *Anchor) error { return a.DefineTableFromFile("blocklist", 0, "") }, "", true},
+	}
+	for _, testCase := range testTable {
+		t.Run(testCase.testName, func(t *testing.T) {
+			a := Anchor{Name: "go-pf"}
+			err := testCase.def(&a)
+			if err != nil && !testCase.shouldFail {
+				t.Fatalf("table definition failed: %s", err)
+			}
+			if err == nil && testCase.shouldFail {
+				t.Fatalf("table definition was supposed to fail, but didn't")
+			}
+			if testCase.shouldFail {
+				if len(a.Tables()) != 0 {
+					t.Errorf("invalid table definition has been added")
+				}
+				return
+			}
+			if len(a.Tables()) != 1 || a.Tables()[0].String() != testCase.want {
+				t.Errorf("unexpected table definition. Expected: %s, got: %+v", testCase.want, a.Tables())
+			}
+		})
+	}
+
+	a := Anchor{Name: "go-pf"}
+	if err := a.DefineTable("blocklist", TablePersist); err != nil {
+		t.Fatalf("DefineTable failed: %s", err)
+	}
+	if err := a.DefineTable("blocklist", TableConst); err == nil {
+		t.Errorf("DefineTable with duplicate name was supposed to fail")
+	}
+}
+
+// TestFirewall_CommitAnchor_Tables tests that table definitions are committed before the rules
+func TestFirewall_CommitAnchor_Tables(t *testing.T) {
+	f, r := newTestFirewall(t)
+	a := f.NewAnchor("go-pf")
+	if err := a.DefineTable("blocklist", TablePersist, "192.0.2.1"); err != nil {
+		t.Fatalf("DefineTable failed: %s", err)
+	}
+	ar := a.NewRule()
+	ar.SetDirection(DirectionIn)
+	if err := ar.SetSource(TableAddr("blocklist")); err != nil {
+		t.Fatalf("SetSource failed: %s", err)
+	}
+	ar.Commit()
+	a.AddRule(ar)
+	if err := f.CommitAnchor(&a); err != nil {
+		t.Fatalf("CommitAnchor failed: %s", err)
+	}
+	c, _ := r.LastCall()
+	want := "table <blocklist> persist { 192.0.2.1 }\nblock in from <blocklist> to any\n"
+	if string(c.Stdin) != want {
+		t.Errorf("unexpected stdin. Expected: %q, got: %q", want, string(c.Stdin))
+	}
+
+	a.tables[0].Entries = []string{"foo"}
+	if err := f.CommitAnchor(&a); err == nil || !strings.Contains(err.Error(), "table 0") {
+		t.Errorf("CommitAnchor with invalid table was supposed to fail, got: %v", err)
+	}
+}
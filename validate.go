@@ -0,0 +1,131 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package pf
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Rule kinds of a RuleDiagnostic
+const (
+	RuleKindTable       = "table"
+	RuleKindTranslation = "translation rule"
+	RuleKindFilter      = "rule"
+)
+
+// RuleDiagnostic represents a diagnostic of a ruleset validation, mapped to the rule that produced
+// the reported line. Kind tells if the line is a table definition, a translation rule or a filter
+// rule and Index is its position within the table definitions, translation rules or filter rules.
+// Index is -1 if the diagnostic could not be mapped to a rule
+type RuleDiagnostic struct {
+	Diagnostic
+	Kind  string
+	Index int
+	Rule  string
+}
+
+// ValidationError is returned by ValidateAnchor and ValidateRuleSet if the ruleset is invalid. Err
+// holds the error of the pfctl dry-run, if the ruleset has been rejected by pfctl
+type ValidationError struct {
+	Diagnostics []RuleDiagnostic
+	Err         error
+}
+
+// ruleLine represents a single line of a generated ruleset with the rule it has been rendered from
+type ruleLine struct {
+	kind     string
+	index    int
+	text     string
+	validate func() error
+}
+
+// ValidateAnchor checks the table definitions, translation rules and committed filter rules of the
+// given Anchor with a dry-run of pfctl, without loading them
+func (f *Firewall) ValidateAnchor(a *Anchor) error {
+	return f.ValidateAnchorContext(context.Background(), a)
+}
+
+// ValidateAnchorContext checks the table definitions, translation rules and committed filter rules
+// of the given Anchor with a dry-run of pfctl, without loading them. The given context is used for
+// the pfctl execution. If the Anchor is invalid, a *ValidationError is returned
+func (f *Firewall) ValidateAnchorContext(ctx context.Context, a *Anchor) error {
+	if err := validateAnchorName(a.Name, false); err != nil {
+		return err
+	}
+	return f.validateRuleLines(ctx, a.ruleLines(), "-a", a.Name)
+}
+
+// ValidateRuleSet checks the committed rules of the given RuleSet with a dry-run of pfctl, without
+// loading them
+func (f *Firewall) ValidateRuleSet(rs RuleSet) error {
+	return f.ValidateRuleSetContext(context.Background(), rs)
+}
+
+// ValidateRuleSetContext checks the committed rules of the given RuleSet with a dry-run of pfctl,
+// without loading them. The given context is used for the pfctl execution. If the RuleSet is
+// invalid, a *ValidationError is returned
+func (f *Firewall) ValidateRuleSetContext(ctx context.Context, rs RuleSet) error {
+	return f.validateRuleLines(ctx, rs.ruleLines())
+}
+
+// validateRuleLines validates the given ruleset lines. The rules are validated locally first, so
+// that pfctl is only called if they are valid. The diagnostics of a failed dry-run are mapped back
+// to the rules by their line number
+func (f *Firewall) validateRuleLines(ctx context.Context, l []ruleLine, a ...string) error {
+	var byteBuffer bytes.Buffer
+	ve := &ValidationError{}
+	for i, rl := range l {
+		if err := rl.validate(); err != nil {
+			ve.Diagnostics = append(ve.Diagnostics, RuleDiagnostic{Diagnostic: Diagnostic{Line: i + 1,
+				Message: err.Error()}, Kind: rl.kind, Index: rl.index, Rule: rl.text})
+		}
+		byteBuffer.WriteString(rl.text)
+		byteBuffer.WriteByte('\n')
+	}
+	if len(ve.Diagnostics) > 0 {
+		return ve
+	}
+
+	_, err := f.execPfCtlStdin(ctx, byteBuffer, append(a, "-n", "-f", "-")...)
+	var pfErr *PfctlError
+	if err == nil || !errors.As(err, &pfErr) || len(pfErr.Diagnostics) == 0 {
+		return err
+	}
+	ve.Err = err
+	for _, d := range pfErr.Diagnostics {
+		rd := RuleDiagnostic{Diagnostic: d, Index: -1}
+		if d.File == "stdin" && d.Line > 0 && d.Line <= len(l) {
+			rl := l[d.Line-1]
+			rd.Kind, rd.Index, rd.Rule = rl.kind, rl.index, rl.text
+		}
+		ve.Diagnostics = append(ve.Diagnostics, rd)
+	}
+	return ve
+}
+
+// String returns the RuleDiagnostic with the rule it has been mapped to
+func (d RuleDiagnostic) String() string {
+	if d.Index < 0 {
+		return d.Diagnostic.String()
+	}
+	return fmt.Sprintf("%s %d (line %d): %s", d.Kind, d.Index, d.Line, d.Message)
+}
+
+// Error satisfies the error interface for the ValidationError
+func (e *ValidationError) Error() string {
+	diagArray := make([]string, 0, len(e.Diagnostics))
+	for _, d := range e.Diagnostics {
+		diagArray = append(diagArray, d.String())
+	}
+	return fmt.Sprintf("ruleset validation failed: %s", strings.Join(diagArray, "; "))
+}
+
+// Unwrap returns the error of the pfctl dry-run of the ValidationError (if any)
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
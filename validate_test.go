@@ -0,0 +1,112 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package pf
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/wneessen/go-pf/pftest"
+)
+
+// TestFirewall_ValidateAnchor tests that pfctl diagnostics are mapped back to the rules of an anchor
+func TestFirewall_ValidateAnchor(t *testing.T) {
+	testTable := []struct {
+		testName   string
+		stderr     string
+		kind       string
+		index      int
+		shouldFail bool
+	}{
+		{"Valid anchor", "", "", 0, false},
+		{"Invalid table", "stdin:1: invalid table\n", RuleKindTable, 0, true},
+		{"Invalid translation rule", "stdin:2: syntax error\n", RuleKindTranslation, 0, true},
+		{"Invalid filter rule", "stdin:4: syntax error\n", RuleKindFilter, 1, true},
+		{"Line out of range", "stdin:9: syntax error\n", "", -1, true},
+	}
+	for _, testCase := range testTable {
+		t.Run(testCase.testName, func(t *testing.T) {
+			f, r := newTestFirewall(t)
+			exitCode := 0
+			if testCase.stderr != "" {
+				exitCode = 1
+			}
+			r.On(pftest.Response{Stderr: testCase.stderr, ExitCode: exitCode}, "-a", "go-pf", "-n", "-f", "-")
+			a := f.NewAnchor("go-pf")
+			if err := a.DefineTable("blocklist", TablePersist, "192.0.2.1"); err != nil {
+				t.Fatalf("failed to define table: %s", err)
+			}
+			tr, err := ParseTranslationRule("nat on em0 inet from 10.0.0.0/8 to any -> (em0)")
+			if err != nil {
+				t.Fatalf("failed to parse translation rule: %s", err)
+			}
+			if err := a.AddTranslationRule(tr); err != nil {
+				t.Fatalf("failed to add translation rule: %s", err)
+			}
+			for _, l := range []string{"block in all", "pass in on em0 proto tcp to port 22"} {
+				ar, err := ParseRule(l)
+				if err != nil {
+					t.Fatalf("failed to parse rule %q: %s", l, err)
+				}
+				a.AddRule(ar)
+			}
+
+			err = f.ValidateAnchor(&a)
+			if err != nil && !testCase.shouldFail {
+				t.Fatalf("ValidateAnchor failed: %s", err)
+			}
+			if err == nil && testCase.shouldFail {
+				t.Fatalf("ValidateAnchor was supposed to fail, but didn't")
+			}
+			c, _ := r.LastCall()
+			if strings.Join(c.Args, " ") != "-q -a go-pf -n -f -" {
+				t.Errorf("unexpected pfctl arguments: %q", c.Args)
+			}
+			if !testCase.shouldFail {
+				return
+			}
+			var ve *ValidationError
+			if !errors.As(err, &ve) {
+				t.Fatalf("ValidateAnchor was supposed to return a ValidationError, got: %T", err)
+			}
+			if len(ve.Diagnostics) != 1 || ve.Diagnostics[0].Kind != testCase.kind ||
+				ve.Diagnostics[0].Index != testCase.index {
+				t.Errorf("unexpected diagnostics: %+v", ve.Diagnostics)
+			}
+		})
+	}
+}
+
+// TestFirewall_ValidateRuleSet tests the validation of a main ruleset
+func TestFirewall_ValidateRuleSet(t *testing.T) {
+	f, r := newTestFirewall(t)
+	r.On(pftest.Response{Stderr: "stdin:2: syntax error\n", ExitCode: 1}, "-n", "-f", "-")
+	rs := RuleSet{}
+	for _, l := range []string{"block in all", "pass out all"} {
+		ar, err := ParseRule(l)
+		if err != nil {
+			t.Fatalf("failed to parse rule %q: %s", l, err)
+		}
+		rs.AddRule(ar)
+	}
+	err := f.ValidateRuleSet(rs)
+	if !errors.Is(err, ErrSyntax) {
+		t.Fatalf("ValidateRuleSet was supposed to fail with ErrSyntax, got: %v", err)
+	}
+	if !strings.Contains(err.Error(), "rule 1 (line 2): syntax error") {
+		t.Errorf("unexpected error message: %s", err)
+	}
+
+	r.Reset()
+	rs.Rules[0].Anchor = "foo"
+	err = f.ValidateRuleSet(rs)
+	var ve *ValidationError
+	if !errors.As(err, &ve) || len(ve.Diagnostics) != 1 || ve.Diagnostics[0].Index != 0 || ve.Err != nil {
+		t.Fatalf("ValidateRuleSet was supposed to fail the local validation, got: %v", err)
+	}
+	if len(r.Calls()) != 0 {
+		t.Errorf("pfctl was not supposed to be called for an invalid rule")
+	}
+}